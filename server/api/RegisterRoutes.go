@@ -68,15 +68,54 @@ func RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("POST /api/apps/domains/create", middleware.AuthMiddleware()(http.HandlerFunc(applications.CreateDomain)))
 	mux.Handle("POST /api/apps/domains/get", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetDomains)))
 	mux.Handle("PUT /api/apps/domains/update", middleware.AuthMiddleware()(http.HandlerFunc(applications.UpdateDomain)))
+	mux.Handle("POST /api/apps/domains/routing", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetDomainRouting)))
+	mux.Handle("PUT /api/apps/domains/settings", middleware.AuthMiddleware()(http.HandlerFunc(applications.UpdateDomainSettings)))
+	mux.Handle("POST /api/apps/domains/certificate", middleware.AuthMiddleware()(http.HandlerFunc(applications.UploadDomainCertificate)))
+	mux.Handle("DELETE /api/apps/domains/certificate", middleware.AuthMiddleware()(http.HandlerFunc(applications.RemoveDomainCertificate)))
 	mux.Handle("DELETE /api/apps/domains/delete", middleware.AuthMiddleware()(http.HandlerFunc(applications.DeleteDomain)))
 	mux.Handle("POST /api/apps/domains/verify", middleware.AuthMiddleware()(http.HandlerFunc(applications.VerifyDomainDNS)))
 	mux.Handle("POST /api/apps/domains/instructions", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetDNSInstructions)))
 
+	mux.Handle("POST /api/apps/access/get", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetAccessRules)))
+	mux.Handle("POST /api/apps/access/users/create", middleware.AuthMiddleware()(http.HandlerFunc(applications.CreateAccessUser)))
+	mux.Handle("PUT /api/apps/access/users/update", middleware.AuthMiddleware()(http.HandlerFunc(applications.UpdateAccessUser)))
+	mux.Handle("DELETE /api/apps/access/users/delete", middleware.AuthMiddleware()(http.HandlerFunc(applications.DeleteAccessUser)))
+	mux.Handle("POST /api/apps/access/ip-rules/create", middleware.AuthMiddleware()(http.HandlerFunc(applications.CreateAccessIPRule)))
+	mux.Handle("DELETE /api/apps/access/ip-rules/delete", middleware.AuthMiddleware()(http.HandlerFunc(applications.DeleteAccessIPRule)))
+
+	mux.Handle("POST /api/apps/maintenance/get", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetMaintenanceSettings)))
+	mux.Handle("PUT /api/apps/maintenance/update", middleware.AuthMiddleware()(http.HandlerFunc(applications.UpdateMaintenanceSettings)))
+	// fetched by traefik for the app's visitors, no session involved
+	mux.HandleFunc("GET /api/pages/{appId}/{page}", applications.ServeAppPage)
+
 	mux.Handle("POST /api/apps/volumes/get", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetVolumes)))
 	mux.Handle("POST /api/apps/volumes/create", middleware.AuthMiddleware()(http.HandlerFunc(applications.CreateVolume)))
 	mux.Handle("PUT /api/apps/volumes/update", middleware.AuthMiddleware()(http.HandlerFunc(applications.UpdateVolume)))
 	mux.Handle("DELETE /api/apps/volumes/delete", middleware.AuthMiddleware()(http.HandlerFunc(applications.DeleteVolume)))
 
+	mux.Handle("POST /api/apps/repositories/get", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetAppRepositories)))
+	mux.Handle("POST /api/apps/repositories/create", middleware.AuthMiddleware()(http.HandlerFunc(applications.CreateAppRepository)))
+	mux.Handle("PUT /api/apps/repositories/update", middleware.AuthMiddleware()(http.HandlerFunc(applications.UpdateAppRepository)))
+	mux.Handle("DELETE /api/apps/repositories/delete", middleware.AuthMiddleware()(http.HandlerFunc(applications.DeleteAppRepository)))
+
+	mux.Handle("POST /api/apps/deploy-hook/get", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetDeployHook)))
+	mux.Handle("POST /api/apps/deploy-hook/create", middleware.AuthMiddleware()(http.HandlerFunc(applications.CreateDeployHook)))
+	mux.Handle("POST /api/apps/deploy-hook/rotate", middleware.AuthMiddleware()(http.HandlerFunc(applications.RotateDeployHook)))
+	mux.Handle("PUT /api/apps/deploy-hook/update", middleware.AuthMiddleware()(http.HandlerFunc(applications.UpdateDeployHook)))
+	mux.Handle("DELETE /api/apps/deploy-hook/delete", middleware.AuthMiddleware()(http.HandlerFunc(applications.DeleteDeployHook)))
+
+	mux.Handle("POST /api/apps/static/versions", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetStaticVersions)))
+	mux.Handle("POST /api/apps/static/rollback", middleware.AuthMiddleware()(http.HandlerFunc(applications.RollbackStaticVersion)))
+
+	mux.Handle("POST /api/apps/compose/definition", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetComposeDefinition)))
+	mux.Handle("POST /api/apps/compose/definition/diff", middleware.AuthMiddleware()(http.HandlerFunc(applications.DiffComposeDefinition)))
+	mux.Handle("PUT /api/apps/compose/definition/update", middleware.AuthMiddleware()(http.HandlerFunc(applications.UpdateComposeDefinition)))
+	mux.Handle("POST /api/apps/compose/services", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetComposeServices)))
+	mux.Handle("POST /api/apps/compose/services/restart", middleware.AuthMiddleware()(http.HandlerFunc(applications.RestartComposeService)))
+	mux.Handle("POST /api/apps/compose/services/stop", middleware.AuthMiddleware()(http.HandlerFunc(applications.StopComposeService)))
+	mux.Handle("POST /api/apps/compose/services/scale", middleware.AuthMiddleware()(http.HandlerFunc(applications.ScaleComposeService)))
+	mux.Handle("GET /api/apps/compose/services/logs", middleware.AuthMiddleware()(http.HandlerFunc(applications.GetComposeServiceLogs)))
+
 	mux.Handle("POST /api/apps/container/stop", middleware.AuthMiddleware()(http.HandlerFunc(applications.StopContainerHandler)))
 	mux.Handle("POST /api/apps/container/start", middleware.AuthMiddleware()(http.HandlerFunc(applications.StartContainerHandler)))
 	mux.Handle("POST /api/apps/container/restart", middleware.AuthMiddleware()(http.HandlerFunc(applications.RestartContainerHandler)))
@@ -88,9 +127,14 @@ func RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("GET /api/github/app/create", middleware.AuthMiddleware()(http.HandlerFunc(github.CreateGithubApp)))
 	mux.Handle("GET /api/github/callback", http.HandlerFunc(github.CallBackHandler))
 	mux.Handle("GET /api/github/installation/callback", http.HandlerFunc(github.HandleInstallationEvent))
+	mux.Handle("GET /api/github/installations", middleware.AuthMiddleware()(http.HandlerFunc(github.GetInstallations)))
+	mux.Handle("PUT /api/github/installations/scope", middleware.AuthMiddleware()(http.HandlerFunc(github.UpdateInstallationScope)))
 	mux.Handle("GET /api/github/repositories", middleware.AuthMiddleware()(http.HandlerFunc(github.GetRepositories)))
 	mux.Handle("POST /api/github/branches", middleware.AuthMiddleware()(http.HandlerFunc(github.GetBranches)))
 	mux.HandleFunc("POST /api/github/webhook", github.GithubWebhook)
+	mux.Handle("GET /api/github/webhook/deliveries", middleware.AuthMiddleware()(http.HandlerFunc(github.GetWebhookDeliveries)))
+	mux.Handle("GET /api/github/webhook/deliveries/details", middleware.AuthMiddleware()(http.HandlerFunc(github.GetWebhookDelivery)))
+	mux.Handle("POST /api/github/webhook/deliveries/redeliver", middleware.AuthMiddleware()(http.HandlerFunc(github.RedeliverWebhook)))
 
 	mux.HandleFunc("/api/deployments/logs/stream", deployments.LogsHandler)
 	mux.Handle("POST /api/deployments", middleware.AuthMiddleware()(http.HandlerFunc(deployments.AddDeployHandler)))
@@ -98,6 +142,8 @@ func RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("POST /api/deployments/getByAppId", middleware.AuthMiddleware()(http.HandlerFunc(deployments.GetByApplicationID)))
 	mux.Handle("GET /api/deployments/logs", middleware.AuthMiddleware()(http.HandlerFunc(deployments.GetCompletedDeploymentLogsHandler)))
 	mux.Handle("POST /api/deployments/stopDep", middleware.AuthMiddleware()(http.HandlerFunc(deployments.StopDeployment)))
+	mux.Handle("POST /api/deployments/upload", middleware.AuthMiddleware()(http.HandlerFunc(deployments.UploadDeployHandler)))
+	mux.HandleFunc("POST /api/hooks/deploy/{token}", deployments.DeployHookHandler)
 
 	mux.Handle("GET /api/templates/list", middleware.AuthMiddleware()(http.HandlerFunc(templates.ListServiceTemplates)))
 	mux.Handle("GET /api/templates/get", middleware.AuthMiddleware()(http.HandlerFunc(templates.GetServiceTemplateByName)))
@@ -106,6 +152,8 @@ func RegisterRoutes(mux *http.ServeMux) {
 
 	mux.Handle("GET /api/settings/system", middleware.AuthMiddleware()(http.HandlerFunc(settings.GetSystemSettings)))
 	mux.Handle("PUT /api/settings/system", middleware.AuthMiddleware()(http.HandlerFunc(settings.UpdateSystemSettings)))
+	mux.Handle("GET /api/settings/dns-challenge", middleware.AuthMiddleware()(http.HandlerFunc(settings.GetDNSChallengeSettings)))
+	mux.Handle("PUT /api/settings/dns-challenge", middleware.AuthMiddleware()(http.HandlerFunc(settings.UpdateDNSChallengeSettings)))
 	mux.Handle("POST /api/settings/docker/cleanup", middleware.AuthMiddleware()(http.HandlerFunc(settings.DockerCleanup)))
 
 	mux.Handle("GET /api/updates/version", middleware.AuthMiddleware()(http.HandlerFunc(updates.GetCurrentVersion)))
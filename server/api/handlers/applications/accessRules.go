@@ -0,0 +1,425 @@
+package applications
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
+)
+
+const minAccessPasswordLength = 8
+
+// basic auth users and ip rules of an app, password hashes are never returned
+func GetAccessRules(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID int64 `json:"appId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	app, err := models.GetApplicationByID(req.AppID)
+	if err != nil || app == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Application not found", "")
+		return
+	}
+	isUserMember, err := models.HasUserAccessToProject(userInfo.ID, app.ProjectID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify access", err.Error())
+		return
+	}
+	if !isUserMember {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have access to this application", "")
+		return
+	}
+
+	users, err := models.GetAccessUsersByAppID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get access users", err.Error())
+		return
+	}
+	ipRules, err := models.GetAccessIPRulesByAppID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get ip rules", err.Error())
+		return
+	}
+
+	handlers.SendResponse(w, http.StatusOK, true, map[string]interface{}{
+		"users":   users,
+		"ipRules": ipRules,
+	}, "Access rules retrieved successfully", "")
+}
+
+func CreateAccessUser(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID    int64  `json:"appId"`
+		DomainID *int64 `json:"domainId"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if req.AppID == 0 || req.Username == "" || req.Password == "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID, username and password are required", "Missing fields")
+		return
+	}
+	if errMsg := validateAccessCredentials(req.Username, req.Password); errMsg != "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid credentials", errMsg)
+		return
+	}
+	if !canManageAccess(w, userInfo.ID, req.AppID, req.DomainID) {
+		return
+	}
+
+	exists, err := models.AccessUserExists(req.AppID, req.DomainID, req.Username)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to check existing users", err.Error())
+		return
+	}
+	if exists {
+		handlers.SendResponse(w, http.StatusConflict, false, nil, "User already exists", "A user with this name already exists for this scope")
+		return
+	}
+
+	user, err := models.CreateAccessUser(req.AppID, req.DomainID, req.Username, req.Password)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to create user", err.Error())
+		return
+	}
+	if err := traefik.RenderApp(req.AppID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "User created but routing could not be updated", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "create", "access_user", &user.ID, map[string]interface{}{
+		"appId":    req.AppID,
+		"domainId": req.DomainID,
+		"username": req.Username,
+	})
+
+	handlers.SendResponse(w, http.StatusCreated, true, user, "User created successfully", "")
+}
+
+func UpdateAccessUser(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		ID       int64  `json:"id"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.ID == 0 || req.Password == "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "ID and password are required", "Missing fields")
+		return
+	}
+
+	user, err := models.GetAccessUserByID(req.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get user", err.Error())
+		return
+	}
+	if user == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "User not found", "")
+		return
+	}
+	if errMsg := validateAccessCredentials(user.Username, req.Password); errMsg != "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid credentials", errMsg)
+		return
+	}
+	if !canManageAccess(w, userInfo.ID, user.AppID, nil) {
+		return
+	}
+
+	if err := models.UpdateAccessUserPassword(user.ID, req.Password); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to update password", err.Error())
+		return
+	}
+	if err := traefik.RenderApp(user.AppID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Password updated but routing could not be updated", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "update_password", "access_user", &user.ID, map[string]interface{}{
+		"appId":    user.AppID,
+		"domainId": user.DomainID,
+		"username": user.Username,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, nil, "Password updated successfully", "")
+}
+
+func DeleteAccessUser(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.ID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "ID is required", "Missing fields")
+		return
+	}
+
+	user, err := models.GetAccessUserByID(req.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get user", err.Error())
+		return
+	}
+	if user == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "User not found", "")
+		return
+	}
+	if !canManageAccess(w, userInfo.ID, user.AppID, nil) {
+		return
+	}
+
+	if err := models.DeleteAccessUser(user.ID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to delete user", err.Error())
+		return
+	}
+	if err := traefik.RenderApp(user.AppID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "User deleted but routing could not be updated", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "delete", "access_user", &user.ID, map[string]interface{}{
+		"appId":    user.AppID,
+		"domainId": user.DomainID,
+		"username": user.Username,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, nil, "User deleted successfully", "")
+}
+
+func CreateAccessIPRule(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID       int64  `json:"appId"`
+		DomainID    *int64 `json:"domainId"`
+		Action      string `json:"action"`
+		Source      string `json:"source"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 || req.Source == "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID and source are required", "Missing fields")
+		return
+	}
+
+	action := models.IPRuleAllow
+	switch req.Action {
+	case "", string(models.IPRuleAllow):
+	case string(models.IPRuleDeny):
+		action = models.IPRuleDeny
+	default:
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid action", "Action must be allow or deny")
+		return
+	}
+	source, err := traefik.ParseIPSource(req.Source)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid source", err.Error())
+		return
+	}
+	if !canManageAccess(w, userInfo.ID, req.AppID, req.DomainID) {
+		return
+	}
+
+	rule := &models.AccessIPRule{
+		AppID:       req.AppID,
+		DomainID:    req.DomainID,
+		Action:      action,
+		Source:      source.String(),
+		Description: strings.TrimSpace(req.Description),
+	}
+
+	// a deny rule covering everything that is allowed would take the app offline
+	domains, err := models.GetDomainsByAppID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get domains", err.Error())
+		return
+	}
+	ipRules, err := models.GetAccessIPRulesByAppID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get ip rules", err.Error())
+		return
+	}
+	if _, err := traefik.BuildAccessRules(domains, nil, append(ipRules, *rule)); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Rule would block every client", err.Error())
+		return
+	}
+
+	if err := models.CreateAccessIPRule(rule); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to create ip rule", err.Error())
+		return
+	}
+	if err := traefik.RenderApp(req.AppID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Rule created but routing could not be updated", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "create", "access_ip_rule", &rule.ID, map[string]interface{}{
+		"appId":    rule.AppID,
+		"domainId": rule.DomainID,
+		"action":   rule.Action,
+		"source":   rule.Source,
+	})
+
+	handlers.SendResponse(w, http.StatusCreated, true, rule, "IP rule created successfully", "")
+}
+
+func DeleteAccessIPRule(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.ID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "ID is required", "Missing fields")
+		return
+	}
+
+	rule, err := models.GetAccessIPRuleByID(req.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get ip rule", err.Error())
+		return
+	}
+	if rule == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "IP rule not found", "")
+		return
+	}
+	if !canManageAccess(w, userInfo.ID, rule.AppID, nil) {
+		return
+	}
+
+	// removing an allow rule can leave only deny rules that cover everything
+	domains, err := models.GetDomainsByAppID(rule.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get domains", err.Error())
+		return
+	}
+	ipRules, err := models.GetAccessIPRulesByAppID(rule.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get ip rules", err.Error())
+		return
+	}
+	var remaining []models.AccessIPRule
+	for _, other := range ipRules {
+		if other.ID != rule.ID {
+			remaining = append(remaining, other)
+		}
+	}
+	if _, err := traefik.BuildAccessRules(domains, nil, remaining); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Removing this rule would block every client", err.Error())
+		return
+	}
+
+	if err := models.DeleteAccessIPRule(rule.ID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to delete ip rule", err.Error())
+		return
+	}
+	if err := traefik.RenderApp(rule.AppID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Rule deleted but routing could not be updated", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "delete", "access_ip_rule", &rule.ID, map[string]interface{}{
+		"appId":    rule.AppID,
+		"domainId": rule.DomainID,
+		"action":   rule.Action,
+		"source":   rule.Source,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, nil, "IP rule deleted successfully", "")
+}
+
+// htpasswd entries are "user:hash", so the name can't hold a colon
+func validateAccessCredentials(username, password string) string {
+	if len(username) > 64 || strings.ContainsAny(username, ": \t\r\n") {
+		return "Username must be at most 64 characters without colons or whitespace"
+	}
+	if len(password) < minAccessPasswordLength {
+		return "Password must be at least 8 characters"
+	}
+	if len(password) > 72 {
+		// bcrypt ignores everything past 72 bytes
+		return "Password must be at most 72 bytes"
+	}
+	return ""
+}
+
+// only the app's owner changes who can reach it, a domain scope has to be one of the app's domains
+func canManageAccess(w http.ResponseWriter, userID, appID int64, domainID *int64) bool {
+	isApplicationOwner, err := models.IsUserApplicationOwner(userID, appID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return false
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+		return false
+	}
+	if domainID == nil {
+		return true
+	}
+	domain, err := models.GetDomainByID(*domainID)
+	if err != nil || domain.AppID != appID {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Domain does not belong to this application", "Invalid domain")
+		return false
+	}
+	return true
+}
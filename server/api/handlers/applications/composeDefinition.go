@@ -0,0 +1,159 @@
+package applications
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/compose"
+	"github.com/corecollectives/mist/models"
+)
+
+type composeDefinitionRequest struct {
+	AppID      int64  `json:"appId"`
+	Definition string `json:"definition"`
+}
+
+// the saved inline definition next to the one that is currently deployed
+func GetComposeDefinition(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req composeDefinitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	app, ok := composeAppForUser(w, userInfo.ID, req.AppID)
+	if !ok {
+		return
+	}
+
+	definition := ""
+	if app.ComposeDefinition != nil {
+		definition = *app.ComposeDefinition
+	}
+	deployed := deployedComposeDefinition(app.ID)
+
+	handlers.SendResponse(w, http.StatusOK, true, map[string]interface{}{
+		"definition":         definition,
+		"deployedDefinition": deployed,
+		"diff":               compose.DiffDefinitions(deployed, definition),
+	}, "Compose definition retrieved successfully", "")
+}
+
+// diff of an edited definition against the deployed one, nothing is saved
+func DiffComposeDefinition(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req composeDefinitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	app, ok := composeAppForUser(w, userInfo.ID, req.AppID)
+	if !ok {
+		return
+	}
+
+	diff := compose.DiffDefinitions(deployedComposeDefinition(app.ID), req.Definition)
+	handlers.SendResponse(w, http.StatusOK, true, map[string]interface{}{
+		"diff":    diff,
+		"changed": diff != "",
+	}, "Diff generated successfully", "")
+}
+
+// saves the inline definition after parsing it with the app's env vars, an empty definition
+// switches the app back to the compose file in its repository
+func UpdateComposeDefinition(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req composeDefinitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	app, ok := composeAppForUser(w, userInfo.ID, req.AppID)
+	if !ok {
+		return
+	}
+
+	var warnings []string
+	if req.Definition != "" {
+		project, err := compose.ValidateDefinition(r.Context(), req.Definition, composeEnv(app.ID))
+		if err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid compose definition", err.Error())
+			return
+		}
+		domains, err := models.GetDomainsByAppID(app.ID)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to load domains", err.Error())
+			return
+		}
+		warnings, err = compose.ValidateProject(project, domains)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Unsupported compose definition", err.Error())
+			return
+		}
+	}
+
+	if err := models.UpdateAppComposeDefinition(app.ID, &req.Definition); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to save compose definition", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "update", "application", &app.ID, map[string]interface{}{
+		"compose_definition": compose.DefinitionHash(req.Definition),
+		"inline":             req.Definition != "",
+	})
+
+	if warnings == nil {
+		warnings = []string{}
+	}
+	diff := compose.DiffDefinitions(deployedComposeDefinition(app.ID), req.Definition)
+	response := map[string]interface{}{
+		"diff":     diff,
+		"warnings": warnings,
+	}
+	if diff != "" {
+		response["actionRequired"] = "redeploy"
+		response["actionMessage"] = "The compose definition differs from the deployed one. Would you like to redeploy now?"
+	}
+	handlers.SendResponse(w, http.StatusOK, true, response, "Compose definition saved successfully", "")
+}
+
+// empty when the running deployment came from a repository or nothing is deployed yet
+func deployedComposeDefinition(appID int64) string {
+	dep, err := models.GetActiveDeploymentByAppID(appID)
+	if err != nil || dep.ComposeDefinition == nil {
+		return ""
+	}
+	return *dep.ComposeDefinition
+}
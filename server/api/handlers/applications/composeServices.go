@@ -0,0 +1,292 @@
+package applications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/compose"
+	"github.com/corecollectives/mist/models"
+)
+
+// upper bound for the scale endpoint, mostly to catch typos
+const maxComposeReplicas = 20
+
+type composeServiceRequest struct {
+	AppID    int64  `json:"appId"`
+	Service  string `json:"service"`
+	Replicas int    `json:"replicas"`
+}
+
+// services declared in the compose file together with what is currently running for each of them
+func GetComposeServices(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req composeServiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	app, ok := composeAppForUser(w, userInfo.ID, req.AppID)
+	if !ok {
+		return
+	}
+	path := composeAppPath(app)
+	project, ok := loadComposeProject(w, r, app, path)
+	if !ok {
+		return
+	}
+
+	// containers per service, `compose ps` lists one entry per replica
+	running := map[string][]compose.ComposeService{}
+	if status, err := compose.GetComposeStatus(r.Context(), app.ID, path, app.Name); err == nil {
+		for _, s := range status.Services {
+			running[s.Name] = append(running[s.Name], s)
+		}
+	}
+
+	services := []map[string]interface{}{}
+	for _, def := range compose.DescribeServices(project) {
+		containers := running[def.Name]
+		if containers == nil {
+			containers = []compose.ComposeService{}
+		}
+		runningCount := 0
+		for _, c := range containers {
+			if c.State == "running" {
+				runningCount++
+			}
+		}
+		services = append(services, map[string]interface{}{
+			"name":          def.Name,
+			"image":         def.Image,
+			"build":         def.Build,
+			"ports":         def.Ports,
+			"volumes":       def.Volumes,
+			"scale":         def.Scale,
+			"containerName": def.ContainerName,
+			"canScale":      compose.CanScale(project, def.Name) == nil,
+			"containers":    containers,
+			"running":       runningCount,
+		})
+	}
+
+	handlers.SendResponse(w, http.StatusOK, true, services, "Compose services retrieved successfully", "")
+}
+
+func RestartComposeService(w http.ResponseWriter, r *http.Request) {
+	composeServiceAction(w, r, "restart", "restarted", compose.ComposeServiceRestart)
+}
+
+func StopComposeService(w http.ResponseWriter, r *http.Request) {
+	composeServiceAction(w, r, "stop", "stopped", compose.ComposeServiceStop)
+}
+
+func composeServiceAction(w http.ResponseWriter, r *http.Request, action, done string, run func(context.Context, int64, string, map[string]string, string) error) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req composeServiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 || req.Service == "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID and service are required", "Missing fields")
+		return
+	}
+
+	app, ok := composeAppForUser(w, userInfo.ID, req.AppID)
+	if !ok {
+		return
+	}
+	path := composeAppPath(app)
+	project, ok := loadComposeProject(w, r, app, path)
+	if !ok {
+		return
+	}
+	if _, exists := project.Services[req.Service]; !exists {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Service not found", fmt.Sprintf("service %q is not defined in the compose file", req.Service))
+		return
+	}
+
+	if err := run(context.Background(), app.ID, path, composeEnv(app.ID), req.Service); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, fmt.Sprintf("Failed to %s service", action), err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, action, "application", &app.ID, map[string]interface{}{
+		"service": req.Service,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, map[string]interface{}{
+		"service": req.Service,
+	}, fmt.Sprintf("Service %s %s successfully", req.Service, done), "")
+}
+
+func GetComposeServiceLogs(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	appId, err := strconv.ParseInt(r.URL.Query().Get("appId"), 10, 64)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid appId", "")
+		return
+	}
+	service := r.URL.Query().Get("service")
+	if service == "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "service is required", "")
+		return
+	}
+	tail := 100
+	if parsedTail, err := strconv.Atoi(r.URL.Query().Get("tail")); err == nil && parsedTail > 0 {
+		tail = parsedTail
+	}
+
+	app, ok := composeAppForUser(w, userInfo.ID, appId)
+	if !ok {
+		return
+	}
+	path := composeAppPath(app)
+	project, ok := loadComposeProject(w, r, app, path)
+	if !ok {
+		return
+	}
+	if _, exists := project.Services[service]; !exists {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Service not found", fmt.Sprintf("service %q is not defined in the compose file", service))
+		return
+	}
+
+	logs, err := compose.GetComposeServiceLogs(r.Context(), app.ID, path, composeEnv(app.ID), service, tail)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get service logs", err.Error())
+		return
+	}
+	handlers.SendResponse(w, http.StatusOK, true, map[string]any{
+		"logs": logs,
+	}, "Service logs retrieved successfully", "")
+}
+
+func ScaleComposeService(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req composeServiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 || req.Service == "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID and service are required", "Missing fields")
+		return
+	}
+	if req.Replicas < 0 || req.Replicas > maxComposeReplicas {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, fmt.Sprintf("Replicas must be between 0 and %d", maxComposeReplicas), "Invalid replicas")
+		return
+	}
+
+	app, ok := composeAppForUser(w, userInfo.ID, req.AppID)
+	if !ok {
+		return
+	}
+	path := composeAppPath(app)
+	project, ok := loadComposeProject(w, r, app, path)
+	if !ok {
+		return
+	}
+	if _, exists := project.Services[req.Service]; !exists {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Service not found", fmt.Sprintf("service %q is not defined in the compose file", req.Service))
+		return
+	}
+	if req.Replicas > 1 {
+		if err := compose.CanScale(project, req.Service); err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Service can't be scaled", err.Error())
+			return
+		}
+	}
+
+	if err := compose.ComposeScale(context.Background(), app.ID, path, composeEnv(app.ID), req.Service, req.Replicas); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to scale service", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "scale", "application", &app.ID, map[string]interface{}{
+		"service":  req.Service,
+		"replicas": req.Replicas,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, map[string]interface{}{
+		"service":  req.Service,
+		"replicas": req.Replicas,
+	}, "Service scaled successfully", "")
+}
+
+func composeAppForUser(w http.ResponseWriter, userID, appID int64) (*models.App, bool) {
+	isApplicationOwner, err := models.IsUserApplicationOwner(userID, appID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return nil, false
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to manage this application", "Forbidden")
+		return nil, false
+	}
+	app, err := models.GetApplicationByID(appID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Application not found", err.Error())
+		return nil, false
+	}
+	if app.AppType != models.AppTypeCompose {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Not a compose app", "Services are only available for compose apps")
+		return nil, false
+	}
+	return app, true
+}
+
+func composeAppPath(app *models.App) string {
+	return fmt.Sprintf("/var/lib/mist/projects/%d/apps/%s", app.ProjectID, app.Name)
+}
+
+// every variable of the app, the same set the deployer merges from build time and runtime variables,
+// so compose interpolates the file the way the deployment did
+func composeEnv(appID int64) map[string]string {
+	envVars, _ := models.GetEnvVariablesByAppID(appID)
+	envMap := make(map[string]string)
+	for _, e := range envVars {
+		envMap[e.Key] = e.Value
+	}
+	return envMap
+}
+
+// the compose file is parsed on every request so the list always matches what is on disk
+func loadComposeProject(w http.ResponseWriter, r *http.Request, app *models.App, path string) (*types.Project, bool) {
+	project, err := compose.LoadProject(r.Context(), path, composeEnv(app.ID))
+	if err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Failed to parse compose file", err.Error())
+		return nil, false
+	}
+	return project, true
+}
@@ -1,6 +1,7 @@
 package applications
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -50,7 +51,7 @@ func StopContainerHandler(w http.ResponseWriter, r *http.Request) {
 
 	if app.AppType == models.AppTypeCompose {
 		path := fmt.Sprintf("/var/lib/mist/projects/%d/apps/%s", app.ProjectID, app.Name)
-		err = compose.ComposeDown(path)
+		err = compose.ComposeDown(context.Background(), app.ID, path, composeEnv(app.ID))
 	} else {
 		containerName := docker.GetContainerName(app.Name, appId)
 		err = docker.StopContainer(containerName)
@@ -125,7 +126,7 @@ func StartContainerHandler(w http.ResponseWriter, r *http.Request) {
 		for _, e := range envVars {
 			envMap[e.Key] = e.Value
 		}
-		startErr = compose.ComposeUp(path, envMap, nil)
+		startErr = compose.ComposeUp(context.Background(), app.ID, path, envMap, nil)
 	} else {
 		containerName := docker.GetContainerName(app.Name, appId)
 		startErr = docker.StartContainer(containerName)
@@ -195,7 +196,7 @@ func RestartContainerHandler(w http.ResponseWriter, r *http.Request) {
 	var restartErr error
 	if app.AppType == models.AppTypeCompose {
 		path := fmt.Sprintf("/var/lib/mist/projects/%d/apps/%s", app.ProjectID, app.Name)
-		restartErr = compose.ComposeRestart(path)
+		restartErr = compose.ComposeRestart(context.Background(), app.ID, path, composeEnv(app.ID))
 	} else {
 		containerName := docker.GetContainerName(app.Name, appId)
 		restartErr = docker.RestartContainer(containerName)
@@ -324,7 +325,7 @@ func GetContainerStatusHandler(w http.ResponseWriter, r *http.Request) {
 
 	if app.AppType == models.AppTypeCompose {
 		path := fmt.Sprintf("/var/lib/mist/projects/%d/apps/%s", app.ProjectID, app.Name)
-		status, err := compose.GetComposeStatus(path, app.Name)
+		status, err := compose.GetComposeStatus(r.Context(), app.ID, path, app.Name)
 		if err != nil {
 			handlers.SendResponse(w, http.StatusOK, true, map[string]interface{}{
 				"name":   app.Name,
@@ -392,7 +393,7 @@ func GetContainerLogsHandler(w http.ResponseWriter, r *http.Request) {
 
 	if app.AppType == models.AppTypeCompose {
 		path := fmt.Sprintf("/var/lib/mist/projects/%d/apps/%s", app.ProjectID, app.Name)
-		logs, err := compose.GetComposeLogs(path, tail)
+		logs, err := compose.GetComposeLogs(r.Context(), app.ID, path, composeEnv(app.ID), tail)
 		if err != nil {
 			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get compose logs", err.Error())
 			return
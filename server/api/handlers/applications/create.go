@@ -7,6 +7,8 @@ import (
 	"github.com/corecollectives/mist/api/handlers"
 	"github.com/corecollectives/mist/api/middleware"
 	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
+	"github.com/rs/zerolog/log"
 )
 
 func CreateApplication(w http.ResponseWriter, r *http.Request) {
@@ -20,7 +22,7 @@ func CreateApplication(w http.ResponseWriter, r *http.Request) {
 		Name         string            `json:"name"`
 		Description  string            `json:"description"`
 		ProjectID    int64             `json:"projectId"`
-		AppType      string            `json:"appType"`      // "web", "service", "database"
+		AppType      string            `json:"appType"`      // "web", "service", "database", "compose", "static"
 		TemplateName *string           `json:"templateName"` // For database type
 		Port         *int              `json:"port"`         // For web type
 		ShouldExpose *bool             `json:"shouldExpose"` // For web type
@@ -46,8 +48,8 @@ func CreateApplication(w http.ResponseWriter, r *http.Request) {
 		req.AppType = "web"
 	}
 
-	if req.AppType != "web" && req.AppType != "service" && req.AppType != "database" && req.AppType != "compose" {
-		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid app type", "Must be 'web', 'service', 'database', or 'compose'")
+	if req.AppType != "web" && req.AppType != "service" && req.AppType != "database" && req.AppType != "compose" && req.AppType != "static" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid app type", "Must be 'web', 'service', 'database', 'compose', or 'static'")
 		return
 	}
 
@@ -154,13 +156,17 @@ func CreateApplication(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.AppType == "web" {
+	if req.AppType == "web" || req.AppType == "static" {
 		project, err := models.GetProjectByID(req.ProjectID)
 		if err == nil {
 			autoDomain, err := models.GenerateAutoDomain(project.Name, app.Name)
 			if err == nil && autoDomain != "" {
-				_, err = models.CreateDomain(app.ID, autoDomain)
-				if err != nil {
+				d, err := models.CreateDomain(app.ID, autoDomain)
+				if err == nil {
+					// the generated domain is below the wildcard domain, which mist owns already
+					if verified, err := traefik.AutoVerifyOwnership(d); err != nil || !verified {
+						log.Warn().Err(err).Int64("app_id", app.ID).Str("domain", autoDomain).Msg("Failed to verify ownership of the generated domain")
+					}
 				}
 			}
 		}
@@ -15,6 +15,8 @@ import (
 	"github.com/corecollectives/mist/constants"
 	"github.com/corecollectives/mist/docker"
 	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/staticsite"
+	"github.com/corecollectives/mist/traefik"
 	"github.com/moby/moby/client"
 	"github.com/rs/zerolog/log"
 )
@@ -145,6 +147,23 @@ func DeleteApplication(w http.ResponseWriter, r *http.Request) {
 	// 	}
 	// }
 
+	if err := traefik.RemoveAppConfig(app.ID); err != nil {
+		log.Warn().Err(err).Int64("app_id", app.ID).Msg("Failed to remove routing config during app deletion")
+	}
+	if domains, err := models.GetDomainsByAppID(app.ID); err == nil {
+		for _, d := range domains {
+			if err := traefik.RemoveCertificate(d.ID); err != nil {
+				log.Warn().Err(err).Int64("domain_id", d.ID).Msg("Failed to remove certificate files during app deletion")
+			}
+		}
+	}
+
+	if app.AppType == models.AppTypeStatic {
+		if err := staticsite.RemoveApp(app.ID); err != nil {
+			log.Warn().Err(err).Int64("app_id", app.ID).Msg("Failed to remove static site versions during app deletion")
+		}
+	}
+
 	appPath := fmt.Sprintf("/var/lib/mist/projects/%d/apps/%s", app.ProjectID, app.Name)
 	if _, err := os.Stat(appPath); err == nil {
 		if err := os.RemoveAll(appPath); err != nil {
@@ -0,0 +1,291 @@
+package applications
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/models"
+)
+
+// the token and secret are only ever returned right after they are generated, same as api tokens
+func deployHookResponse(hook *models.DeployHook, includeSecret bool) map[string]interface{} {
+	response := hook.ToJson()
+	if hook.Token != "" {
+		response["token"] = hook.Token
+		response["path"] = hook.Path()
+	}
+	if includeSecret && hook.SignatureEnabled() {
+		response["secret"] = *hook.Secret
+	}
+	return response
+}
+
+func GetDeployHook(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID int64 `json:"appId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to access this application", "Forbidden")
+		return
+	}
+
+	hook, err := models.GetDeployHookByAppID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get deploy hook", err.Error())
+		return
+	}
+	if hook == nil {
+		handlers.SendResponse(w, http.StatusOK, true, nil, "No deploy hook configured", "")
+		return
+	}
+
+	handlers.SendResponse(w, http.StatusOK, true, deployHookResponse(hook, false), "Deploy hook retrieved successfully", "")
+}
+
+func CreateDeployHook(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID            int64 `json:"appId"`
+		SignatureEnabled bool  `json:"signatureEnabled"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+		return
+	}
+
+	existing, err := models.GetDeployHookByAppID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get deploy hook", err.Error())
+		return
+	}
+	if existing != nil {
+		handlers.SendResponse(w, http.StatusConflict, false, nil, "Deploy hook already exists", "Rotate the existing hook to get a new URL")
+		return
+	}
+
+	hook, err := models.CreateDeployHook(req.AppID, userInfo.ID, req.SignatureEnabled)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to create deploy hook", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "create", "deploy_hook", &hook.ID, map[string]interface{}{
+		"appId":            req.AppID,
+		"signatureEnabled": hook.SignatureEnabled(),
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, deployHookResponse(hook, true), "Deploy hook created successfully", "")
+}
+
+func RotateDeployHook(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID int64 `json:"appId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+		return
+	}
+
+	hook, err := models.GetDeployHookByAppID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get deploy hook", err.Error())
+		return
+	}
+	if hook == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Deploy hook not found", "")
+		return
+	}
+
+	if err := hook.Rotate(); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to rotate deploy hook", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "rotate", "deploy_hook", &hook.ID, map[string]interface{}{
+		"appId":            req.AppID,
+		"signatureEnabled": hook.SignatureEnabled(),
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, deployHookResponse(hook, true), "Deploy hook rotated successfully", "")
+}
+
+func UpdateDeployHook(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID            int64 `json:"appId"`
+		SignatureEnabled bool  `json:"signatureEnabled"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+		return
+	}
+
+	hook, err := models.GetDeployHookByAppID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get deploy hook", err.Error())
+		return
+	}
+	if hook == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Deploy hook not found", "")
+		return
+	}
+
+	wasEnabled := hook.SignatureEnabled()
+	if err := hook.SetSignature(req.SignatureEnabled); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to update deploy hook", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "update", "deploy_hook", &hook.ID, map[string]interface{}{
+		"appId": req.AppID,
+		"before": map[string]interface{}{
+			"signatureEnabled": wasEnabled,
+		},
+		"after": map[string]interface{}{
+			"signatureEnabled": hook.SignatureEnabled(),
+		},
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, deployHookResponse(hook, true), "Deploy hook updated successfully", "")
+}
+
+func DeleteDeployHook(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID int64 `json:"appId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+		return
+	}
+
+	hook, err := models.GetDeployHookByAppID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get deploy hook", err.Error())
+		return
+	}
+	if hook == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Deploy hook not found", "")
+		return
+	}
+
+	if err := models.DeleteDeployHook(hook.ID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to delete deploy hook", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "delete", "deploy_hook", &hook.ID, map[string]interface{}{
+		"appId": req.AppID,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, nil, "Deploy hook deleted successfully", "")
+}
@@ -0,0 +1,166 @@
+package applications
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
+	"github.com/rs/zerolog/log"
+)
+
+// serves a certificate from the customer's own ca instead of let's encrypt
+func UploadDomainCertificate(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		ID          int64  `json:"id"`
+		Certificate string `json:"certificate"`
+		PrivateKey  string `json:"privateKey"`
+		Chain       string `json:"chain"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.ID == 0 || req.Certificate == "" || req.PrivateKey == "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "ID, certificate and private key are required", "Missing fields")
+		return
+	}
+
+	domain, ok := domainForUser(w, userInfo.ID, req.ID)
+	if !ok {
+		return
+	}
+
+	info, err := traefik.ParseCertificate(domain.Domain, req.Certificate, req.PrivateKey, req.Chain)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid certificate", err.Error())
+		return
+	}
+
+	certPath, keyPath := traefik.CertificatePaths(domain.ID)
+	err = models.SetDomainCertificate(domain.ID, models.CustomCertificate{
+		Certificate:     info.Bundle,
+		Key:             info.Key,
+		CertificatePath: certPath,
+		KeyPath:         keyPath,
+		Issuer:          info.Issuer,
+		IssuedAt:        info.IssuedAt,
+		ExpiresAt:       info.ExpiresAt,
+	})
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to save certificate", err.Error())
+		return
+	}
+
+	if err := traefik.RenderApp(domain.AppID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Certificate saved but routing could not be updated", err.Error())
+		return
+	}
+
+	updatedDomain, err := models.GetDomainByID(domain.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to retrieve updated domain", err.Error())
+		return
+	}
+
+	// the key never goes into the audit log
+	models.LogUserAudit(userInfo.ID, "upload_certificate", "domain", &domain.ID, map[string]interface{}{
+		"appId":       domain.AppID,
+		"domain":      domain.Domain,
+		"issuer":      info.Issuer,
+		"expiresAt":   info.ExpiresAt,
+		"fingerprint": info.Fingerprint,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, map[string]interface{}{
+		"domain":      updatedDomain,
+		"certificate": info,
+	}, "Certificate uploaded successfully", "")
+}
+
+// drops the uploaded certificate, traefik requests one from let's encrypt again
+func RemoveDomainCertificate(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.ID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "ID is required", "Missing fields")
+		return
+	}
+
+	domain, ok := domainForUser(w, userInfo.ID, req.ID)
+	if !ok {
+		return
+	}
+	if domain.SslProvider != models.SSLProviderCustom {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Domain has no uploaded certificate", "Not a custom certificate")
+		return
+	}
+
+	if err := models.ClearDomainCertificate(domain.ID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to remove certificate", err.Error())
+		return
+	}
+	if err := traefik.RenderApp(domain.AppID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Certificate removed but routing could not be updated", err.Error())
+		return
+	}
+	// only after the routing stopped pointing at the files
+	if err := traefik.RemoveCertificate(domain.ID); err != nil {
+		log.Warn().Err(err).Int64("domain_id", domain.ID).Msg("Failed to remove certificate files")
+	}
+
+	updatedDomain, err := models.GetDomainByID(domain.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to retrieve updated domain", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "remove_certificate", "domain", &domain.ID, map[string]interface{}{
+		"appId":  domain.AppID,
+		"domain": domain.Domain,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, updatedDomain, "Certificate removed successfully", "")
+}
+
+func domainForUser(w http.ResponseWriter, userID, domainID int64) (*models.Domain, bool) {
+	domain, err := models.GetDomainByID(domainID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Domain not found", err.Error())
+		return nil, false
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userID, domain.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return nil, false
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+		return nil, false
+	}
+	return domain, true
+}
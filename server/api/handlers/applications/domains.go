@@ -2,16 +2,26 @@ package applications
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/corecollectives/mist/api/handlers"
 	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/compose"
 	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
 	"github.com/corecollectives/mist/utils"
+	"github.com/rs/zerolog/log"
 )
 
+// browsers cap HSTS at two years anyway
+const maxHstsMaxAge = 2 * 365 * 24 * 60 * 60
+
+// requests per second, anything above is better handled by the app itself
+const maxRateLimit = 10000
+
 func CreateDomain(w http.ResponseWriter, r *http.Request) {
 	userInfo, ok := middleware.GetUser(r)
 	if !ok {
@@ -20,8 +30,13 @@ func CreateDomain(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		AppID  int64  `json:"appId"`
-		Domain string `json:"domain"`
+		AppID          int64   `json:"appId"`
+		Domain         string  `json:"domain"`
+		ComposeService *string `json:"composeService"`
+		ComposePort    *int    `json:"composePort"`
+		PathPrefix     string  `json:"pathPrefix"`
+		StripPrefix    bool    `json:"stripPrefix"`
+		Priority       int     `json:"priority"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -44,21 +59,78 @@ func CreateDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	domain, err := models.CreateDomain(req.AppID, strings.TrimSpace(req.Domain))
+	composeService, composePort, errMsg := validateComposeTarget(req.AppID, 0, req.ComposeService, req.ComposePort)
+	if errMsg != "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid compose target", errMsg)
+		return
+	}
+
+	if err := traefik.ValidateHostname(strings.TrimSpace(req.Domain)); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid domain", err.Error())
+		return
+	}
+	if msg := checkWildcardHost(strings.TrimSpace(req.Domain)); msg != "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid domain", msg)
+		return
+	}
+
+	pathPrefix, err := traefik.NormalizePathPrefix(req.PathPrefix)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid path prefix", err.Error())
+		return
+	}
+	route := models.DomainRoute{
+		PathPrefix:  pathPrefix,
+		StripPrefix: req.StripPrefix && pathPrefix != "",
+		Priority:    req.Priority,
+	}
+	candidate := models.Domain{
+		AppID:       req.AppID,
+		Domain:      strings.TrimSpace(req.Domain),
+		PathPrefix:  route.PathPrefix,
+		StripPrefix: route.StripPrefix,
+		Priority:    route.Priority,
+	}
+	if err := traefik.ValidateRoute(candidate); err != nil {
+		handlers.SendResponse(w, http.StatusConflict, false, nil, "Route conflicts with an existing domain", err.Error())
+		return
+	}
+	if msg, err := checkHostProject(req.AppID, candidate.Domain); msg != "" {
+		handlers.SendResponse(w, http.StatusConflict, false, nil, msg, errString(err))
+		return
+	}
+
+	domain, err := models.CreateDomainRoute(req.AppID, strings.TrimSpace(req.Domain), route)
 	if err != nil {
 		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to create domain", err.Error())
 		return
 	}
+	if composeService != nil || composePort != nil {
+		if err := models.UpdateDomainComposeTarget(domain.ID, composeService, composePort); err != nil {
+			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to set compose target", err.Error())
+			return
+		}
+		domain.ComposeService = composeService
+		domain.ComposePort = composePort
+	}
+	if _, err := traefik.AutoVerifyOwnership(domain); err != nil {
+		log.Warn().Err(err).Int64("domain_id", domain.ID).Msg("Failed to check domain ownership")
+	}
 
 	models.LogUserAudit(userInfo.ID, "create", "domain", &domain.ID, map[string]interface{}{
-		"appId":  req.AppID,
-		"domain": domain.Domain,
+		"appId":          req.AppID,
+		"domain":         domain.Domain,
+		"composeService": composeService,
+		"composePort":    composePort,
+		"pathPrefix":     route.PathPrefix,
+		"stripPrefix":    route.StripPrefix,
+		"priority":       route.Priority,
 	})
 
-	response := map[string]interface{}{
-		"domain":         domain,
-		"actionRequired": "restart",
-		"actionMessage":  "Domain changes require restarting the container to take effect. Would you like to restart now?",
+	response := domainChangeResponse(req.AppID)
+	response["domain"] = domain
+	if !domain.OwnershipVerified {
+		response["ownership"] = ownershipInstructions(domain)
 	}
 	handlers.SendResponse(w, http.StatusOK, true, response, "Domain created successfully", "")
 }
@@ -103,6 +175,50 @@ func GetDomains(w http.ResponseWriter, r *http.Request) {
 	handlers.SendResponse(w, http.StatusOK, true, domains, "Domains retrieved successfully", "")
 }
 
+// the app's generated traefik file, exactly as the file provider reads it
+func GetDomainRouting(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID int64 `json:"appId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to access this application", "Forbidden")
+		return
+	}
+
+	config, err := traefik.ReadAppConfig(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to read routing config", err.Error())
+		return
+	}
+
+	handlers.SendResponse(w, http.StatusOK, true, map[string]interface{}{
+		"path":   traefik.ConfigPath(req.AppID),
+		"config": config,
+	}, "Routing config retrieved successfully", "")
+}
+
 func UpdateDomain(w http.ResponseWriter, r *http.Request) {
 	userInfo, ok := middleware.GetUser(r)
 	if !ok {
@@ -111,8 +227,13 @@ func UpdateDomain(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		ID     int64  `json:"id"`
-		Domain string `json:"domain"`
+		ID             int64   `json:"id"`
+		Domain         string  `json:"domain"`
+		ComposeService *string `json:"composeService"`
+		ComposePort    *int    `json:"composePort"`
+		PathPrefix     *string `json:"pathPrefix"`
+		StripPrefix    *bool   `json:"stripPrefix"`
+		Priority       *int    `json:"priority"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -124,6 +245,14 @@ func UpdateDomain(w http.ResponseWriter, r *http.Request) {
 		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "ID and domain are required", "Missing fields")
 		return
 	}
+	if err := traefik.ValidateHostname(strings.TrimSpace(req.Domain)); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid domain", err.Error())
+		return
+	}
+	if msg := checkWildcardHost(strings.TrimSpace(req.Domain)); msg != "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid domain", msg)
+		return
+	}
 
 	domain, err := models.GetDomainByID(req.ID)
 	if err != nil {
@@ -143,32 +272,130 @@ func UpdateDomain(w http.ResponseWriter, r *http.Request) {
 
 	oldDomain := domain.Domain
 
+	// the compose target is only touched when one of its fields is sent
+	composeTargetChanged := req.ComposeService != nil || req.ComposePort != nil
+	var composeService *string
+	var composePort *int
+	if composeTargetChanged {
+		service := domain.ComposeService
+		if req.ComposeService != nil {
+			service = req.ComposeService
+		}
+		port := domain.ComposePort
+		if req.ComposePort != nil {
+			port = req.ComposePort
+		}
+		var errMsg string
+		composeService, composePort, errMsg = validateComposeTarget(domain.AppID, domain.ID, service, port)
+		if errMsg != "" {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid compose target", errMsg)
+			return
+		}
+	}
+
+	// the route is only touched when one of its fields is sent
+	routeChanged := req.PathPrefix != nil || req.StripPrefix != nil || req.Priority != nil
+	route := models.DomainRoute{
+		PathPrefix:  domain.PathPrefix,
+		StripPrefix: domain.StripPrefix,
+		Priority:    domain.Priority,
+	}
+	if req.PathPrefix != nil {
+		route.PathPrefix, err = traefik.NormalizePathPrefix(*req.PathPrefix)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid path prefix", err.Error())
+			return
+		}
+	}
+	if req.StripPrefix != nil {
+		route.StripPrefix = *req.StripPrefix
+	}
+	if req.Priority != nil {
+		route.Priority = *req.Priority
+	}
+	route.StripPrefix = route.StripPrefix && route.PathPrefix != ""
+
+	candidate := *domain
+	candidate.Domain = strings.TrimSpace(req.Domain)
+	candidate.PathPrefix = route.PathPrefix
+	candidate.StripPrefix = route.StripPrefix
+	candidate.Priority = route.Priority
+	if err := traefik.ValidateRoute(candidate); err != nil {
+		handlers.SendResponse(w, http.StatusConflict, false, nil, "Route conflicts with an existing domain", err.Error())
+		return
+	}
+
+	hostChanged := !strings.EqualFold(oldDomain, candidate.Domain)
+	if hostChanged {
+		if msg, err := checkHostProject(domain.AppID, candidate.Domain); msg != "" {
+			handlers.SendResponse(w, http.StatusConflict, false, nil, msg, errString(err))
+			return
+		}
+	}
+
+	// an uploaded certificate is only valid for the names it was issued for
+	if domain.SslProvider == models.SSLProviderCustom && domain.CertificateData != nil && domain.KeyData != nil &&
+		!strings.EqualFold(oldDomain, strings.TrimSpace(req.Domain)) {
+		if _, err := traefik.ParseCertificate(req.Domain, *domain.CertificateData, *domain.KeyData, ""); err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "The uploaded certificate can't be used for the new domain, remove or replace it first", err.Error())
+			return
+		}
+	}
+
 	err = models.UpdateDomain(req.ID, strings.TrimSpace(req.Domain))
 	if err != nil {
 		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to update domain", err.Error())
 		return
 	}
+	if composeTargetChanged {
+		if err := models.UpdateDomainComposeTarget(req.ID, composeService, composePort); err != nil {
+			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to set compose target", err.Error())
+			return
+		}
+	}
+	if routeChanged {
+		if err := models.UpdateDomainRoute(req.ID, route); err != nil {
+			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to set route", err.Error())
+			return
+		}
+	}
 
 	updatedDomain, err := models.GetDomainByID(req.ID)
 	if err != nil {
 		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to retrieve updated domain", err.Error())
 		return
 	}
+	// a new host has to be proven again, unless the project owns it already
+	if hostChanged {
+		if _, err := traefik.AutoVerifyOwnership(updatedDomain); err != nil {
+			log.Warn().Err(err).Int64("domain_id", req.ID).Msg("Failed to check domain ownership")
+		}
+	}
 
 	models.LogUserAudit(userInfo.ID, "update", "domain", &req.ID, map[string]interface{}{
 		"appId": domain.AppID,
 		"before": map[string]interface{}{
-			"domain": oldDomain,
+			"domain":         oldDomain,
+			"composeService": domain.ComposeService,
+			"composePort":    domain.ComposePort,
+			"pathPrefix":     domain.PathPrefix,
+			"stripPrefix":    domain.StripPrefix,
+			"priority":       domain.Priority,
 		},
 		"after": map[string]interface{}{
-			"domain": strings.TrimSpace(req.Domain),
+			"domain":         strings.TrimSpace(req.Domain),
+			"composeService": updatedDomain.ComposeService,
+			"composePort":    updatedDomain.ComposePort,
+			"pathPrefix":     updatedDomain.PathPrefix,
+			"stripPrefix":    updatedDomain.StripPrefix,
+			"priority":       updatedDomain.Priority,
 		},
 	})
 
-	response := map[string]interface{}{
-		"domain":         updatedDomain,
-		"actionRequired": "restart",
-		"actionMessage":  "Domain changes require restarting the container to take effect. Would you like to restart now?",
+	response := domainChangeResponse(domain.AppID)
+	response["domain"] = updatedDomain
+	if !updatedDomain.OwnershipVerified {
+		response["ownership"] = ownershipInstructions(updatedDomain)
 	}
 	handlers.SendResponse(w, http.StatusOK, true, response, "Domain updated successfully", "")
 }
@@ -221,13 +448,306 @@ func DeleteDomain(w http.ResponseWriter, r *http.Request) {
 		"domain": domain.Domain,
 	})
 
-	response := map[string]interface{}{
-		"actionRequired": "restart",
-		"actionMessage":  "Domain changes require restarting the container to take effect. Would you like to restart now?",
+	response := domainChangeResponse(domain.AppID)
+	if err := traefik.RemoveCertificate(req.ID); err != nil {
+		log.Warn().Err(err).Int64("domain_id", req.ID).Msg("Failed to remove certificate files")
 	}
 	handlers.SendResponse(w, http.StatusOK, true, response, "Domain deleted successfully", "")
 }
 
+// wildcard certificates are only issued over dns-01, without it traefik can't serve the host
+func checkWildcardHost(host string) string {
+	if !strings.HasPrefix(host, "*.") {
+		return ""
+	}
+	dns, err := models.GetDNSChallengeSettings()
+	if err != nil {
+		return err.Error()
+	}
+	if !dns.Enabled {
+		return "Wildcard domains need the DNS challenge to be configured in the system settings"
+	}
+	return ""
+}
+
+// an empty service clears the target, returns an error message when the target is invalid
+func validateComposeTarget(appID, domainID int64, service *string, port *int) (*string, *int, string) {
+	if service != nil {
+		trimmed := strings.TrimSpace(*service)
+		service = &trimmed
+		if trimmed == "" {
+			service = nil
+		}
+	}
+	if port != nil && *port == 0 {
+		port = nil
+	}
+	if service == nil && port == nil {
+		return nil, nil, ""
+	}
+
+	app, err := models.GetApplicationByID(appID)
+	if err != nil {
+		return nil, nil, err.Error()
+	}
+	if app.AppType != models.AppTypeCompose {
+		return nil, nil, "Compose service and port can only be set for compose apps"
+	}
+	if service == nil {
+		return nil, nil, "A compose service is required when setting a port"
+	}
+	if port != nil && (*port < 1 || *port > 65535) {
+		return nil, nil, "Port must be between 1 and 65535"
+	}
+
+	domains, err := models.GetDomainsByAppID(appID)
+	if err != nil {
+		return nil, nil, err.Error()
+	}
+	var routed []string
+	for _, d := range domains {
+		// the domain being updated may be the one moving off the clashing name
+		if d.ID != domainID && d.ComposeService != nil {
+			routed = append(routed, *d.ComposeService)
+		}
+	}
+	if other := compose.ConflictingServiceName(*service, routed); other != "" {
+		return nil, nil, fmt.Sprintf("Service %q clashes with the already routed service %q, names that only differ in punctuation or case can't both be routed", *service, other)
+	}
+	return service, port, ""
+}
+
+// routing lives in per-app files traefik watches, so domain changes apply right away without
+// touching containers. only a compose service that isn't attached to traefik-net yet needs a deployment
+func domainChangeResponse(appID int64) map[string]interface{} {
+	if err := traefik.RenderApp(appID); err != nil {
+		log.Error().Err(err).Int64("app_id", appID).Msg("Failed to update app routing")
+		return map[string]interface{}{
+			"actionRequired": "redeploy",
+			"actionMessage":  "Routing could not be updated, a redeployment regenerates it. Would you like to redeploy now?",
+		}
+	}
+
+	app, err := models.GetApplicationByID(appID)
+	if err == nil && app.AppType == models.AppTypeCompose {
+		domains, err := models.GetDomainsByAppID(appID)
+		if err == nil && compose.NeedsOverrideUpdate(app, composeAppPath(app), domains) {
+			return map[string]interface{}{
+				"actionRequired": "redeploy",
+				"actionMessage":  "The selected service isn't connected to the proxy yet, this happens on the next deployment. Would you like to redeploy now?",
+			}
+		}
+	}
+	return map[string]interface{}{}
+}
+
+// a host belongs to the first project that adds it, other projects can't route it even before it's verified
+func checkHostProject(appID int64, host string) (string, error) {
+	app, err := models.GetApplicationByID(appID)
+	if err != nil {
+		return "Failed to get application", err
+	}
+	used, err := models.HostUsedByOtherProject(host, app.ProjectID)
+	if err != nil {
+		return "Failed to check domain", err
+	}
+	if used {
+		return "Domain is already used by another project", nil
+	}
+	return "", nil
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// either of the two proofs is enough, the domain isn't routed until one of them is found
+func ownershipInstructions(d *models.Domain) map[string]interface{} {
+	instructions := map[string]interface{}{
+		"verified": d.OwnershipVerified,
+		"method":   d.VerificationMethod,
+		"txt": map[string]string{
+			"type":  "TXT",
+			"name":  utils.OwnershipTXTName(d.Domain),
+			"value": utils.OwnershipTXTValue + d.VerificationToken,
+		},
+	}
+	// a file can't be served on every name of a wildcard
+	if !strings.Contains(d.Domain, "*") {
+		instructions["http"] = map[string]string{
+			"url":  "http://" + d.Domain + utils.OwnershipHTTPPath,
+			"body": d.VerificationToken,
+		}
+	}
+	return instructions
+}
+
+// https redirect, hsts and www redirect settings of a single domain, fields that aren't sent are kept
+func UpdateDomainSettings(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		ID                int64                 `json:"id"`
+		ForceHttps        *bool                 `json:"forceHttps"`
+		HstsEnabled       *bool                 `json:"hstsEnabled"`
+		HstsMaxAge        *int                  `json:"hstsMaxAge"`
+		RedirectWww       *bool                 `json:"redirectWww"`
+		RedirectWwwToRoot *bool                 `json:"redirectWwwToRoot"`
+		AcmeChallengeType *string               `json:"acmeChallengeType"`
+		RateLimitAverage  *int                  `json:"rateLimitAverage"`
+		RateLimitBurst    *int                  `json:"rateLimitBurst"`
+		Headers           *models.DomainHeaders `json:"headers"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.ID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "ID is required", "Missing fields")
+		return
+	}
+
+	domain, err := models.GetDomainByID(req.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get domain", err.Error())
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, domain.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+		return
+	}
+
+	before := models.DomainRoutingSettings{
+		ForceHttps:        domain.ForceHttps,
+		HstsEnabled:       domain.HstsEnabled,
+		HstsMaxAge:        domain.HstsMaxAge,
+		RedirectWww:       domain.RedirectWww,
+		RedirectWwwToRoot: domain.RedirectWwwToRoot,
+		AcmeChallengeType: domain.AcmeChallengeType,
+		RateLimitAverage:  domain.RateLimitAverage,
+		RateLimitBurst:    domain.RateLimitBurst,
+		Headers:           domain.Headers,
+	}
+	after := before
+	if req.ForceHttps != nil {
+		after.ForceHttps = *req.ForceHttps
+	}
+	if req.HstsEnabled != nil {
+		after.HstsEnabled = *req.HstsEnabled
+	}
+	if req.HstsMaxAge != nil {
+		after.HstsMaxAge = *req.HstsMaxAge
+	}
+	if req.RedirectWww != nil {
+		after.RedirectWww = *req.RedirectWww
+	}
+	if req.RedirectWwwToRoot != nil {
+		after.RedirectWwwToRoot = *req.RedirectWwwToRoot
+	}
+
+	if req.AcmeChallengeType != nil {
+		challenge, err := models.ParseAcmeChallengeType(*req.AcmeChallengeType)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid challenge type", err.Error())
+			return
+		}
+		if challenge == models.AcmeChallengeTypeDns01 {
+			dns, err := models.GetDNSChallengeSettings()
+			if err != nil {
+				handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to load DNS challenge settings", err.Error())
+				return
+			}
+			if !dns.Enabled {
+				handlers.SendResponse(w, http.StatusBadRequest, false, nil, "DNS challenge is not configured", "Configure a DNS provider in the system settings first")
+				return
+			}
+		}
+		after.AcmeChallengeType = challenge
+	}
+
+	if req.RateLimitAverage != nil {
+		after.RateLimitAverage = *req.RateLimitAverage
+	}
+	if req.RateLimitBurst != nil {
+		after.RateLimitBurst = *req.RateLimitBurst
+	}
+	if req.Headers != nil {
+		headers, err := traefik.NormalizeHeaders(*req.Headers)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid headers", err.Error())
+			return
+		}
+		after.Headers = headers
+	}
+
+	if after.RateLimitAverage < 0 || after.RateLimitAverage > maxRateLimit || after.RateLimitBurst < 0 || after.RateLimitBurst > maxRateLimit {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid rate limit", fmt.Sprintf("Average and burst must be between 0 and %d", maxRateLimit))
+		return
+	}
+	// a burst below the average would cap every second at the burst
+	if after.RateLimitAverage == 0 {
+		after.RateLimitBurst = 0
+	} else if after.RateLimitBurst < after.RateLimitAverage {
+		after.RateLimitBurst = after.RateLimitAverage
+	}
+
+	if after.HstsMaxAge < 0 || after.HstsMaxAge > maxHstsMaxAge {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid HSTS max age", "Max age must be between 0 and 2 years in seconds")
+		return
+	}
+	if after.RedirectWww && strings.Contains(domain.Domain, "*") {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid www redirect", "www redirects are not supported for wildcard domains")
+		return
+	}
+
+	if after.RedirectWww != before.RedirectWww || after.RedirectWwwToRoot != before.RedirectWwwToRoot {
+		candidate := *domain
+		candidate.RedirectWww = after.RedirectWww
+		candidate.RedirectWwwToRoot = after.RedirectWwwToRoot
+		if err := traefik.ValidateRoute(candidate); err != nil {
+			handlers.SendResponse(w, http.StatusConflict, false, nil, "www redirect conflicts with an existing domain", err.Error())
+			return
+		}
+	}
+
+	if err := models.UpdateDomainRoutingSettings(req.ID, after); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to update domain settings", err.Error())
+		return
+	}
+
+	updatedDomain, err := models.GetDomainByID(req.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to retrieve updated domain", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "update", "domain", &req.ID, map[string]interface{}{
+		"appId":  domain.AppID,
+		"domain": domain.Domain,
+		"before": before,
+		"after":  after,
+	})
+
+	response := domainChangeResponse(domain.AppID)
+	response["domain"] = updatedDomain
+	handlers.SendResponse(w, http.StatusOK, true, response, "Domain settings updated successfully", "")
+}
+
 func VerifyDomainDNS(w http.ResponseWriter, r *http.Request) {
 	userInfo, ok := middleware.GetUser(r)
 	if !ok {
@@ -278,6 +798,25 @@ func VerifyDomainDNS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// pointing the a record at us only shows where traffic goes, not who owns the domain
+	var ownershipErr *string
+	if !domain.OwnershipVerified {
+		verified, err := traefik.AutoVerifyOwnership(domain)
+		if !verified && err == nil {
+			verified, err = traefik.VerifyOwnership(domain)
+		}
+		if err != nil {
+			errStr := err.Error()
+			ownershipErr = &errStr
+		}
+		if verified {
+			if err := traefik.RenderApp(domain.AppID); err != nil {
+				handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Domain verified but routing could not be updated", err.Error())
+				return
+			}
+		}
+	}
+
 	updatedDomain, err := models.GetDomainByID(req.ID)
 	if err != nil {
 		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to retrieve domain", err.Error())
@@ -285,22 +824,28 @@ func VerifyDomainDNS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	models.LogUserAudit(userInfo.ID, "verify", "domain", &req.ID, map[string]interface{}{
-		"appId":         domain.AppID,
-		"domain":        domain.Domain,
-		"dnsConfigured": valid,
+		"appId":             domain.AppID,
+		"domain":            domain.Domain,
+		"dnsConfigured":     valid,
+		"ownershipVerified": updatedDomain.OwnershipVerified,
 	})
 
 	serverIP, _ := utils.GetServerIP()
 
 	response := map[string]interface{}{
-		"domain":   updatedDomain,
-		"valid":    valid,
-		"serverIP": serverIP,
+		"domain":            updatedDomain,
+		"valid":             valid,
+		"serverIP":          serverIP,
+		"ownershipVerified": updatedDomain.OwnershipVerified,
 	}
 
 	if !valid {
 		response["error"] = errorMsg
 	}
+	if !updatedDomain.OwnershipVerified {
+		response["ownershipError"] = ownershipErr
+		response["ownership"] = ownershipInstructions(updatedDomain)
+	}
 
 	handlers.SendResponse(w, http.StatusOK, true, response, "DNS verification completed", "")
 }
@@ -347,6 +892,11 @@ func GetDNSInstructions(w http.ResponseWriter, r *http.Request) {
 		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get server IP", err.Error())
 		return
 	}
+	// domains from before verification existed have no token yet
+	if err := models.EnsureVerificationToken(domain); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to create verification token", err.Error())
+		return
+	}
 
 	instructions := map[string]interface{}{
 		"domain":   domain.Domain,
@@ -363,6 +913,7 @@ func GetDNSInstructions(w http.ResponseWriter, r *http.Request) {
 				"value": serverIP,
 			},
 		},
+		"ownership": ownershipInstructions(domain),
 	}
 
 	handlers.SendResponse(w, http.StatusOK, true, instructions, "DNS instructions retrieved", "")
@@ -0,0 +1,232 @@
+package applications
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
+)
+
+// custom pages are stored in the database, this keeps a pasted bundle from bloating it
+const maxCustomPageSize = 256 * 1024
+
+const defaultPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%[1]s</title>
+<style>
+body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;font-family:system-ui,sans-serif;background:#0f1115;color:#e6e6e6}
+main{max-width:32rem;padding:2rem;text-align:center}
+h1{font-size:1.5rem;margin:0 0 .75rem}
+p{margin:0;color:#a0a0a0;line-height:1.5}
+</style>
+</head>
+<body>
+<main>
+<h1>%[1]s</h1>
+<p>%[2]s</p>
+</main>
+</body>
+</html>
+`
+
+func defaultMaintenancePage() string {
+	return fmt.Sprintf(defaultPageTemplate, "Down for maintenance", "This site is undergoing maintenance and will be back shortly.")
+}
+
+func defaultErrorPage() string {
+	return fmt.Sprintf(defaultPageTemplate, "Temporarily unavailable", "This site can't be reached right now, please try again in a moment.")
+}
+
+// public, traefik fetches these for the app's visitors while the app is in maintenance or its container is down
+func ServeAppPage(w http.ResponseWriter, r *http.Request) {
+	appID, err := strconv.ParseInt(r.PathValue("appId"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	app, err := models.GetApplicationByID(appID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var page string
+	status := http.StatusServiceUnavailable
+	switch r.PathValue("page") {
+	case "maintenance":
+		page = defaultMaintenancePage()
+		if app.MaintenancePage != nil {
+			page = *app.MaintenancePage
+		}
+		w.Header().Set("Retry-After", "300")
+	case "error":
+		page = defaultErrorPage()
+		if app.ErrorPage != nil {
+			page = *app.ErrorPage
+		}
+		// traefik passes the status the app's route failed with
+		if s, err := strconv.Atoi(r.URL.Query().Get("status")); err == nil && s >= 500 && s <= 599 {
+			status = s
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// the page is user supplied and also reachable on mist's own host, the sandbox keeps it away from mist's origin
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.WriteHeader(status)
+	w.Write([]byte(page))
+}
+
+func GetMaintenanceSettings(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID int64 `json:"appId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	app, err := models.GetApplicationByID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Application not found", err.Error())
+		return
+	}
+	isUserMember, err := models.HasUserAccessToProject(userInfo.ID, app.ProjectID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify access", err.Error())
+		return
+	}
+	if !isUserMember {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have access to this application", "")
+		return
+	}
+
+	handlers.SendResponse(w, http.StatusOK, true, maintenanceResponse(app), "Maintenance settings retrieved successfully", "")
+}
+
+// toggles maintenance mode and replaces the pages, an empty page goes back to the default one
+func UpdateMaintenanceSettings(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID           int64   `json:"appId"`
+		Enabled         *bool   `json:"enabled"`
+		MaintenancePage *string `json:"maintenancePage"`
+		ErrorPage       *string `json:"errorPage"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+	for _, page := range []*string{req.MaintenancePage, req.ErrorPage} {
+		if page != nil && len(*page) > maxCustomPageSize {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Page is too large", fmt.Sprintf("Pages can be at most %d KB", maxCustomPageSize/1024))
+			return
+		}
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+		return
+	}
+
+	app, err := models.GetApplicationByID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Application not found", err.Error())
+		return
+	}
+
+	enabled := app.MaintenanceMode
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	maintenancePage, errorPage := app.MaintenancePage, app.ErrorPage
+	if req.MaintenancePage != nil {
+		maintenancePage = req.MaintenancePage
+	}
+	if req.ErrorPage != nil {
+		errorPage = req.ErrorPage
+	}
+
+	if err := models.UpdateAppMaintenance(app.ID, enabled, maintenancePage, errorPage); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to update maintenance settings", err.Error())
+		return
+	}
+	if err := traefik.RenderApp(app.ID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Settings saved but routing could not be updated", err.Error())
+		return
+	}
+
+	updated, err := models.GetApplicationByID(app.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to retrieve updated settings", err.Error())
+		return
+	}
+
+	// page contents stay out of the audit log, only that they changed
+	models.LogUserAudit(userInfo.ID, "update_maintenance", "application", &app.ID, map[string]interface{}{
+		"before":                 app.MaintenanceMode,
+		"after":                  updated.MaintenanceMode,
+		"maintenancePageChanged": req.MaintenancePage != nil,
+		"errorPageChanged":       req.ErrorPage != nil,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, maintenanceResponse(updated), "Maintenance settings updated successfully", "")
+}
+
+func maintenanceResponse(app *models.App) map[string]interface{} {
+	maintenancePage, errorPage := "", ""
+	if app.MaintenancePage != nil {
+		maintenancePage = *app.MaintenancePage
+	}
+	if app.ErrorPage != nil {
+		errorPage = *app.ErrorPage
+	}
+	return map[string]interface{}{
+		"enabled":                app.MaintenanceMode,
+		"maintenancePage":        maintenancePage,
+		"errorPage":              errorPage,
+		"defaultMaintenancePage": defaultMaintenancePage(),
+		"defaultErrorPage":       defaultErrorPage(),
+		"maintenancePagePath":    traefik.MaintenancePagePath(app.ID),
+		"errorPagePath":          traefik.ErrorPagePath(app.ID),
+		"errorPageStatuses":      traefik.ErrorPageStatuses,
+		"errorPageNote":          "The error page replaces every " + strings.Join(traefik.ErrorPageStatuses, " and ") + " response, including ones the app sends itself",
+	}
+}
@@ -0,0 +1,355 @@
+package applications
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/models"
+)
+
+type appRepositoryRequest struct {
+	ID           int64   `json:"id"`
+	AppID        int64   `json:"appId"`
+	SourceType   *string `json:"sourceType"`
+	SourceID     *int64  `json:"sourceId"`
+	RepoFullName *string `json:"repoFullName"`
+	RepoURL      *string `json:"repoUrl"`
+	Branch       *string `json:"branch"`
+	Path         *string `json:"path"`
+	AutoDeploy   *bool   `json:"autoDeploy"`
+}
+
+// fills in and validates the source of an extra repository, github app repos use the installation
+// owning the repository and always the public github clone url
+func resolveAppRepositorySource(repo *models.AppRepositories, userID int64, projectID int64) (string, bool) {
+	switch repo.SourceType {
+	case models.SourceGithubApp:
+		inst, err := models.GetInstallationForRepo(repo.RepoFullName)
+		if err != nil {
+			return "Invalid repository name", false
+		}
+		if inst == nil {
+			return "No GitHub installation has access to this repository", false
+		}
+		canUse, err := models.CanUserUseInstallation(userID, inst, projectID)
+		if err != nil || !canUse {
+			return "You do not have access to this repository's GitHub installation", false
+		}
+		repo.SourceID = inst.InstallationID
+		// any url sent by the client is ignored, the installation token must not leave github
+		repo.RepoURL = models.GithubRepoCloneURL(repo.RepoFullName)
+	case models.SourceGitProvider:
+		if repo.SourceID == 0 {
+			return "Git provider ID is required", false
+		}
+		provider, err := models.GetGitProviderByID(repo.SourceID)
+		if err != nil || provider.UserID != userID {
+			return "Git provider not found", false
+		}
+		if repo.RepoURL == "" {
+			return "Repository URL is required for git provider repositories", false
+		}
+	default:
+		return "Source type must be github_app or git_provider", false
+	}
+	return "", true
+}
+
+func GetAppRepositories(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID int64 `json:"appId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to access this application", "Forbidden")
+		return
+	}
+
+	repos, err := models.GetAppRepositoriesByAppID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get app repositories", err.Error())
+		return
+	}
+
+	result := make([]map[string]interface{}, 0, len(repos))
+	for i := range repos {
+		result = append(result, repos[i].ToJson())
+	}
+
+	handlers.SendResponse(w, http.StatusOK, true, result, "App repositories retrieved successfully", "")
+}
+
+func CreateAppRepository(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req appRepositoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.AppID == 0 || req.RepoFullName == nil || strings.TrimSpace(*req.RepoFullName) == "" || req.Path == nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID, repository and path are required", "Missing fields")
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+		return
+	}
+
+	repo := &models.AppRepositories{
+		AppID:        req.AppID,
+		SourceType:   models.SourceGithubApp,
+		RepoFullName: strings.TrimSpace(*req.RepoFullName),
+	}
+	if req.SourceType != nil {
+		repo.SourceType = models.AppRepositorySourceType(strings.TrimSpace(*req.SourceType))
+	}
+	if req.SourceID != nil {
+		repo.SourceID = *req.SourceID
+	}
+	if req.RepoURL != nil {
+		repo.RepoURL = strings.TrimSpace(*req.RepoURL)
+	}
+	if req.Branch != nil {
+		repo.Branch = strings.TrimSpace(*req.Branch)
+	}
+	if req.AutoDeploy != nil {
+		repo.AutoDeploy = *req.AutoDeploy
+	}
+
+	repo.Path, err = models.CleanAppRepositoryPath(*req.Path)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid path", err.Error())
+		return
+	}
+
+	app, err := models.GetApplicationByID(repo.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get application", err.Error())
+		return
+	}
+
+	if msg, ok := resolveAppRepositorySource(repo, userInfo.ID, app.ProjectID); !ok {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, msg, "Invalid source")
+		return
+	}
+
+	existing, err := models.GetAppRepositoriesByAppID(req.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get app repositories", err.Error())
+		return
+	}
+	for _, e := range existing {
+		if e.RepoFullName == repo.RepoFullName {
+			handlers.SendResponse(w, http.StatusConflict, false, nil, "Repository is already attached to this app", "")
+			return
+		}
+		if e.Path == repo.Path {
+			handlers.SendResponse(w, http.StatusConflict, false, nil, "Another repository is already cloned into this path", "")
+			return
+		}
+	}
+
+	if err := repo.InsertInDB(); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to add repository", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "create", "app_repository", &repo.ID, map[string]interface{}{
+		"appId":      repo.AppID,
+		"repository": repo.RepoFullName,
+		"branch":     repo.Branch,
+		"path":       repo.Path,
+		"autoDeploy": repo.AutoDeploy,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, repo.ToJson(), "Repository added successfully", "")
+}
+
+func UpdateAppRepository(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req appRepositoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.ID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Repository ID is required", "Missing fields")
+		return
+	}
+
+	repo, err := models.GetAppRepositoryByID(req.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get repository", err.Error())
+		return
+	}
+	if repo == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Repository not found", "")
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, repo.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+		return
+	}
+
+	before := repo.ToJson()
+
+	if req.SourceType != nil {
+		repo.SourceType = models.AppRepositorySourceType(strings.TrimSpace(*req.SourceType))
+	}
+	if req.SourceID != nil {
+		repo.SourceID = *req.SourceID
+	}
+	if req.RepoURL != nil {
+		repo.RepoURL = strings.TrimSpace(*req.RepoURL)
+	}
+	if req.Branch != nil {
+		repo.Branch = strings.TrimSpace(*req.Branch)
+	}
+	if req.AutoDeploy != nil {
+		repo.AutoDeploy = *req.AutoDeploy
+	}
+	if req.Path != nil {
+		repo.Path, err = models.CleanAppRepositoryPath(*req.Path)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid path", err.Error())
+			return
+		}
+		existing, err := models.GetAppRepositoriesByAppID(repo.AppID)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get app repositories", err.Error())
+			return
+		}
+		for _, e := range existing {
+			if e.ID != repo.ID && e.Path == repo.Path {
+				handlers.SendResponse(w, http.StatusConflict, false, nil, "Another repository is already cloned into this path", "")
+				return
+			}
+		}
+	}
+
+	app, err := models.GetApplicationByID(repo.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get application", err.Error())
+		return
+	}
+
+	if msg, ok := resolveAppRepositorySource(repo, userInfo.ID, app.ProjectID); !ok {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, msg, "Invalid source")
+		return
+	}
+
+	if err := repo.Update(); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to update repository", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "update", "app_repository", &repo.ID, map[string]interface{}{
+		"appId":  repo.AppID,
+		"before": before,
+		"after":  repo.ToJson(),
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, repo.ToJson(), "Repository updated successfully", "")
+}
+
+func DeleteAppRepository(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.ID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Repository ID is required", "Missing fields")
+		return
+	}
+
+	repo, err := models.GetAppRepositoryByID(req.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get repository", err.Error())
+		return
+	}
+	if repo == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Repository not found", "")
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(userInfo.ID, repo.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+		return
+	}
+
+	if err := models.DeleteAppRepository(repo.ID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to delete repository", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "delete", "app_repository", &repo.ID, map[string]interface{}{
+		"appId":      repo.AppID,
+		"repository": repo.RepoFullName,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, nil, "Repository removed successfully", "")
+}
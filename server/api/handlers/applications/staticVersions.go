@@ -0,0 +1,156 @@
+package applications
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/staticsite"
+	"github.com/corecollectives/mist/traefik"
+)
+
+// published versions of a static app that can be rolled back to, newest first
+func GetStaticVersions(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID int64 `json:"appId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	app, ok := staticAppForUser(w, userInfo.ID, req.AppID, false)
+	if !ok {
+		return
+	}
+
+	ids, err := staticsite.ListVersions(app.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to list static versions", err.Error())
+		return
+	}
+	current := staticsite.CurrentVersion(app.ID)
+
+	versions := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		version := map[string]interface{}{
+			"deploymentId": id,
+			"isCurrent":    id == current,
+		}
+		// the deployment row may be gone while its files are still around
+		if dep, err := models.GetDeploymentByID(id); err == nil {
+			version["deployment"] = dep.ToJson()
+		}
+		versions = append(versions, version)
+	}
+
+	handlers.SendResponse(w, http.StatusOK, true, versions, "Static versions retrieved successfully", "")
+}
+
+// switches a static app back to one of its kept versions without rebuilding
+func RollbackStaticVersion(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		AppID        int64 `json:"appId"`
+		DeploymentID int64 `json:"deploymentId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+	if req.AppID == 0 || req.DeploymentID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID and deployment ID are required", "Missing fields")
+		return
+	}
+
+	app, ok := staticAppForUser(w, userInfo.ID, req.AppID, true)
+	if !ok {
+		return
+	}
+
+	ids, err := staticsite.ListVersions(app.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to list static versions", err.Error())
+		return
+	}
+	if !slices.Contains(ids, req.DeploymentID) {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Version not found", "This version is no longer kept")
+		return
+	}
+
+	previous := staticsite.CurrentVersion(app.ID)
+	if err := staticsite.Activate(app.ID, req.DeploymentID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to roll back", err.Error())
+		return
+	}
+	if err := traefik.RenderApp(app.ID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to update routing", err.Error())
+		return
+	}
+	if err := models.MarkDeploymentActive(req.DeploymentID, app.ID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to update active deployment", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "rollback", "application", &app.ID, map[string]interface{}{
+		"from_deployment": previous,
+		"to_deployment":   req.DeploymentID,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, map[string]interface{}{
+		"deploymentId": req.DeploymentID,
+	}, "Rolled back successfully", "")
+}
+
+// listing versions only needs project access, changing the live one needs the app's owner
+func staticAppForUser(w http.ResponseWriter, userID, appID int64, modify bool) (*models.App, bool) {
+	app, err := models.GetApplicationByID(appID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Application not found", err.Error())
+		return nil, false
+	}
+	if modify {
+		isApplicationOwner, err := models.IsUserApplicationOwner(userID, appID)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+			return nil, false
+		}
+		if !isApplicationOwner {
+			handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to modify this application", "Forbidden")
+			return nil, false
+		}
+	} else {
+		hasAccess, err := models.HasUserAccessToProject(userID, app.ProjectID)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify project access", err.Error())
+			return nil, false
+		}
+		if !hasAccess {
+			handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have access to this application", "Forbidden")
+			return nil, false
+		}
+	}
+	if app.AppType != models.AppTypeStatic {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Not a static app", "Versions are only kept for static apps")
+		return nil, false
+	}
+	return app, true
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/corecollectives/mist/api/middleware"
 	"github.com/corecollectives/mist/docker"
 	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/utils"
 	"github.com/moby/moby/client"
 )
 
@@ -30,14 +32,21 @@ func UpdateApplication(w http.ResponseWriter, r *http.Request) {
 		GitRepository      *string  `json:"gitRepository"`
 		GitBranch          *string  `json:"gitBranch"`
 		GitCloneURL        *string  `json:"gitCloneUrl"`
+		TriggerType        *string  `json:"triggerType"`
+		TriggerPattern     *string  `json:"triggerPattern"`
 		Port               *int     `json:"port"`
 		ShouldExpose       *bool    `json:"shouldExpose"`
 		ExposePort         *int     `json:"exposePort"`
 		RootDirectory      *string  `json:"rootDirectory"`
+		WatchPaths         []string `json:"watchPaths"`
+		IgnorePaths        []string `json:"ignorePaths"`
 		DockerfilePath     *string  `json:"dockerfilePath"`
 		BuildCommand       *string  `json:"buildCommand"`
 		StartCommand       *string  `json:"startCommand"`
+		BuilderImage       *string  `json:"builderImage"`
+		OutputDirectory    *string  `json:"outputDirectory"`
 		DeploymentStrategy *string  `json:"deploymentStrategy"`
+		SupersedePolicy    *string  `json:"supersedePolicy"`
 		Status             *string  `json:"status"`
 		CPULimit           *float64 `json:"cpuLimit"`
 		MemoryLimit        *int     `json:"memoryLimit"`
@@ -64,6 +73,13 @@ func UpdateApplication(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for _, pattern := range append(append([]string{}, req.WatchPaths...), req.IgnorePaths...) {
+		if err := utils.ValidateGlob(pattern); err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid watch path pattern", err.Error())
+			return
+		}
+	}
+
 	app, err := models.GetApplicationByID(req.AppID)
 	if err != nil {
 		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get application", err.Error())
@@ -86,6 +102,25 @@ func UpdateApplication(w http.ResponseWriter, r *http.Request) {
 	}
 	if req.GitRepository != nil {
 		trimmed := strings.TrimSpace(*req.GitRepository)
+		// repos from a shared installation can only be picked by users it is shared with
+		if trimmed != "" {
+			inst, err := models.GetInstallationForRepo(trimmed)
+			if err != nil {
+				handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid repository", err.Error())
+				return
+			}
+			if inst != nil {
+				canUse, err := models.CanUserUseInstallation(userInfo.ID, inst, app.ProjectID)
+				if err != nil {
+					handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify installation access", err.Error())
+					return
+				}
+				if !canUse {
+					handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have access to this repository's GitHub installation", "Forbidden")
+					return
+				}
+			}
+		}
 		app.GitRepository = &trimmed
 	}
 	if req.GitBranch != nil {
@@ -95,6 +130,28 @@ func UpdateApplication(w http.ResponseWriter, r *http.Request) {
 		trimmed := strings.TrimSpace(*req.GitCloneURL)
 		app.GitCloneURL = &trimmed
 	}
+	if req.TriggerType != nil {
+		app.TriggerType = models.TriggerType(strings.TrimSpace(*req.TriggerType))
+	}
+	if req.TriggerPattern != nil {
+		trimmed := strings.TrimSpace(*req.TriggerPattern)
+		app.TriggerPattern = &trimmed
+	}
+	switch app.TriggerType {
+	case "", models.TriggerBranch:
+	case models.TriggerBranchPattern, models.TriggerTag:
+		if app.TriggerPattern == nil || *app.TriggerPattern == "" {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Trigger pattern is required for pattern and tag triggers", "Missing fields")
+			return
+		}
+		if err := utils.ValidateGlob(*app.TriggerPattern); err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid trigger pattern", err.Error())
+			return
+		}
+	default:
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid trigger type", "Trigger type must be one of branch, branch_pattern or tag")
+		return
+	}
 	if req.Port != nil {
 		port := int64(*req.Port)
 		app.Port = &port
@@ -107,15 +164,53 @@ func UpdateApplication(w http.ResponseWriter, r *http.Request) {
 		app.ExposePort = &exposePort
 	}
 	if req.RootDirectory != nil {
-		app.RootDirectory = strings.TrimSpace(*req.RootDirectory)
+		trimmed := strings.Trim(strings.TrimSpace(*req.RootDirectory), "/")
+		if trimmed != "" && !filepath.IsLocal(filepath.FromSlash(trimmed)) {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid root directory", "Root directory must be a path inside the repository")
+			return
+		}
+		app.RootDirectory = trimmed
+	}
+	// a null/missing list leaves the patterns untouched, an empty list clears them
+	if req.WatchPaths != nil {
+		app.WatchPaths = trimPatterns(req.WatchPaths)
+	}
+	if req.IgnorePaths != nil {
+		app.IgnorePaths = trimPatterns(req.IgnorePaths)
 	}
 	if req.DockerfilePath != nil {
 		trimmed := strings.TrimSpace(*req.DockerfilePath)
 		app.DockerfilePath = &trimmed
 	}
+	if req.BuildCommand != nil {
+		trimmed := strings.TrimSpace(*req.BuildCommand)
+		app.BuildCommand = &trimmed
+	}
+	if req.BuilderImage != nil {
+		trimmed := strings.TrimSpace(*req.BuilderImage)
+		app.BuilderImage = &trimmed
+	}
+	if req.OutputDirectory != nil {
+		trimmed := strings.Trim(strings.TrimSpace(*req.OutputDirectory), "/")
+		if trimmed != "" && !filepath.IsLocal(filepath.FromSlash(trimmed)) {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid output directory", "Output directory must be a path inside the root directory")
+			return
+		}
+		app.OutputDirectory = &trimmed
+	}
 	if req.DeploymentStrategy != nil {
 		app.DeploymentStrategy = models.DeploymentStrategy(strings.TrimSpace(*req.DeploymentStrategy))
 	}
+	if req.SupersedePolicy != nil {
+		policy := models.SupersedePolicy(strings.TrimSpace(*req.SupersedePolicy))
+		switch policy {
+		case models.SupersedeNone, models.SupersedePending, models.SupersedeRunning:
+			app.SupersedePolicy = policy
+		default:
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid supersede policy", "Supersede policy must be one of none, pending or running")
+			return
+		}
+	}
 	if req.Status != nil {
 		app.Status = models.AppStatus(strings.TrimSpace(*req.Status))
 	}
@@ -137,7 +232,8 @@ func UpdateApplication(w http.ResponseWriter, r *http.Request) {
 	}
 
 	redeployRequired := req.RootDirectory != nil || req.DockerfilePath != nil ||
-		req.BuildCommand != nil || req.StartCommand != nil
+		req.BuildCommand != nil || req.StartCommand != nil ||
+		req.BuilderImage != nil || req.OutputDirectory != nil
 
 	restartRequired := req.Port != nil || req.ShouldExpose != nil || req.ExposePort != nil ||
 		req.CPULimit != nil || req.MemoryLimit != nil || req.RestartPolicy != nil
@@ -158,6 +254,12 @@ func UpdateApplication(w http.ResponseWriter, r *http.Request) {
 	if req.GitCloneURL != nil {
 		changes["git_clone_url"] = *req.GitCloneURL
 	}
+	if req.TriggerType != nil {
+		changes["trigger_type"] = *req.TriggerType
+	}
+	if req.TriggerPattern != nil {
+		changes["trigger_pattern"] = *req.TriggerPattern
+	}
 	if req.Port != nil {
 		changes["port"] = *req.Port
 	}
@@ -167,9 +269,18 @@ func UpdateApplication(w http.ResponseWriter, r *http.Request) {
 	if req.ExposePort != nil {
 		changes["exposePort"] = *req.ExposePort
 	}
+	if req.SupersedePolicy != nil {
+		changes["supersede_policy"] = *req.SupersedePolicy
+	}
 	if req.Status != nil {
 		changes["status"] = *req.Status
 	}
+	if req.WatchPaths != nil {
+		changes["watch_paths"] = app.WatchPaths
+	}
+	if req.IgnorePaths != nil {
+		changes["ignore_paths"] = app.IgnorePaths
+	}
 	models.LogUserAudit(userInfo.ID, "update", "application", &app.ID, map[string]interface{}{
 		"changes": changes,
 	})
@@ -186,6 +297,14 @@ func UpdateApplication(w http.ResponseWriter, r *http.Request) {
 	handlers.SendResponse(w, http.StatusOK, true, response, "Application updated successfully", "")
 }
 
+func trimPatterns(patterns []string) []string {
+	trimmed := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		trimmed = append(trimmed, strings.TrimSpace(p))
+	}
+	return trimmed
+}
+
 func recreateContainerAsync(appID int64) error {
 	app, err := models.GetApplicationByID(appID)
 	if err != nil {
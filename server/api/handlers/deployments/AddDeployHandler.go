@@ -6,6 +6,7 @@ import (
 
 	"github.com/corecollectives/mist/api/handlers"
 	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/compose"
 	"github.com/corecollectives/mist/git"
 	"github.com/corecollectives/mist/github"
 	"github.com/corecollectives/mist/models"
@@ -38,7 +39,10 @@ func AddDeployHandler(w http.ResponseWriter, r *http.Request) {
 	var commitHash string
 	var commitMessage string
 
-	if app.AppType != models.AppTypeDatabase {
+	if app.HasInlineCompose() {
+		commitHash = compose.DefinitionHash(*app.ComposeDefinition)
+		commitMessage = "Deploy inline compose definition"
+	} else if app.AppType != models.AppTypeDatabase {
 		userId := int64(user.ID)
 		commit, err := git.GetLatestCommit(int64(req.AppId), userId)
 		if err != nil {
@@ -74,6 +78,9 @@ func AddDeployHandler(w http.ResponseWriter, r *http.Request) {
 		CommitMessage: &commitMessage,
 		Status:        models.DeploymentStatusPending,
 	}
+	if app.HasInlineCompose() {
+		deployment.ComposeDefinition = app.ComposeDefinition
+	}
 	err = deployment.CreateDeployment()
 
 	if err != nil {
@@ -82,8 +89,8 @@ func AddDeployHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// create github deployment
-	if app.GitRepository != nil {
-		depId, err := github.CreateDeployment(*app.GitRepository, app.GitBranch, int(user.ID))
+	if app.GitRepository != nil && deployment.ComposeDefinition == nil {
+		depId, err := github.CreateDeployment(*app.GitRepository, app.GitBranch)
 		if err != nil {
 			log.Err(err).Msg("failed to create github deployment")
 		}
@@ -0,0 +1,222 @@
+package deployments
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/compose"
+	"github.com/corecollectives/mist/git"
+	"github.com/corecollectives/mist/github"
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/queue"
+	"github.com/rs/zerolog/log"
+)
+
+const maxDeployHookBodySize = 1 << 20
+
+type deployHookRequest struct {
+	Commit   string `json:"commit"`
+	ImageTag string `json:"imageTag"`
+	Branch   string `json:"branch"`
+}
+
+// signature format is the same one github uses, `sha256=<hex hmac of the raw body>`
+func verifyDeployHookSignature(payload []byte, signature string, secret string) bool {
+	if len(signature) < 7 || signature[:7] != "sha256=" {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expectedMAC := hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expectedMAC), []byte(signature[7:]))
+}
+
+func isCommitSHA(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// public endpoint for external CI systems, authenticated by the secret token in the url
+// and optionally by an HMAC signature of the body in `X-Mist-Signature-256`
+func DeployHookHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+	if token == "" {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Deploy hook not found", "")
+		return
+	}
+
+	hook, err := models.GetDeployHookByToken(token)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get deploy hook", err.Error())
+		return
+	}
+	if hook == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Deploy hook not found", "")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDeployHookBodySize))
+	if err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Failed to read body", err.Error())
+		return
+	}
+
+	if hook.SignatureEnabled() {
+		if !verifyDeployHookSignature(body, r.Header.Get("X-Mist-Signature-256"), *hook.Secret) {
+			log.Warn().Int64("app_id", hook.AppID).Msg("Invalid deploy hook signature")
+			models.LogWebhookAudit("reject", "deploy_hook", &hook.ID, map[string]interface{}{
+				"app_id":      hook.AppID,
+				"reason":      "invalid signature",
+				"remote_addr": r.RemoteAddr,
+			})
+			handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Invalid signature", "")
+			return
+		}
+	}
+
+	var req deployHookRequest
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", err.Error())
+			return
+		}
+	}
+
+	app, err := models.GetApplicationByID(hook.AppID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "failed to get app details", err.Error())
+		return
+	}
+
+	var commitHash string
+	var commitMessage string
+	var commitAuthor *string
+
+	if app.HasInlineCompose() {
+		if req.Commit != "" || req.Branch != "" || req.ImageTag != "" {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Overrides are not supported for inline compose apps", "")
+			return
+		}
+		commitHash = compose.DefinitionHash(*app.ComposeDefinition)
+		commitMessage = "Deploy hook: inline compose definition"
+	} else if app.AppType == models.AppTypeDatabase {
+		if req.Commit != "" || req.Branch != "" {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Commit and branch overrides are not supported for image based apps", "")
+			return
+		}
+		if req.ImageTag != "" {
+			commitHash = req.ImageTag
+		} else if app.TemplateName != nil {
+			template, err := models.GetServiceTemplateByName(*app.TemplateName)
+			if err == nil && template != nil && template.DockerImageVersion != nil {
+				commitHash = *template.DockerImageVersion
+			} else {
+				commitHash = "latest"
+			}
+		} else {
+			commitHash = "latest"
+		}
+		commitMessage = "Deploy database service"
+	} else {
+		if req.ImageTag != "" {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Image tag override is only supported for image based apps", "")
+			return
+		}
+		if req.Commit != "" {
+			if !isCommitSHA(req.Commit) {
+				handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid commit", "commit must be a full 40 character SHA")
+				return
+			}
+			commitHash = req.Commit
+			commitMessage = "Deploy hook: commit " + req.Commit[:7]
+		} else {
+			commit, err := git.GetLatestCommitOnBranch(app.ID, app.CreatedBy, req.Branch)
+			if err != nil {
+				log.Error().Err(err).Int64("app_id", app.ID).Msg("Error getting latest commit for deploy hook")
+				handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "failed to get latest commit", err.Error())
+				return
+			}
+			commitHash = commit.SHA
+			commitMessage = commit.Message
+			if commit.Author != "" {
+				commitAuthor = &commit.Author
+			}
+		}
+	}
+
+	deployment := models.Deployment{
+		AppID:         app.ID,
+		CommitHash:    commitHash,
+		CommitMessage: &commitMessage,
+		CommitAuthor:  commitAuthor,
+		Status:        models.DeploymentStatusPending,
+	}
+	if app.HasInlineCompose() {
+		deployment.ComposeDefinition = app.ComposeDefinition
+	}
+	if req.Branch != "" {
+		deployment.Branch = &req.Branch
+	}
+	if req.ImageTag != "" {
+		deployment.ImageTag = &req.ImageTag
+	}
+
+	if err := deployment.CreateDeployment(); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "failed to insert deployment", err.Error())
+		return
+	}
+
+	if app.GitRepository != nil && deployment.ComposeDefinition == nil {
+		ref := app.GitBranch
+		if req.Commit != "" {
+			ref = req.Commit
+		} else if req.Branch != "" {
+			ref = req.Branch
+		}
+		depId, err := github.CreateDeployment(*app.GitRepository, ref)
+		if err != nil {
+			log.Err(err).Msg("failed to create github deployment")
+		} else {
+			deployment.GithubDepId = &depId
+			if err := deployment.UpdateDeployment(); err != nil {
+				log.Err(err).Msg("failed to update deployment with GH dep id")
+			}
+		}
+	}
+
+	if err := queue.GetQueue().AddJob(deployment.ID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "failed to add job to queue", err.Error())
+		return
+	}
+
+	if err := hook.MarkUsed(); err != nil {
+		log.Warn().Err(err).Int64("hook_id", hook.ID).Msg("Failed to update deploy hook usage")
+	}
+
+	log.Info().Int64("deployment_id", deployment.ID).Int64("app_id", app.ID).Msg("Deployment queued from deploy hook")
+
+	models.LogWebhookAudit("create", "deployment", &deployment.ID, map[string]interface{}{
+		"app_id":             app.ID,
+		"commit_hash":        deployment.CommitHash,
+		"commit_message":     commitMessage,
+		"branch":             req.Branch,
+		"image_tag":          req.ImageTag,
+		"source":             "deploy_hook",
+		"hook_id":            hook.ID,
+		"signature_verified": hook.SignatureEnabled(),
+		"remote_addr":        r.RemoteAddr,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, deployment.ToJson(), "Deployment queued", "")
+}
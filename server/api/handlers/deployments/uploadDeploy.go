@@ -0,0 +1,156 @@
+package deployments
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/constants"
+	"github.com/corecollectives/mist/fs"
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/queue"
+	"github.com/rs/zerolog/log"
+)
+
+// deploys an uploaded tar.gz or zip instead of the app's git repository,
+// expects a multipart form with `appId` and the `archive` file
+func UploadDeployHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	maxSize := int64(constants.Constants["MaxArchiveSize"].(int))
+	// leave some room for the other form fields and multipart boundaries
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			handlers.SendResponse(w, http.StatusRequestEntityTooLarge, false, nil, fmt.Sprintf("Archive exceeds the %dMB limit", maxSize>>20), err.Error())
+			return
+		}
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid multipart form", err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	appID, err := strconv.ParseInt(r.FormValue("appId"), 10, 64)
+	if err != nil || appID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "App ID is required", "Missing fields")
+		return
+	}
+
+	isApplicationOwner, err := models.IsUserApplicationOwner(user.ID, appID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify application ownership", err.Error())
+		return
+	}
+	if !isApplicationOwner {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have permission to deploy this application", "Forbidden")
+		return
+	}
+	app, err := models.GetApplicationByID(appID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Application not found", err.Error())
+		return
+	}
+	if app.AppType == models.AppTypeDatabase {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Database apps can't be deployed from an archive", "")
+		return
+	}
+
+	file, header, err := r.FormFile("archive")
+	if err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Failed to get archive from request", err.Error())
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxSize {
+		handlers.SendResponse(w, http.StatusRequestEntityTooLarge, false, nil, fmt.Sprintf("Archive exceeds the %dMB limit", maxSize>>20), "")
+		return
+	}
+
+	format := fs.DetectArchiveFormat(file)
+	if format == "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid archive. Only tar.gz and zip are supported", "")
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to read archive", err.Error())
+		return
+	}
+
+	archiveDir := constants.Constants["ArchiveDirPath"].(string)
+	if err := fs.CreateDirIfNotExists(archiveDir, 0o755); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to save archive", err.Error())
+		return
+	}
+	tmp, err := os.CreateTemp(archiveDir, "upload-*")
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to save archive", err.Error())
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), file)
+	tmp.Close()
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to save archive", err.Error())
+		return
+	}
+
+	// the archive is named after the upload, not its checksum, so two deployments of the same
+	// archive don't share a file that the first one removes
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	archiveName := filepath.Base(tmp.Name()) + "." + format
+	archivePath := filepath.Join(archiveDir, archiveName)
+	if err := os.Rename(tmp.Name(), archivePath); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to save archive", err.Error())
+		return
+	}
+
+	commitMessage := "Upload: " + filepath.Base(header.Filename)
+	userID := user.ID
+	deployment := models.Deployment{
+		AppID:         app.ID,
+		CommitHash:    checksum,
+		CommitMessage: &commitMessage,
+		SourceArchive: &archiveName,
+		TriggeredBy:   &userID,
+		Status:        models.DeploymentStatusPending,
+	}
+	if err := deployment.CreateDeployment(); err != nil {
+		os.Remove(archivePath)
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to create deployment", err.Error())
+		return
+	}
+
+	if err := queue.GetQueue().AddJob(deployment.ID); err != nil {
+		os.Remove(archivePath)
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to add job to queue", err.Error())
+		return
+	}
+
+	log.Info().Int64("deployment_id", deployment.ID).Int64("app_id", app.ID).Str("checksum", checksum).Msg("Archive deployment added to queue")
+
+	models.LogUserAudit(user.ID, "create", "deployment", &deployment.ID, map[string]interface{}{
+		"app_id":       app.ID,
+		"source":       "archive",
+		"archive_name": header.Filename,
+		"archive_size": header.Size,
+		"checksum":     checksum,
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, deployment.ToJson(), "Deployment queued", "")
+}
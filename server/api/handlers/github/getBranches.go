@@ -7,6 +7,7 @@ import (
 	"github.com/corecollectives/mist/api/handlers"
 	"github.com/corecollectives/mist/api/middleware"
 	"github.com/corecollectives/mist/github"
+	"github.com/corecollectives/mist/models"
 )
 
 func GetBranches(w http.ResponseWriter, r *http.Request) {
@@ -30,7 +31,26 @@ func GetBranches(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, _, err := github.GetGitHubAccessToken(int(userInfo.ID))
+	var token string
+	inst, err := models.GetInstallationForRepo(req.Repo)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid repository", err.Error())
+		return
+	}
+	if inst != nil {
+		canUse, err := models.CanUserUseInstallation(userInfo.ID, inst, 0)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify installation access", err.Error())
+			return
+		}
+		if !canUse {
+			handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have access to this repository's installation", "Forbidden")
+			return
+		}
+		token, err = models.GetFreshInstallationToken(inst.InstallationID)
+	} else {
+		token, _, err = github.GetGitHubAccessToken(int(userInfo.ID))
+	}
 	if err != nil {
 		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get GitHub access token", err.Error())
 		return
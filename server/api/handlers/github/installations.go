@@ -0,0 +1,123 @@
+package github
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/models"
+)
+
+func GetInstallations(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	installations, err := models.GetAccessibleInstallations(userInfo.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get installations", err.Error())
+		return
+	}
+
+	result := make([]map[string]interface{}, 0, len(installations))
+	for i := range installations {
+		result = append(result, installations[i].ToJson())
+	}
+
+	handlers.SendResponse(w, http.StatusOK, true, result, "Installations retrieved successfully", "")
+}
+
+// shares an installation with a project or the whole instance, only the installing user or an admin can do this
+func UpdateInstallationScope(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	var req struct {
+		InstallationID int64  `json:"installationId"`
+		Scope          string `json:"scope"`
+		ProjectID      *int64 `json:"projectId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.InstallationID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Installation ID is required", "Missing fields")
+		return
+	}
+
+	inst, err := models.GetInstallationByInstallationID(req.InstallationID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get installation", err.Error())
+		return
+	}
+	if inst == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Installation not found", "")
+		return
+	}
+
+	isAdmin := userInfo.Role != "user"
+	if int64(inst.UserID) != userInfo.ID && !isAdmin {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "Only the installing user or an admin can share an installation", "Forbidden")
+		return
+	}
+
+	scope := models.InstallationScope(req.Scope)
+	var projectID *int64
+	switch scope {
+	case models.InstallationScopeUser:
+	case models.InstallationScopeInstance:
+		if !isAdmin {
+			handlers.SendResponse(w, http.StatusForbidden, false, nil, "Only admins can share an installation with the whole instance", "Forbidden")
+			return
+		}
+	case models.InstallationScopeProject:
+		if req.ProjectID == nil || *req.ProjectID == 0 {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Project ID is required for project scope", "Missing fields")
+			return
+		}
+		if !isAdmin {
+			isOwner, err := models.IsUserProjectOwner(userInfo.ID, *req.ProjectID)
+			if err != nil {
+				handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify project ownership", err.Error())
+				return
+			}
+			if !isOwner {
+				handlers.SendResponse(w, http.StatusForbidden, false, nil, "Only the project owner can share an installation with a project", "Forbidden")
+				return
+			}
+		}
+		projectID = req.ProjectID
+	default:
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid scope", "Scope must be one of user, project or instance")
+		return
+	}
+
+	before := map[string]interface{}{
+		"scope":     inst.Scope,
+		"projectId": inst.ProjectID,
+	}
+	if err := inst.SetScope(scope, projectID); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to update installation", err.Error())
+		return
+	}
+
+	models.LogUserAudit(userInfo.ID, "update", "github_installation", &inst.InstallationID, map[string]interface{}{
+		"accountLogin": inst.AccountLogin,
+		"before":       before,
+		"after": map[string]interface{}{
+			"scope":     inst.Scope,
+			"projectId": inst.ProjectID,
+		},
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, inst.ToJson(), "Installation updated successfully", "")
+}
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 
 	"github.com/corecollectives/mist/api/handlers"
 	"github.com/corecollectives/mist/api/middleware"
-	"github.com/corecollectives/mist/github"
+	"github.com/corecollectives/mist/models"
 )
 
 type RepoListResponse struct {
@@ -32,37 +34,50 @@ func GetRepositories(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 
-	token, _, err := github.GetGitHubAccessToken(int(userData.ID))
+	installations, err := models.GetAccessibleInstallations(userData.ID)
 	if err != nil {
-		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "failed to fetch GH installation info", err.Error())
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "failed to fetch GH installations", err.Error())
+		return
 	}
 
-	// token, tokenExpires, appID, err := models.GetInstallationToken(installationID)
-	// if err != nil {
-	// 	handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "failed to fetch installation info", err.Error())
-	// 	return
-	// }
-	//
-	// expiry, _ := time.Parse(time.RFC3339, tokenExpires)
-	// if time.Now().After(expiry) {
-	// 	appJWT, err := github.GenerateGithubJwt(appID)
-	// 	if err != nil {
-	// 		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "failed to generate app jwt", err.Error())
-	// 		return
-	// 	}
-	//
-	// 	newToken, newExpiry, err := regenerateInstallationToken(appJWT, installationID)
-	// 	if err != nil {
-	// 		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "failed to refresh token", err.Error())
-	// 		return
-	// 	}
-	//
-	// 	_ = models.UpdateInstallationToken(int64(installationID), newToken, newExpiry)
-	//
-	// 	token = newToken
-	// }
+	// a single installation can be picked, otherwise repos of every installation the user can use are listed
+	if idStr := r.URL.Query().Get("installationId"); idStr != "" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusBadRequest, false, nil, "invalid installation id", err.Error())
+			return
+		}
+		installations = slices.DeleteFunc(installations, func(i models.GithubInstallation) bool {
+			return i.InstallationID != id
+		})
+		if len(installations) == 0 {
+			handlers.SendResponse(w, http.StatusForbidden, false, nil, "You do not have access to this installation", "Forbidden")
+			return
+		}
+	}
 
 	allRepos := []any{}
+	for _, inst := range installations {
+		token, err := models.GetFreshInstallationToken(inst.InstallationID)
+		if err != nil {
+			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "failed to fetch GH installation token", err.Error())
+			return
+		}
+
+		repos, status, err := listInstallationRepositories(token)
+		if err != nil {
+			handlers.SendResponse(w, status, false, nil, err.Error(), "")
+			return
+		}
+		allRepos = append(allRepos, repos...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(allRepos)
+}
+
+func listInstallationRepositories(token string) ([]any, int, error) {
+	repos := []any{}
 	page := 1
 
 	for {
@@ -73,30 +88,27 @@ func GetRepositories(w http.ResponseWriter, r *http.Request) {
 
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
-			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "request error", err.Error())
-			return
+			return nil, http.StatusInternalServerError, fmt.Errorf("request error: %w", err)
 		}
-		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			handlers.SendResponse(w, resp.StatusCode, false, nil, fmt.Sprintf("GitHub API returned %d", resp.StatusCode), "")
-			return
+			resp.Body.Close()
+			return nil, resp.StatusCode, fmt.Errorf("GitHub API returned %d", resp.StatusCode)
 		}
 
 		var repoList RepoListResponse
-		if err := json.NewDecoder(resp.Body).Decode(&repoList); err != nil {
-			handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "failed to parse GitHub response", err.Error())
-			return
+		err = json.NewDecoder(resp.Body).Decode(&repoList)
+		resp.Body.Close()
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to parse GitHub response: %w", err)
 		}
 
-		allRepos = append(allRepos, repoList.Repositories...)
+		repos = append(repos, repoList.Repositories...)
 
 		if len(repoList.Repositories) < 100 {
 			break // no more pages
 		}
 		page++
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(allRepos)
+	return repos, http.StatusOK, nil
 }
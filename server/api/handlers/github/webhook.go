@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 
@@ -44,64 +45,137 @@ func verifyGitHubSignature(payload []byte, signature string, secret string) bool
 	return hmac.Equal([]byte(expectedMAC), []byte(receivedMAC))
 }
 
+// github caps webhook payloads at 25 MB
+const maxGithubWebhookBodySize = 25 << 20
+
 func GithubWebhook(w http.ResponseWriter, r *http.Request) {
 	log.Info().Msg("Received GitHub webhook")
 
-	eventType := r.Header.Get("X-GitHub-Event")
-	if eventType == "" {
-		http.Error(w, "Missing X-GitHub-Event header", http.StatusBadRequest)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGithubWebhookBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read body", http.StatusInternalServerError)
+	status, message, _ := processGithubWebhook(r.Header, body, nil, nil)
+	if status != http.StatusOK {
+		http.Error(w, message, status)
 		return
 	}
 
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(message))
+}
+
+// stores the delivery and runs it, shared by the webhook endpoint and manual redeliveries so a
+// replayed delivery goes through exactly the same checks as the original one. until the signature
+// is verified only the metadata is stored
+func processGithubWebhook(header http.Header, body []byte, redeliveryOf *int64, triggeredBy *int64) (int, string, *models.WebhookDelivery) {
+	eventType := header.Get("X-GitHub-Event")
+
+	delivery := &models.WebhookDelivery{
+		Source:       "github",
+		Event:        eventType,
+		DeliveryID:   header.Get("X-GitHub-Delivery"),
+		RedeliveryOf: redeliveryOf,
+		TriggeredBy:  triggeredBy,
+	}
+	if err := delivery.InsertInDB(); err != nil {
+		// losing the log entry shouldn't lose the deployment
+		log.Error().Err(err).Msg("Failed to store webhook delivery")
+	}
+
+	finish := func(status models.WebhookDeliveryStatus, errMsg string) {
+		if delivery.ID == 0 {
+			return
+		}
+		if err := delivery.Finish(status, errMsg); err != nil {
+			log.Error().Err(err).Int64("delivery_id", delivery.ID).Msg("Failed to update webhook delivery")
+		}
+	}
+
+	if eventType == "" {
+		finish(models.WebhookDeliveryRejected, "missing X-GitHub-Event header")
+		return http.StatusBadRequest, "Missing X-GitHub-Event header", delivery
+	}
+
 	// Get webhook secret from database
 	settings, err := models.GetSystemSettings()
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get system settings for webhook verification")
-		http.Error(w, "Configuration error", http.StatusInternalServerError)
-		return
+		finish(models.WebhookDeliveryFailed, "failed to get system settings: "+err.Error())
+		return http.StatusInternalServerError, "Configuration error", delivery
 	}
 
-	signature := r.Header.Get("X-Hub-Signature-256")
+	signature := header.Get("X-Hub-Signature-256")
 	if !verifyGitHubSignature(body, signature, settings.GithubWebhookSecret) {
 		log.Warn().Str("event", eventType).Msg("Invalid webhook signature")
-		http.Error(w, "Invalid signature", http.StatusUnauthorized)
-		return
+		finish(models.WebhookDeliveryRejected, "invalid signature")
+		return http.StatusUnauthorized, "Invalid signature", delivery
+	}
+	delivery.SignatureValid = true
+
+	if delivery.ID != 0 {
+		headersJSON, err := json.Marshal(header)
+		if err != nil {
+			headersJSON = []byte("{}")
+		}
+		if err := delivery.StoreContent(string(headersJSON), string(body)); err != nil {
+			log.Error().Err(err).Int64("delivery_id", delivery.ID).Msg("Failed to store webhook payload")
+		}
 	}
 
 	var payload WebhookPayload
 	if err := json.Unmarshal(body, &payload); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
+		finish(models.WebhookDeliveryRejected, "invalid JSON: "+err.Error())
+		return http.StatusBadRequest, "Invalid JSON", delivery
+	}
+	if payload.Repository != nil {
+		delivery.Repository = &payload.Repository.FullName
 	}
 
-	if eventType == "push" {
-		var evt github.PushEvent
-		if err := json.Unmarshal(body, &evt); err != nil {
-			http.Error(w, "Invalid push event payload", http.StatusBadRequest)
-			return
-		}
+	if eventType != "push" {
+		finish(models.WebhookDeliveryIgnored, "")
+		return http.StatusOK, "Webhook received", delivery
+	}
 
-		log.Info().Str("repo", evt.Repository.FullName).Msg("Processing push event")
-		depId, err := github.CreateDeploymentFromGithubPushEvent(evt)
-		if err != nil {
-			log.Error().Err(err).Str("repo", evt.Repository.FullName).Msg("Failed to create deployment from push event")
-			http.Error(w, "Failed to handle push event: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+	var evt github.PushEvent
+	if err := json.Unmarshal(body, &evt); err != nil {
+		finish(models.WebhookDeliveryRejected, "invalid push event payload: "+err.Error())
+		return http.StatusBadRequest, "Invalid push event payload", delivery
+	}
+	delivery.Ref = &evt.Ref
+
+	log.Info().Str("repo", evt.Repository.FullName).Msg("Processing push event")
+	result, err := github.CreateDeploymentFromGithubPushEvent(evt)
+	if result != nil {
+		delivery.AppIDs = result.AppIDs
+	}
+	if err != nil {
+		log.Error().Err(err).Str("repo", evt.Repository.FullName).Msg("Failed to create deployment from push event")
+		finish(models.WebhookDeliveryFailed, err.Error())
+		return http.StatusInternalServerError, "Failed to handle push event: " + err.Error(), delivery
+	}
 
-		if depId != 0 {
-			queue := queue.GetQueue()
-			queue.AddJob(depId)
-			log.Info().Int64("deployment_id", depId).Msg("Deployment queued")
+	queue := queue.GetQueue()
+	for _, depId := range result.DeploymentIDs {
+		if err := queue.AddJob(depId); err != nil {
+			log.Error().Err(err).Int64("deployment_id", depId).Msg("Failed to queue deployment")
+			continue
 		}
+		delivery.DeploymentIDs = append(delivery.DeploymentIDs, depId)
+		log.Info().Int64("deployment_id", depId).Msg("Deployment queued")
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Webhook received"))
+	if len(delivery.DeploymentIDs) == 0 {
+		finish(models.WebhookDeliveryIgnored, "")
+	} else {
+		finish(models.WebhookDeliveryProcessed, "")
+	}
+	return http.StatusOK, "Webhook received", delivery
 }
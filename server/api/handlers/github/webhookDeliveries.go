@@ -0,0 +1,170 @@
+package github
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/models"
+)
+
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	if userInfo.Role == "user" {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "Access denied", "Only admins can view webhook deliveries")
+		return
+	}
+
+	limit := 50
+	offset := 0
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
+			offset = parsedOffset
+		}
+	}
+
+	status := r.URL.Query().Get("status")
+
+	deliveries, err := models.GetWebhookDeliveries(status, limit, offset)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to retrieve webhook deliveries", err.Error())
+		return
+	}
+
+	total, err := models.GetWebhookDeliveriesCount(status)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to get webhook deliveries count", err.Error())
+		return
+	}
+
+	list := make([]map[string]interface{}, 0, len(deliveries))
+	for i := range deliveries {
+		list = append(list, deliveries[i].ToJson())
+	}
+
+	response := map[string]interface{}{
+		"deliveries": list,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	}
+
+	handlers.SendResponse(w, http.StatusOK, true, response, "Webhook deliveries retrieved successfully", "")
+}
+
+func GetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	if userInfo.Role == "user" {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "Access denied", "Only admins can view webhook deliveries")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid delivery ID", err.Error())
+		return
+	}
+
+	delivery, err := models.GetWebhookDeliveryByID(id)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to retrieve webhook delivery", err.Error())
+		return
+	}
+	if delivery == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Webhook delivery not found", "")
+		return
+	}
+
+	response := delivery.ToJson()
+	response["headers"] = json.RawMessage(delivery.Headers)
+	response["payload"] = delivery.Payload
+
+	handlers.SendResponse(w, http.StatusOK, true, response, "Webhook delivery retrieved successfully", "")
+}
+
+func RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+
+	if userInfo.Role == "user" {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, "Access denied", "Only admins can redeliver webhooks")
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	if req.ID == 0 {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Delivery ID is required", "Missing fields")
+		return
+	}
+
+	original, err := models.GetWebhookDeliveryByID(req.ID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to retrieve webhook delivery", err.Error())
+		return
+	}
+	if original == nil {
+		handlers.SendResponse(w, http.StatusNotFound, false, nil, "Webhook delivery not found", "")
+		return
+	}
+	if original.Source != "github" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Redelivery is not supported for this source", original.Source)
+		return
+	}
+
+	// deliveries with an invalid signature were only stored as metadata
+	if original.Payload == "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "This delivery has no stored payload to replay", "")
+		return
+	}
+
+	header := http.Header{}
+	if err := json.Unmarshal([]byte(original.Headers), &header); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Stored headers are corrupted", err.Error())
+		return
+	}
+
+	status, message, delivery := processGithubWebhook(header, []byte(original.Payload), &original.ID, &userInfo.ID)
+
+	models.LogUserAudit(userInfo.ID, "redeliver", "webhook_delivery", &original.ID, map[string]interface{}{
+		"new_delivery_id": delivery.ID,
+		"status":          delivery.Status,
+		"deployment_ids":  delivery.DeploymentIDs,
+	})
+
+	if status != http.StatusOK {
+		handlers.SendResponse(w, status, false, delivery.ToJson(), "Redelivery failed", message)
+		return
+	}
+
+	handlers.SendResponse(w, http.StatusOK, true, delivery.ToJson(), "Webhook redelivered successfully", "")
+}
@@ -0,0 +1,198 @@
+package settings
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/corecollectives/mist/api/handlers"
+	"github.com/corecollectives/mist/api/middleware"
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
+)
+
+// algorithms bind accepts for tsig keys, in the notation lego expects
+var tsigAlgorithms = []string{"hmac-md5.sig-alg.reg.int.", "hmac-sha1.", "hmac-sha224.", "hmac-sha256.", "hmac-sha384.", "hmac-sha512."}
+
+func GetDNSChallengeSettings(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+	if !requireOwner(w, userInfo.ID, "Only owners can view DNS challenge settings") {
+		return
+	}
+
+	settings, err := models.GetDNSChallengeSettings()
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to retrieve DNS challenge settings", err.Error())
+		return
+	}
+
+	handlers.SendResponse(w, http.StatusOK, true, dnsChallengeResponse(settings), "DNS challenge settings retrieved successfully", "")
+}
+
+// configures the rfc2136 provider for dns-01, traefik is recreated with the new resolver
+func UpdateDNSChallengeSettings(w http.ResponseWriter, r *http.Request) {
+	userInfo, ok := middleware.GetUser(r)
+	if !ok {
+		handlers.SendResponse(w, http.StatusUnauthorized, false, nil, "Not logged in", "Unauthorized")
+		return
+	}
+	if !requireOwner(w, userInfo.ID, "Only owners can update DNS challenge settings") {
+		return
+	}
+
+	var req struct {
+		Enabled             *bool   `json:"enabled"`
+		Nameserver          *string `json:"nameserver"`
+		TsigKey             *string `json:"tsigKey"`
+		TsigAlgorithm       *string `json:"tsigAlgorithm"`
+		TsigSecret          *string `json:"tsigSecret"`
+		WildcardCertificate *bool   `json:"wildcardCertificate"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid request body", "Could not parse JSON")
+		return
+	}
+
+	current, err := models.GetDNSChallengeSettings()
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to retrieve current settings", err.Error())
+		return
+	}
+
+	// the secret is never sent back, leaving it out keeps the stored one
+	updated := *current
+	if req.Enabled != nil {
+		updated.Enabled = *req.Enabled
+	}
+	if req.Nameserver != nil {
+		updated.Nameserver = strings.TrimSpace(*req.Nameserver)
+	}
+	if req.TsigKey != nil {
+		updated.TsigKey = strings.TrimSpace(*req.TsigKey)
+	}
+	if req.TsigAlgorithm != nil {
+		updated.TsigAlgorithm = strings.ToLower(strings.TrimSpace(*req.TsigAlgorithm))
+	}
+	if req.TsigSecret != nil {
+		updated.TsigSecret = strings.TrimSpace(*req.TsigSecret)
+	}
+	if req.WildcardCertificate != nil {
+		updated.WildcardCertificate = *req.WildcardCertificate
+	}
+
+	if errMsg := validateDNSChallenge(&updated); errMsg != "" {
+		handlers.SendResponse(w, http.StatusBadRequest, false, nil, "Invalid DNS challenge settings", errMsg)
+		return
+	}
+
+	// traefik is only changed once the settings are known to be valid, and rolled back by
+	// ApplyDNSChallenge when it doesn't start, so nothing is saved that traefik refused
+	if err := traefik.ApplyDNSChallenge(&updated); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to update Traefik, the previous configuration was kept", err.Error())
+		return
+	}
+	if err := models.UpdateDNSChallengeSettings(updated); err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to save DNS challenge settings", err.Error())
+		return
+	}
+	// routers under the wildcard domain switch to the wildcard certificate
+	traefik.RenderAllApps()
+
+	dummyID := int64(1)
+	models.LogUserAudit(userInfo.ID, "update", "system_settings", &dummyID, map[string]any{
+		"dnsChallenge": map[string]any{
+			"enabled":             updated.Enabled,
+			"nameserver":          updated.Nameserver,
+			"tsigKey":             updated.TsigKey,
+			"tsigAlgorithm":       updated.TsigAlgorithm,
+			"tsigSecretChanged":   req.TsigSecret != nil,
+			"wildcardCertificate": updated.WildcardCertificate,
+		},
+	})
+
+	handlers.SendResponse(w, http.StatusOK, true, dnsChallengeResponse(&updated), "DNS challenge settings updated successfully", "")
+}
+
+// returns an error message when the settings can't work, fills in the default port
+func validateDNSChallenge(s *models.DNSChallengeSettings) string {
+	for _, v := range []string{s.Nameserver, s.TsigKey, s.TsigAlgorithm, s.TsigSecret} {
+		if strings.ContainsAny(v, "\r\n") {
+			return "Values can't contain line breaks"
+		}
+	}
+
+	if s.WildcardCertificate {
+		if !s.Enabled {
+			return "The wildcard certificate needs the DNS challenge to be enabled"
+		}
+		settings, err := models.GetSystemSettings()
+		if err != nil || settings.WildcardDomain == nil || *settings.WildcardDomain == "" {
+			return "Set a wildcard domain before requesting a wildcard certificate"
+		}
+	}
+	if !s.Enabled {
+		return ""
+	}
+
+	if s.Nameserver == "" {
+		return "Nameserver is required"
+	}
+	if _, _, err := net.SplitHostPort(s.Nameserver); err != nil {
+		s.Nameserver = net.JoinHostPort(s.Nameserver, "53")
+	}
+	if _, port, err := net.SplitHostPort(s.Nameserver); err != nil || port == "" {
+		return "Nameserver must be a host or host:port"
+	}
+
+	// unsigned updates work against a bind that allows them, a key needs all of its parts though
+	if s.TsigKey == "" && s.TsigSecret == "" {
+		return ""
+	}
+	if s.TsigKey == "" || s.TsigSecret == "" {
+		return "TSIG key name and secret are both required"
+	}
+	if !strings.HasSuffix(s.TsigAlgorithm, ".") {
+		s.TsigAlgorithm += "."
+	}
+	if !slices.Contains(tsigAlgorithms, s.TsigAlgorithm) {
+		return "Unsupported TSIG algorithm, use one of " + strings.Join(tsigAlgorithms, ", ")
+	}
+	if _, err := base64.StdEncoding.DecodeString(s.TsigSecret); err != nil {
+		return "TSIG secret must be base64 encoded"
+	}
+	return ""
+}
+
+func dnsChallengeResponse(s *models.DNSChallengeSettings) map[string]any {
+	return map[string]any{
+		"enabled":             s.Enabled,
+		"provider":            "rfc2136",
+		"nameserver":          s.Nameserver,
+		"tsigKey":             s.TsigKey,
+		"tsigAlgorithm":       s.TsigAlgorithm,
+		"tsigSecretSet":       s.TsigSecret != "",
+		"wildcardCertificate": s.WildcardCertificate,
+		"resolver":            traefik.DNSCertResolver,
+	}
+}
+
+func requireOwner(w http.ResponseWriter, userID int64, msg string) bool {
+	role, err := models.GetUserRole(userID)
+	if err != nil {
+		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to verify user role", err.Error())
+		return false
+	}
+	if role != "owner" {
+		handlers.SendResponse(w, http.StatusForbidden, false, nil, msg, "Forbidden")
+		return false
+	}
+	return true
+}
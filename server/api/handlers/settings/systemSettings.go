@@ -7,6 +7,7 @@ import (
 	"github.com/corecollectives/mist/api/handlers"
 	"github.com/corecollectives/mist/api/middleware"
 	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
 	"github.com/corecollectives/mist/utils"
 )
 
@@ -167,6 +168,10 @@ func UpdateSystemSettings(w http.ResponseWriter, r *http.Request) {
 		handlers.SendResponse(w, http.StatusInternalServerError, false, nil, "Failed to generate Traefik configuration", err.Error())
 		return
 	}
+	if req.WildcardDomain != nil {
+		// routers under the wildcard domain share its certificate
+		traefik.RenderAllApps()
+	}
 
 	dummyID := int64(1)
 	auditData := map[string]any{}
@@ -0,0 +1,45 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/corecollectives/mist/models"
+)
+
+// how long compose gets to clean up after an interrupt before it is killed
+const interruptGracePeriod = 30 * time.Second
+
+// every app gets its own compose project, the directory name compose would pick otherwise is only
+// the app name and collides between projects. apps from before keep the name they were started
+// under, their named volumes are tied to it
+func ProjectName(appID int64) string {
+	if project, err := models.GetAppComposeProject(appID); err == nil && project != "" {
+		return project
+	}
+	return fmt.Sprintf("mist-app-%d", appID)
+}
+
+// builds a `docker compose` command scoped to the app's project. cancelling ctx sends SIGINT first,
+// like ctrl-c would, so compose can stop what it started instead of being killed halfway
+func composeCommand(ctx context.Context, appID int64, appContextPath string, env map[string]string, args ...string) *exec.Cmd {
+	full := []string{"compose", "-p", ProjectName(appID)}
+	full = append(full, composeFileArgs(appContextPath)...)
+	cmd := exec.CommandContext(ctx, "docker", append(full, args...)...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = interruptGracePeriod
+	if env != nil {
+		var envArray []string
+		for k, v := range env {
+			envArray = append(envArray, fmt.Sprintf("%s=%s", k, v))
+		}
+		cmd.Env = envArray
+	}
+	cmd.Dir = appContextPath
+	return cmd
+}
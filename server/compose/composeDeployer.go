@@ -10,6 +10,7 @@ import (
 
 	"github.com/corecollectives/mist/docker"
 	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
 	"github.com/corecollectives/mist/utils"
 	"gorm.io/gorm"
 )
@@ -48,15 +49,83 @@ func DeployComposeApp(ctx context.Context, dep *models.Deployment, app *models.A
 		"appType":          app.AppType,
 	})
 
+	domainRecords, err := models.GetDomainsByAppID(app.ID)
+	if err != nil {
+		logger.Error(err, "Failed to load domains")
+		return fmt.Errorf("get domains failed: %w", err)
+	}
+
+	logger.Info("Validating compose file")
+	project, err := LoadProject(ctx, appContextPath, mergedEnvVars)
+	var warnings []string
+	if err == nil {
+		warnings, err = ValidateProject(project, domainRecords)
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(logfile, "[COMPOSE]: warning: %s\n", warning)
+	}
+	if err != nil {
+		logger.Error(err, "Compose file validation failed")
+		fmt.Fprintf(logfile, "[COMPOSE]: %s\n", err.Error())
+		dep.Status = models.DeploymentStatusFailed
+		dep.Stage = "failed"
+		dep.Progress = 0
+		errMsg := fmt.Sprintf("Compose validation failed: %v", err)
+		dep.ErrorMessage = &errMsg
+		docker.UpdateDeploymentRecord(dep, db)
+		models.UpdateDeploymentStatus(dep.ID, "failed", "failed", 0, &errMsg)
+		docker.UpdateApplicationStatus(app.ID, "error", db)
+		return fmt.Errorf("compose validation failed: %w", err)
+	}
+	logger.InfoWithFields("Compose file is valid", map[string]interface{}{
+		"services": project.ServiceNames(),
+	})
+
+	if err := WriteTraefikOverride(app, appContextPath, domainRecords, logfile); err != nil {
+		logger.Error(err, "Failed to write compose override")
+		dep.Status = models.DeploymentStatusFailed
+		dep.Stage = "failed"
+		dep.Progress = 0
+		errMsg := fmt.Sprintf("Failed to write compose override: %v", err)
+		dep.ErrorMessage = &errMsg
+		docker.UpdateDeploymentRecord(dep, db)
+		models.UpdateDeploymentStatus(dep.ID, "failed", "failed", 0, &errMsg)
+		return fmt.Errorf("write compose override failed: %w", err)
+	}
+
 	dep.Status = models.DeploymentStatusDeploying
 	dep.Stage = "deploying"
 	dep.Progress = 50
 	docker.UpdateDeploymentRecord(dep, db)
 	models.UpdateDeploymentStatus(dep.ID, "deploying", "deploying", 50, nil)
 
+	if err := adoptLegacyProject(ctx, app.ID, appContextPath, logfile); err != nil {
+		logger.Error(err, "Failed to check for an existing compose project (non-fatal)")
+	}
+
+	if dep.NoCache {
+		logger.Info("Running docker compose build without cache")
+		if err := ComposeBuildNoCache(ctx, app.ID, appContextPath, mergedEnvVars, logfile); err != nil {
+			if ctx.Err() == context.Canceled {
+				logger.Info("Compose deployment canceled")
+				return ctx.Err()
+			}
+			logger.Error(err, "Docker compose build failed")
+			dep.Status = models.DeploymentStatusFailed
+			dep.Stage = "failed"
+			dep.Progress = 0
+			errMsg := fmt.Sprintf("Compose build failed: %v", err)
+			dep.ErrorMessage = &errMsg
+			docker.UpdateDeploymentRecord(dep, db)
+			models.UpdateDeploymentStatus(dep.ID, "failed", "failed", 0, &errMsg)
+			docker.UpdateApplicationStatus(app.ID, "error", db)
+			return fmt.Errorf("compose build failed: %w", err)
+		}
+	}
+
 	logger.Info("Running docker compose up")
 
-	err = ComposeUp(appContextPath, mergedEnvVars, logfile)
+	err = ComposeUp(ctx, app.ID, appContextPath, mergedEnvVars, logfile)
 	if err != nil {
 		if ctx.Err() == context.Canceled {
 			logger.Info("Compose deployment canceled")
@@ -76,6 +145,19 @@ func DeployComposeApp(ctx context.Context, dep *models.Deployment, app *models.A
 
 	logger.Info("Docker compose up completed successfully")
 
+	if err := traefik.RenderApp(app.ID); err != nil {
+		logger.Error(err, "Failed to write routing config")
+		dep.Status = models.DeploymentStatusFailed
+		dep.Stage = "failed"
+		dep.Progress = 0
+		errMsg := fmt.Sprintf("Failed to write routing config: %v", err)
+		dep.ErrorMessage = &errMsg
+		docker.UpdateDeploymentRecord(dep, db)
+		models.UpdateDeploymentStatus(dep.ID, "failed", "failed", 0, &errMsg)
+		docker.UpdateApplicationStatus(app.ID, "error", db)
+		return fmt.Errorf("write routing config failed: %w", err)
+	}
+
 	dep.Status = models.DeploymentStatusSuccess
 	dep.Stage = "success"
 	dep.Progress = 100
@@ -83,6 +165,9 @@ func DeployComposeApp(ctx context.Context, dep *models.Deployment, app *models.A
 	dep.FinishedAt = &now
 	docker.UpdateDeploymentRecord(dep, db)
 	models.UpdateDeploymentStatus(dep.ID, "success", "success", 100, nil)
+	if err := models.MarkDeploymentActive(dep.ID, app.ID); err != nil {
+		logger.Error(err, "Failed to mark deployment active (non-fatal)")
+	}
 
 	logger.Info("Updating application status to running")
 	err = docker.UpdateApplicationStatus(app.ID, "running", db)
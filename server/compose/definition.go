@@ -0,0 +1,99 @@
+package compose
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// inline definitions are always written under the name compose looks for first
+const inlineFileName = "compose.yaml"
+
+// identifies an inline definition the way a commit sha identifies a repository deployment
+func DefinitionHash(definition string) string {
+	sum := sha256.Sum256([]byte(definition))
+	return hex.EncodeToString(sum[:])
+}
+
+// puts a deployment's inline definition into the workspace in place of a cloned compose file. the rest
+// of the workspace is left alone, bind mounts like ./data live there between deployments
+func WriteInlineDefinition(appContextPath string, definition string, logFile *os.File) error {
+	if err := os.MkdirAll(appContextPath, 0o755); err != nil {
+		return fmt.Errorf("failed to create workspace: %w", err)
+	}
+	// a compose file left over from a repository would take precedence or confuse `docker compose`
+	for _, name := range composeFileNames {
+		if name == inlineFileName {
+			continue
+		}
+		if err := os.Remove(filepath.Join(appContextPath, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	path := filepath.Join(appContextPath, inlineFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(definition), 0o644); err != nil {
+		return fmt.Errorf("failed to write compose file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write compose file: %w", err)
+	}
+	if logFile != nil {
+		fmt.Fprintf(logFile, "[COMPOSE]: Wrote inline compose definition (sha256 %s)\n", DefinitionHash(definition)[:12])
+	}
+	return nil
+}
+
+// parses a definition before it is saved, so a typo shows up in the settings instead of the next deployment.
+// it is parsed away from the workspace, so files it refers to like env_file, configs or secrets aren't
+// looked at, they only have to exist once it is deployed
+func ValidateDefinition(ctx context.Context, definition string, env map[string]string) (*types.Project, error) {
+	dir, err := os.MkdirTemp("", "mist-compose-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, inlineFileName), []byte(definition), 0o644); err != nil {
+		return nil, err
+	}
+	return loadProject(ctx, dir, env, cli.WithResolvedPaths(false), cli.WithoutEnvironmentResolution)
+}
+
+// line diff between the deployed definition and an edited one, every line is prefixed with "+ ", "- "
+// or "  ". empty when nothing changed
+func DiffDefinitions(deployed, edited string) string {
+	if deployed == edited {
+		return ""
+	}
+	dmp := diffmatchpatch.New()
+	a, b, lines := dmp.DiffLinesToChars(deployed, edited)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(a, b, false), lines)
+
+	var out strings.Builder
+	for _, d := range diffs {
+		prefix := "  "
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			prefix = "+ "
+		case diffmatchpatch.DiffDelete:
+			prefix = "- "
+		}
+		for _, line := range strings.SplitAfter(d.Text, "\n") {
+			if line == "" {
+				continue
+			}
+			out.WriteString(prefix + strings.TrimSuffix(line, "\n") + "\n")
+		}
+	}
+	return out.String()
+}
@@ -1,13 +1,12 @@
 package compose
 
 import (
+	"context"
 	"os"
-	"os/exec"
 )
 
-func ComposeDown(appContextPath string) error {
-	cmd := exec.Command("docker", "compose", "down")
-	cmd.Dir = appContextPath
+func ComposeDown(ctx context.Context, appID int64, appContextPath string, env map[string]string) error {
+	cmd := composeCommand(ctx, appID, appContextPath, env, "down")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
@@ -0,0 +1,155 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/corecollectives/mist/constants"
+	"github.com/corecollectives/mist/models"
+	"github.com/moby/moby/client"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	projectLabel    = "com.docker.compose.project"
+	workingDirLabel = "com.docker.compose.project.working_dir"
+)
+
+// apps deployed before projects were named by app id keep the name compose derived from their
+// directory, but a compose file with a top level `name:` ran under that name instead. when the app's
+// containers belong to such a project it is adopted, so the next `up` reuses its containers
+// and named volumes. containers of any further project are taken down since they would hold on to
+// ports and names. only containers started from this app's directory are touched, another app with
+// the same name in a different project may share the old project name
+func adoptLegacyProject(ctx context.Context, appID int64, appContextPath string, logFile *os.File) error {
+	cli, err := client.New(client.FromEnv)
+	if err != nil {
+		return fmt.Errorf("error creating moby client: %s", err.Error())
+	}
+	defer cli.Close()
+
+	current, containers, err := resolveLegacyProject(ctx, cli, appID, appContextPath)
+	if err != nil {
+		return err
+	}
+	if current != ProjectName(appID) {
+		if err := models.UpdateAppComposeProject(appID, current); err != nil {
+			return fmt.Errorf("failed to store compose project name: %w", err)
+		}
+		fmt.Fprintf(logFile, "[COMPOSE]: Continuing with the existing compose project %q\n", current)
+	}
+
+	for _, c := range containers {
+		project := c.Labels[projectLabel]
+		if project == "" || project == current {
+			continue
+		}
+		fmt.Fprintf(logFile, "[COMPOSE]: Taking down container %s of the old compose project %q, named volumes are kept under that name\n", c.ID[:12], project)
+		if _, err := cli.ContainerRemove(ctx, c.ID, client.ContainerRemoveOptions{Force: true}); err != nil {
+			return fmt.Errorf("failed to remove container of %s: %w", project, err)
+		}
+	}
+	return nil
+}
+
+// picks the project the app should run under from the containers started in its directory. an old
+// project is only adopted when every one of its containers came from this directory and no other
+// app claimed it already, otherwise two apps would share one project. returns the app's containers too
+func resolveLegacyProject(ctx context.Context, cli *client.Client, appID int64, appContextPath string) (string, []container, error) {
+	filterArgs := make(client.Filters)
+	filterArgs.Add("label", workingDirLabel+"="+appContextPath)
+	list, err := cli.ContainerList(ctx, client.ContainerListOptions{
+		All:     true,
+		Filters: filterArgs,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	var containers []container
+	var projects []string
+	for _, c := range list.Items {
+		containers = append(containers, container{ID: c.ID, Labels: c.Labels})
+		project := c.Labels[projectLabel]
+		if project != "" && !slices.Contains(projects, project) {
+			projects = append(projects, project)
+		}
+	}
+
+	current := ProjectName(appID)
+	if len(projects) == 0 || slices.Contains(projects, current) {
+		return current, containers, nil
+	}
+	for _, project := range projects {
+		owned, err := ownsProject(ctx, cli, appID, project, appContextPath)
+		if err != nil {
+			return "", nil, err
+		}
+		if owned {
+			return project, containers, nil
+		}
+	}
+	return current, containers, nil
+}
+
+type container struct {
+	ID     string
+	Labels map[string]string
+}
+
+func ownsProject(ctx context.Context, cli *client.Client, appID int64, project, appContextPath string) (bool, error) {
+	used, err := models.ComposeProjectUsedByOtherApp(project, appID)
+	if err != nil || used {
+		return false, err
+	}
+	filterArgs := make(client.Filters)
+	filterArgs.Add("label", projectLabel+"="+project)
+	list, err := cli.ContainerList(ctx, client.ContainerListOptions{
+		All:     true,
+		Filters: filterArgs,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list containers of %s: %w", project, err)
+	}
+	for _, c := range list.Items {
+		if c.Labels[workingDirLabel] != appContextPath {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// finds the old project of compose apps whose name was shared with another app when projects got
+// stored per app. nothing is taken down here, that waits for the app's next deployment
+func ResolveLegacyProjects() {
+	apps, err := models.GetComposeAppsWithoutProject()
+	if err != nil || len(apps) == 0 {
+		return
+	}
+	cli, err := client.New(client.FromEnv)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to connect to docker to resolve compose projects")
+		return
+	}
+	defer cli.Close()
+
+	ctx := context.Background()
+	for _, app := range apps {
+		appContextPath := filepath.Join(constants.Constants["RootPath"].(string), fmt.Sprintf("projects/%d/apps/%s/%s", app.ProjectID, app.Name, app.RootDirectory))
+		project, _, err := resolveLegacyProject(ctx, cli, app.ID, appContextPath)
+		if err != nil {
+			log.Warn().Err(err).Int64("app_id", app.ID).Msg("Failed to resolve compose project")
+			continue
+		}
+		if project == ProjectName(app.ID) {
+			continue
+		}
+		if err := models.UpdateAppComposeProject(app.ID, project); err != nil {
+			log.Warn().Err(err).Int64("app_id", app.ID).Msg("Failed to store compose project name")
+			continue
+		}
+		log.Info().Int64("app_id", app.ID).Str("project", project).Msg("Kept the existing compose project of the app")
+	}
+}
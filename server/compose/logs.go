@@ -1,14 +1,13 @@
 package compose
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
 )
 
-func GetComposeLogs(appContextPath string, tail int) (string, error) {
+func GetComposeLogs(ctx context.Context, appID int64, appContextPath string, env map[string]string, tail int) (string, error) {
 	tailStr := fmt.Sprintf("%d", tail)
-	cmd := exec.Command("docker", "compose", "logs", "--tail", tailStr)
-	cmd.Dir = appContextPath
+	cmd := composeCommand(ctx, appID, appContextPath, env, "logs", "--tail", tailStr)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
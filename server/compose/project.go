@@ -0,0 +1,177 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/corecollectives/mist/models"
+)
+
+// parses the user's compose file the same way `docker compose` would, the mist override is left out since it
+// only adds labels and networks. env is what mist passes to compose so interpolation matches the real run
+func LoadProject(ctx context.Context, appContextPath string, env map[string]string) (*types.Project, error) {
+	return loadProject(ctx, appContextPath, env)
+}
+
+func loadProject(ctx context.Context, appContextPath string, env map[string]string, extra ...cli.ProjectOptionsFn) (*types.Project, error) {
+	names, err := composeFiles(appContextPath, false)
+	if err != nil {
+		return nil, err
+	}
+	// the repo's override is validated together with its compose file, like compose itself loads them
+	var files []string
+	for _, name := range names {
+		files = append(files, filepath.Join(appContextPath, name))
+	}
+
+	var envList []string
+	for k, v := range env {
+		envList = append(envList, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	options, err := cli.NewProjectOptions(files, append([]cli.ProjectOptionsFn{
+		cli.WithWorkingDirectory(appContextPath),
+		cli.WithEnv(envList),
+		cli.WithDotEnv,
+	}, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	project, err := cli.ProjectFromOptions(ctx, options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+	return project, nil
+}
+
+// checks for things compose accepts but mist can't run, warnings are fine to deploy with
+func ValidateProject(project *types.Project, domains []models.Domain) (warnings []string, err error) {
+	var problems []string
+
+	routed := map[string]bool{}
+	for _, d := range domains {
+		if d.ComposeService == nil || *d.ComposeService == "" {
+			continue
+		}
+		svc, ok := project.Services[*d.ComposeService]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("domain %s routes to service %q which is not defined", d.Domain, *d.ComposeService))
+			continue
+		}
+		if !routed[svc.Name] && svc.NetworkMode != "" {
+			problems = append(problems, fmt.Sprintf("service %q is routed by a domain but uses network_mode %q, it can't join traefik-net", svc.Name, svc.NetworkMode))
+		}
+		routed[svc.Name] = true
+	}
+	var routedNames []string
+	for name := range routed {
+		routedNames = append(routedNames, name)
+	}
+	sort.Strings(routedNames)
+	for i, name := range routedNames {
+		if other := ConflictingServiceName(name, routedNames[:i]); other != "" {
+			problems = append(problems, fmt.Sprintf("services %q and %q are both routed but map to the same traefik name, rename one of them", other, name))
+		}
+	}
+
+	for _, name := range project.ServiceNames() {
+		svc := project.Services[name]
+		if svc.Image == "" && svc.Build == nil {
+			problems = append(problems, fmt.Sprintf("service %q needs either an image or a build section", name))
+		}
+		if svc.Deploy != nil && svc.Deploy.Mode == "global" {
+			problems = append(problems, fmt.Sprintf("service %q uses deploy mode global, which only works in swarm", name))
+		}
+		if svc.ContainerName != "" {
+			warnings = append(warnings, fmt.Sprintf("service %q sets container_name, it can't be scaled and may collide with other apps", name))
+		}
+	}
+
+	for name, secret := range project.Secrets {
+		if secret.External {
+			problems = append(problems, fmt.Sprintf("secret %q is external, external secrets only work in swarm", name))
+		}
+	}
+	for name, config := range project.Configs {
+		if config.External {
+			problems = append(problems, fmt.Sprintf("config %q is external, external configs only work in swarm", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return warnings, fmt.Errorf("unsupported compose options:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return warnings, nil
+}
+
+type ServiceDefinition struct {
+	Name          string   `json:"name"`
+	Image         string   `json:"image"`
+	Build         bool     `json:"build"`
+	Ports         []string `json:"ports"`
+	Volumes       []string `json:"volumes"`
+	Scale         int      `json:"scale"`
+	ContainerName string   `json:"containerName,omitempty"`
+}
+
+// what the compose file declares for every service, in name order
+func DescribeServices(project *types.Project) []ServiceDefinition {
+	definitions := []ServiceDefinition{}
+	for _, name := range project.ServiceNames() {
+		svc := project.Services[name]
+		def := ServiceDefinition{
+			Name:          name,
+			Image:         svc.Image,
+			Build:         svc.Build != nil,
+			Ports:         []string{},
+			Volumes:       []string{},
+			Scale:         svc.GetScale(),
+			ContainerName: svc.ContainerName,
+		}
+		for _, p := range svc.Ports {
+			port := fmt.Sprintf("%d/%s", p.Target, p.Protocol)
+			if p.Published != "" {
+				port = p.Published + ":" + port
+				if p.HostIP != "" {
+					port = p.HostIP + ":" + port
+				}
+			}
+			def.Ports = append(def.Ports, port)
+		}
+		for _, v := range svc.Volumes {
+			volume := v.Target
+			if v.Source != "" {
+				volume = v.Source + ":" + v.Target
+			}
+			if v.ReadOnly {
+				volume += ":ro"
+			}
+			def.Volumes = append(def.Volumes, fmt.Sprintf("%s (%s)", volume, v.Type))
+		}
+		definitions = append(definitions, def)
+	}
+	return definitions
+}
+
+// fixed host ports and container names can only exist once, so such services can't run more than one replica
+func CanScale(project *types.Project, service string) error {
+	svc, ok := project.Services[service]
+	if !ok {
+		return fmt.Errorf("service %q is not defined", service)
+	}
+	if svc.ContainerName != "" {
+		return fmt.Errorf("service %q sets container_name", service)
+	}
+	for _, p := range svc.Ports {
+		if p.Published != "" && !strings.Contains(p.Published, "-") {
+			return fmt.Errorf("service %q publishes the fixed host port %s", service, p.Published)
+		}
+	}
+	return nil
+}
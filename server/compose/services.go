@@ -0,0 +1,49 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// env is the one deployments interpolate with, otherwise compose may see a different config and recreate containers
+func ComposeServiceRestart(ctx context.Context, appID int64, appContextPath string, env map[string]string, service string) error {
+	cmd := composeCommand(ctx, appID, appContextPath, env, "restart", service)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker compose restart %s failed: %w", service, err)
+	}
+	return nil
+}
+
+func ComposeServiceStop(ctx context.Context, appID int64, appContextPath string, env map[string]string, service string) error {
+	cmd := composeCommand(ctx, appID, appContextPath, env, "stop", service)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker compose stop %s failed: %w", service, err)
+	}
+	return nil
+}
+
+func GetComposeServiceLogs(ctx context.Context, appID int64, appContextPath string, env map[string]string, service string, tail int) (string, error) {
+	cmd := composeCommand(ctx, appID, appContextPath, env, "logs", "--tail", strconv.Itoa(tail), service)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to get logs for %s: %w", service, err)
+	}
+	return string(output), nil
+}
+
+// `up --scale` instead of `compose scale` since the latter only exists in recent compose versions,
+// --no-deps keeps the rest of the stack untouched
+func ComposeScale(ctx context.Context, appID int64, appContextPath string, env map[string]string, service string, replicas int) error {
+	cmd := composeCommand(ctx, appID, appContextPath, env, "up", "-d", "--no-deps", "--no-recreate", "--scale", fmt.Sprintf("%s=%d", service, replicas), service)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker compose scale failed: %w: %s", err, string(output))
+	}
+	return nil
+}
@@ -1,10 +1,10 @@
 package compose
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 )
@@ -31,9 +31,8 @@ type DockerComposePSOutput struct {
 	Created int64  `json:"Created"`
 }
 
-func GetComposeStatus(appContextPath string, appName string) (*ComposeStatus, error) {
-	cmd := exec.Command("docker", "compose", "ps", "--format", "json")
-	cmd.Dir = appContextPath
+func GetComposeStatus(ctx context.Context, appID int64, appContextPath string, appName string) (*ComposeStatus, error) {
+	cmd := composeCommand(ctx, appID, appContextPath, nil, "ps", "--format", "json")
 	cmd.Stderr = os.Stderr
 	output, err := cmd.Output()
 	if err != nil {
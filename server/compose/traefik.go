@@ -0,0 +1,182 @@
+package compose
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
+	"gopkg.in/yaml.v3"
+)
+
+// generated next to the user's compose file, holds everything mist adds on top of it
+const OverrideFileName = "mist.override.yml"
+
+// file names `docker compose` looks for, in its own order of preference
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+func FindComposeFile(appContextPath string) (string, error) {
+	for _, name := range composeFileNames {
+		if _, err := os.Stat(filepath.Join(appContextPath, name)); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no compose file found in %s", appContextPath)
+}
+
+// override file names `docker compose` picks up next to the compose file, in its own order of preference
+var composeOverrideFileNames = []string{"compose.override.yml", "compose.override.yaml", "docker-compose.override.yml", "docker-compose.override.yaml"}
+
+// the repo's own override file, empty when there is none
+func FindComposeOverrideFile(appContextPath string) string {
+	for _, name := range composeOverrideFileNames {
+		if _, err := os.Stat(filepath.Join(appContextPath, name)); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// the user's compose file and its override in the order compose merges them, mist's own override
+// goes last when asked for
+func composeFiles(appContextPath string, withMistOverride bool) ([]string, error) {
+	base, err := FindComposeFile(appContextPath)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{base}
+	if override := FindComposeOverrideFile(appContextPath); override != "" {
+		files = append(files, override)
+	}
+	if withMistOverride {
+		files = append(files, OverrideFileName)
+	}
+	return files, nil
+}
+
+// `-f` flags for the user's compose files plus the mist override when one was generated,
+// without an override compose's own file discovery is left alone. passing `-f` turns that
+// discovery off, so the repo's override file has to be listed explicitly
+func composeFileArgs(appContextPath string) []string {
+	if _, err := os.Stat(filepath.Join(appContextPath, OverrideFileName)); err != nil {
+		return nil
+	}
+	files, err := composeFiles(appContextPath, true)
+	if err != nil {
+		return nil
+	}
+	var args []string
+	for _, f := range files {
+		args = append(args, "-f", f)
+	}
+	return args
+}
+
+// services at least one domain points at, in name order
+func routedServices(domains []models.Domain) []string {
+	var services []string
+	for _, d := range domains {
+		if d.ComposeService == nil || *d.ComposeService == "" {
+			continue
+		}
+		if !slices.Contains(services, *d.ComposeService) {
+			services = append(services, *d.ComposeService)
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// router, service and alias names only keep lowercase letters, digits and dashes, so eg. `a_b` and
+// `a-b` would end up sharing them. returns the service in others that clashes with service, if any
+func ConflictingServiceName(service string, others []string) string {
+	for _, other := range others {
+		if other != service && traefik.SanitizeName(other) == traefik.SanitizeName(service) {
+			return other
+		}
+	}
+	return ""
+}
+
+// writes the override attaching every routed service to traefik-net under an alias unique to the app,
+// the routers themselves live in the app's traefik file. the override is removed when no domain
+// points at a service
+func WriteTraefikOverride(app *models.App, appContextPath string, domains []models.Domain, logFile *os.File) error {
+	overridePath := filepath.Join(appContextPath, OverrideFileName)
+	for _, d := range domains {
+		if (d.ComposeService == nil || *d.ComposeService == "") && logFile != nil {
+			fmt.Fprintf(logFile, "[COMPOSE]: Domain %s has no service selected, skipping\n", d.Domain)
+		}
+	}
+
+	routed := routedServices(domains)
+	if len(routed) == 0 {
+		if err := os.Remove(overridePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	services := map[string]any{}
+	for _, service := range routed {
+		alias := traefik.ComposeServiceHost(app.ID, service)
+		services[service] = map[string]any{
+			// `default` has to be listed again, an override's networks replace the implicit one
+			"networks": map[string]any{
+				"default": map[string]any{},
+				"traefik-net": map[string]any{
+					"aliases": []string{alias},
+				},
+			},
+		}
+		if logFile != nil {
+			fmt.Fprintf(logFile, "[COMPOSE]: Attaching %s to traefik-net as %s\n", service, alias)
+		}
+	}
+
+	override := map[string]any{
+		"services": services,
+		"networks": map[string]any{
+			"traefik-net": map[string]any{"external": true},
+		},
+	}
+	content, err := yaml.Marshal(override)
+	if err != nil {
+		return fmt.Errorf("failed to generate compose override: %w", err)
+	}
+	header := "# generated by mist on every deployment, changes will be overwritten\n"
+	return os.WriteFile(overridePath, append([]byte(header), content...), 0o644)
+}
+
+// true when a domain points at a service the current override doesn't attach to traefik-net yet,
+// such a service is only reachable after the next deployment
+func NeedsOverrideUpdate(app *models.App, appContextPath string, domains []models.Domain) bool {
+	routed := routedServices(domains)
+	if len(routed) == 0 {
+		return false
+	}
+	content, err := os.ReadFile(filepath.Join(appContextPath, OverrideFileName))
+	if err != nil {
+		return true
+	}
+	var override struct {
+		Services map[string]struct {
+			Networks map[string]struct {
+				Aliases []string `yaml:"aliases"`
+			} `yaml:"networks"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(content, &override); err != nil {
+		return true
+	}
+	for _, service := range routed {
+		net := override.Services[service].Networks["traefik-net"]
+		if !slices.Contains(net.Aliases, traefik.ComposeServiceHost(app.ID, service)) {
+			return true
+		}
+	}
+	return false
+}
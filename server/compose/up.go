@@ -1,19 +1,20 @@
 package compose
 
 import (
-	"fmt"
+	"context"
 	"os"
-	"os/exec"
 )
 
-func ComposeUp(appContextPath string, env map[string]string, logFile *os.File) error {
-	cmd := exec.Command("docker", "compose", "up", "-d")
-	var envArray []string
-	for k, v := range env {
-		envArray = append(envArray, fmt.Sprintf("%s=%s", k, v))
-	}
-	cmd.Env = envArray
-	cmd.Dir = appContextPath
+func ComposeUp(ctx context.Context, appID int64, appContextPath string, env map[string]string, logFile *os.File) error {
+	cmd := composeCommand(ctx, appID, appContextPath, env, "up", "-d")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	return cmd.Run()
+}
+
+// rebuilds every service with a build section from scratch, `up` reuses the cache otherwise
+func ComposeBuildNoCache(ctx context.Context, appID int64, appContextPath string, env map[string]string, logFile *os.File) error {
+	cmd := composeCommand(ctx, appID, appContextPath, env, "build", "--no-cache")
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
 	return cmd.Run()
@@ -5,4 +5,8 @@ var Constants = map[string]any{
 	"LogPath":       "/var/lib/mist/logs",
 	"AvatarDirPath": "/var/lib/mist/uploads/avatar",
 	"MaxAvatarSize": 5 << 20,
+	// uploaded source archives are kept here until the deployment extracts them
+	"ArchiveDirPath":          "/var/lib/mist/uploads/archives",
+	"MaxArchiveSize":          200 << 20,
+	"MaxArchiveExtractedSize": 1 << 30,
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/corecollectives/mist/models"
 	"gorm.io/gorm"
@@ -110,6 +111,8 @@ func migrateDbInternal(dbInstance *gorm.DB) error {
 		&models.GithubInstallation{},
 		&models.AppRepositories{},
 		&models.Domain{},
+		&models.AccessUser{},
+		&models.AccessIPRule{},
 		&models.Volume{},
 		&models.Cron{},
 		&models.Registry{},
@@ -119,6 +122,8 @@ func migrateDbInternal(dbInstance *gorm.DB) error {
 		&models.Session{},
 		&models.Notification{},
 		&models.UpdateLog{},
+		&models.DeployHook{},
+		&models.WebhookDelivery{},
 	}
 
 	for _, model := range allModels {
@@ -243,6 +248,79 @@ func migrateDbInternal(dbInstance *gorm.DB) error {
 	dbInstance.Clauses(clause.Insert{Modifier: "OR IGNORE"}).Create(&MistAppName)
 	dbInstance.Clauses(clause.Insert{Modifier: "OR REPLACE"}).Create(&Version)
 
+	// every domain was redirected to https before ForceHttps was honored, existing domains keep that once
+	var domainHttpsDefaults = models.SystemSettingEntry{
+		Key:   "domain_https_defaults_applied",
+		Value: "true",
+	}
+	if result := dbInstance.Clauses(clause.Insert{Modifier: "OR IGNORE"}).Create(&domainHttpsDefaults); result.Error == nil && result.RowsAffected == 1 {
+		dbInstance.Model(&models.Domain{}).Where("force_https = ?", false).Update("force_https", true)
+	}
+
+	// compose apps used to run under the project name compose derived from their directory, which
+	// their named volumes carry. an app keeps it when no other app shares its name, otherwise the
+	// owner is found from its containers on startup and the rest move to `mist-app-<id>`
+	var composeProjectDefaults = models.SystemSettingEntry{
+		Key:   "compose_project_defaults_applied",
+		Value: "true",
+	}
+	if result := dbInstance.Clauses(clause.Insert{Modifier: "OR IGNORE"}).Create(&composeProjectDefaults); result.Error == nil && result.RowsAffected == 1 {
+		var apps []models.App
+		dbInstance.Select("id", "name").Where("app_type = ? AND (compose_project IS NULL OR compose_project = '')", models.AppTypeCompose).Find(&apps)
+		byProject := map[string][]int64{}
+		for _, app := range apps {
+			project := models.NormalizeComposeProjectName(app.Name)
+			byProject[project] = append(byProject[project], app.ID)
+		}
+		for project, ids := range byProject {
+			if project == "" || len(ids) != 1 {
+				continue
+			}
+			dbInstance.Model(&models.App{}).Where("id = ?", ids[0]).Update("compose_project", project)
+		}
+	}
+
+	// deploy hook tokens used to be stored in plain text
+	var deployHookTokensHashed = models.SystemSettingEntry{
+		Key:   "deploy_hook_tokens_hashed",
+		Value: "true",
+	}
+	if result := dbInstance.Clauses(clause.Insert{Modifier: "OR IGNORE"}).Create(&deployHookTokensHashed); result.Error == nil && result.RowsAffected == 1 {
+		var hooks []models.DeployHook
+		dbInstance.Find(&hooks)
+		for _, hook := range hooks {
+			dbInstance.Model(&models.DeployHook{}).Where("id = ?", hook.ID).Updates(map[string]interface{}{
+				"token":        models.HashDeployHookToken(hook.TokenHash),
+				"token_prefix": models.DeployHookTokenPrefix(hook.TokenHash),
+			})
+		}
+	}
+
+	// domains added before ownership verification stay routed
+	var domainOwnershipDefaults = models.SystemSettingEntry{
+		Key:   "domain_ownership_defaults_applied",
+		Value: "true",
+	}
+	if result := dbInstance.Clauses(clause.Insert{Modifier: "OR IGNORE"}).Create(&domainOwnershipDefaults); result.Error == nil && result.RowsAffected == 1 {
+		dbInstance.Model(&models.Domain{}).Where("ownership_verified = ?", false).Updates(map[string]interface{}{
+			"ownership_verified":    true,
+			"verification_method":   models.VerificationMethodExisting,
+			"ownership_verified_at": time.Now(),
+		})
+	}
+
+	// the host alone used to be unique, now a host can be shared by routes with different path prefixes
+	if migrator.HasIndex(&models.Domain{}, "idx_domains_domain_name") {
+		if err := migrator.DropIndex(&models.Domain{}, "idx_domains_domain_name"); err != nil {
+			fmt.Printf("migration.go: warning dropping domain index: %v\n", err)
+		}
+	}
+	if !migrator.HasIndex(&models.Domain{}, "idx_domains_host_path") {
+		if err := migrator.CreateIndex(&models.Domain{}, "idx_domains_host_path"); err != nil {
+			fmt.Printf("migration.go: warning creating domain index: %v\n", err)
+		}
+	}
+
 	return nil
 }
 
@@ -189,7 +189,7 @@ func ContainerExists(name string) bool {
 
 }
 
-func CreateAndStartContainer(ctx context.Context, app *models.App, imageTag, containerName string, domains []string, Port int, runtimeEnvVars map[string]string, logfile *os.File) error {
+func CreateAndStartContainer(ctx context.Context, app *models.App, imageTag, containerName string, Port int, runtimeEnvVars map[string]string, logfile *os.File) error {
 
 	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
@@ -230,37 +230,15 @@ func CreateAndStartContainer(ctx context.Context, app *models.App, imageTag, con
 		envList = append(envList, fmt.Sprintf("%s=%s", key, value))
 	}
 
-	labels := make(map[string]string)
-
 	networkMode := ""
 	exposedPorts := make(network.PortSet)
 	portBindings := make(network.PortMap)
 
 	switch app.AppType {
 	case models.AppTypeWeb:
+		// traefik reaches the container over traefik-net, its routers live in the app's file (see traefik.RenderApp)
 		networkMode = "traefik-net"
 
-		if len(domains) > 0 {
-			labels["traefik.enable"] = "true"
-
-			var hostRules []string
-			for _, domain := range domains {
-				hostRules = append(hostRules, fmt.Sprintf("Host(`%s`)", domain))
-			}
-			hostRule := strings.Join(hostRules, " || ")
-
-			labels[fmt.Sprintf("traefik.http.routers.%s.rule", containerName)] = hostRule
-			labels[fmt.Sprintf("traefik.http.routers.%s.entrypoints", containerName)] = "websecure"
-			labels[fmt.Sprintf("traefik.http.routers.%s.tls", containerName)] = "true"
-			labels[fmt.Sprintf("traefik.http.routers.%s.tls.certresolver", containerName)] = "le"
-			labels[fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port", containerName)] = fmt.Sprintf("%d", Port)
-
-			labels[fmt.Sprintf("traefik.http.routers.%s-http.rule", containerName)] = hostRule
-			labels[fmt.Sprintf("traefik.http.routers.%s-http.entrypoints", containerName)] = "web"
-			labels[fmt.Sprintf("traefik.http.routers.%s-http.middlewares", containerName)] = fmt.Sprintf("%s-https-redirect", containerName)
-			labels[fmt.Sprintf("traefik.http.middlewares.%s-https-redirect.redirectscheme.scheme", containerName)] = "https"
-		}
-
 		shouldExpose := app.ShouldExpose != nil && *app.ShouldExpose
 
 		if shouldExpose {
@@ -356,7 +334,6 @@ func CreateAndStartContainer(ctx context.Context, app *models.App, imageTag, con
 	config := container.Config{
 		Image:        imageTag,
 		Env:          envList,
-		Labels:       labels,
 		ExposedPorts: exposedPorts,
 	}
 
@@ -471,7 +448,7 @@ func RecreateContainer(app *models.App) error {
 	}
 	imageTag := inspectResult.Container.Image
 
-	port, domains, envSet, err := FetchDeploymentConfigurationForApp(app)
+	port, _, envSet, err := FetchDeploymentConfigurationForApp(app)
 	if err != nil {
 		return fmt.Errorf("failed to fetch deployment configuration: %w", err)
 	}
@@ -480,7 +457,7 @@ func RecreateContainer(app *models.App) error {
 		return fmt.Errorf("failed to stop and remove container: %w", err)
 	}
 
-	if err := CreateAndStartContainer(ctx, app, imageTag, containerName, domains, port, envSet.Runtime, nil); err != nil {
+	if err := CreateAndStartContainer(ctx, app, imageTag, containerName, port, envSet.Runtime, nil); err != nil {
 		return fmt.Errorf("failed to create and start container: %w", err)
 	}
 
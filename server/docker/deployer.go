@@ -7,10 +7,12 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/corecollectives/mist/constants"
 	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
 	"github.com/corecollectives/mist/utils"
 	"gorm.io/gorm"
 )
@@ -92,6 +94,10 @@ func ExecuteContainerDeployment(ctx context.Context, dep *models.Deployment, app
 		if template.DockerImageVersion != nil && *template.DockerImageVersion != "" {
 			imageName = imageName + ":" + *template.DockerImageVersion
 		}
+		// image tag pinned by the deployment (e.g. via deploy hook) wins over the template version
+		if dep.ImageTag != nil && *dep.ImageTag != "" {
+			imageName = withImageTag(template.DockerImage, *dep.ImageTag)
+		}
 
 		logger.InfoWithFields("Pulling prebuilt Docker image", map[string]interface{}{
 			"image": imageName,
@@ -126,8 +132,9 @@ func ExecuteContainerDeployment(ctx context.Context, dep *models.Deployment, app
 
 		logger.InfoWithFields("Building Docker image with build-time arguments", map[string]interface{}{
 			"buildArgsCount": envSet.GetBuildTimeCount(),
+			"noCache":        dep.NoCache,
 		})
-		if err := BuildDockerImageWithBuildArgs(ctx, imageTag, appContextPath, envSet.BuildTime, logfile); err != nil {
+		if err := BuildDockerImageWithBuildArgs(ctx, imageTag, appContextPath, envSet.BuildTime, dep.NoCache, logfile); err != nil {
 			if ctx.Err() == context.Canceled {
 				logger.Info("Docker image build canceled")
 				return ctx.Err()
@@ -179,7 +186,7 @@ func ExecuteContainerDeployment(ctx context.Context, dep *models.Deployment, app
 		"appType":        app.AppType,
 	})
 
-	if err := CreateAndStartContainer(ctx, app, imageTag, containerName, domains, port, envSet.Runtime, logfile); err != nil {
+	if err := CreateAndStartContainer(ctx, app, imageTag, containerName, port, envSet.Runtime, logfile); err != nil {
 		if ctx.Err() == context.Canceled {
 			logger.Info("Container creation canceled")
 			return ctx.Err()
@@ -196,6 +203,19 @@ func ExecuteContainerDeployment(ctx context.Context, dep *models.Deployment, app
 		return fmt.Errorf("create and start container failed: %w", err)
 	}
 
+	if err := traefik.RenderApp(app.ID); err != nil {
+		logger.Error(err, "Failed to write routing config")
+		dep.Status = "failed"
+		dep.Stage = "failed"
+		dep.Progress = 0
+		errMsg := fmt.Sprintf("Failed to write routing config: %v", err)
+		dep.ErrorMessage = &errMsg
+		UpdateDeploymentRecord(dep, db)
+		models.UpdateDeploymentStatus(dep.ID, "failed", "failed", 0, &errMsg)
+		UpdateApplicationStatus(app.ID, "error", db)
+		return fmt.Errorf("write routing config failed: %w", err)
+	}
+
 	dep.Status = "success"
 	dep.Stage = "success"
 	dep.Progress = 100
@@ -224,8 +244,18 @@ func ExecuteContainerDeployment(ctx context.Context, dep *models.Deployment, app
 	return nil
 }
 
+// replaces the tag of an image reference, registry ports (`host:5000/img`) are not mistaken for tags
+func withImageTag(image, tag string) string {
+	lastSlash := strings.LastIndex(image, "/")
+	if idx := strings.LastIndex(image, ":"); idx > lastSlash {
+		image = image[:idx]
+	}
+	return image + ":" + tag
+}
+
+// superseded deployments keep that status, see models.UpdateDeploymentStatus
 func UpdateDeploymentRecord(dep *models.Deployment, db *gorm.DB) error {
-	return db.Model(dep).Updates(map[string]interface{}{
+	return db.Model(dep).Where("status <> ?", models.DeploymentStatusSuperseded).Updates(map[string]interface{}{
 		"status":        dep.Status,
 		"stage":         dep.Stage,
 		"progress":      dep.Progress,
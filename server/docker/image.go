@@ -12,7 +12,7 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func BuildDockerImageWithBuildArgs(ctx context.Context, imageTag, contextPath string, buildArgs map[string]string, logfile *os.File) error {
+func BuildDockerImageWithBuildArgs(ctx context.Context, imageTag, contextPath string, buildArgs map[string]string, noCache bool, logfile *os.File) error {
 	timeoutCtx, cancel := context.WithTimeout(ctx, 15*time.Minute)
 	defer cancel()
 	cli, err := client.New(client.FromEnv)
@@ -37,9 +37,10 @@ func BuildDockerImageWithBuildArgs(ctx context.Context, imageTag, contextPath st
 		Tags:      tags,
 		Remove:    true,
 		BuildArgs: buildArgsMap,
+		NoCache:   noCache,
 	}
 
-	log.Info().Str("image_tag", imageTag).Int("build_args_count", len(buildArgs)).Msg("Building Docker image with build-time arguments")
+	log.Info().Str("image_tag", imageTag).Int("build_args_count", len(buildArgs)).Bool("no_cache", noCache).Msg("Building Docker image with build-time arguments")
 
 	resp, err := cli.ImageBuild(timeoutCtx, buildCtx, buildOptions)
 	if err != nil {
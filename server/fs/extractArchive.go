@@ -0,0 +1,290 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errArchiveTooLarge = errors.New("archive exceeds the maximum extracted size")
+
+// detects the archive format from its first bytes, returns "tar.gz", "zip" or "" when neither
+func DetectArchiveFormat(r io.Reader) string {
+	header := make([]byte, 4)
+	n, _ := io.ReadFull(r, header)
+	header = header[:n]
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return "tar.gz"
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return "zip"
+	}
+	return ""
+}
+
+// extracts a tar.gz or zip archive into dest, entries escaping dest (absolute paths, `..`, links pointing outside)
+// are rejected and extraction stops once maxSize bytes were written.
+// archives with a single top level directory (eg. github source downloads) are unwrapped.
+// cancelling ctx stops the extraction between entries
+func ExtractArchive(ctx context.Context, src string, dest string, maxSize int64) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	format := DetectArchiveFormat(f)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return err
+	}
+	// every write goes through the root, so links inside the archive can't lead a later entry out of dest
+	root, err := os.OpenRoot(dest)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	remaining := maxSize
+	switch format {
+	case "tar.gz":
+		err = extractTarGz(ctx, f, root, &remaining)
+	case "zip":
+		info, statErr := f.Stat()
+		if statErr != nil {
+			return statErr
+		}
+		err = extractZip(ctx, f, info.Size(), root, &remaining)
+	default:
+		return fmt.Errorf("unsupported archive format, expected tar.gz or zip")
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkExtractedLinks(dest); err != nil {
+		return err
+	}
+
+	return unwrapSingleDirectory(dest)
+}
+
+// resolves an archive entry name to a path relative to the extraction root
+func archiveEntryPath(name string) (string, error) {
+	name = strings.TrimPrefix(filepath.ToSlash(name), "./")
+	if name == "" || name == "." {
+		return "", nil
+	}
+	cleaned := filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if !filepath.IsLocal(cleaned) {
+		return "", fmt.Errorf("illegal path in archive: %s", name)
+	}
+	return cleaned, nil
+}
+
+// symlinks are allowed as long as they point to somewhere inside the archive, chains of links are
+// resolved once everything is extracted, see checkExtractedLinks
+func checkLinkTarget(name string, linkname string) error {
+	if filepath.IsAbs(linkname) || filepath.VolumeName(linkname) != "" {
+		return fmt.Errorf("illegal link target in archive: %s", linkname)
+	}
+	if !filepath.IsLocal(filepath.Join(filepath.Dir(name), linkname)) {
+		return fmt.Errorf("illegal link target in archive: %s", linkname)
+	}
+	return nil
+}
+
+// every link looks local on its own, but a chain like `s -> .`, `t -> s/..` still resolves outside
+// dest. the workspace is read by builds and copied into static sites later, so no link may end up outside
+func checkExtractedLinks(dest string) error {
+	realDest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(dest, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&os.ModeSymlink == 0 {
+			return nil
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// dangling links can't be followed anywhere
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(realDest, resolved)
+		if err != nil || (rel != "." && !filepath.IsLocal(rel)) {
+			linkname, _ := os.Readlink(path)
+			return fmt.Errorf("illegal link target in archive: %s", linkname)
+		}
+		return nil
+	})
+}
+
+func writeArchiveSymlink(root *os.Root, name string, linkname string) error {
+	if err := checkLinkTarget(name, linkname); err != nil {
+		return err
+	}
+	if err := root.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return root.Symlink(linkname, name)
+}
+
+func writeArchiveFile(root *os.Root, name string, r io.Reader, mode os.FileMode, remaining *int64) error {
+	if err := root.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	out, err := root.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// read one byte past the limit so an oversized entry is detected instead of silently truncated
+	n, err := io.Copy(out, io.LimitReader(r, *remaining+1))
+	if err != nil {
+		return err
+	}
+	*remaining -= n
+	if *remaining < 0 {
+		return errArchiveTooLarge
+	}
+	return nil
+}
+
+func extractTarGz(ctx context.Context, r io.Reader, root *os.Root, remaining *int64) error {
+	gz, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return fmt.Errorf("invalid gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+
+		name, err := archiveEntryPath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := root.MkdirAll(name, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeArchiveFile(root, name, tr, os.FileMode(hdr.Mode), remaining); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := writeArchiveSymlink(root, name, hdr.Linkname); err != nil {
+				return err
+			}
+		default:
+			// hard links, devices, fifos etc. have no place in a source archive
+			continue
+		}
+	}
+}
+
+func extractZip(ctx context.Context, r io.ReaderAt, size int64, root *os.Root, remaining *int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	for _, file := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name, err := archiveEntryPath(file.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			if err := root.MkdirAll(name, 0o755); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			rc, err := file.Open()
+			if err != nil {
+				return err
+			}
+			linkname, err := io.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			if err := writeArchiveSymlink(root, name, string(linkname)); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := file.Open()
+			if err != nil {
+				return err
+			}
+			err = writeArchiveFile(root, name, rc, mode, remaining)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func unwrapSingleDirectory(dest string) error {
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return nil
+	}
+
+	inner := filepath.Join(dest, entries[0].Name())
+	// move the wrapper out of the way first in case it contains an entry with its own name
+	tmp := dest + ".unwrap"
+	if err := os.Rename(inner, tmp); err != nil {
+		return err
+	}
+	if err := os.Remove(dest); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
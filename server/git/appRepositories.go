@@ -0,0 +1,75 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/corecollectives/mist/github"
+	"github.com/corecollectives/mist/models"
+	"github.com/rs/zerolog/log"
+)
+
+// clones the app's extra repositories into their paths inside the build context (workspace + root directory),
+// has to run after the main clone since that one wipes the workspace
+func cloneAppRepositories(ctx context.Context, appId int64, dep *models.Deployment, workspace string, logFile *os.File) error {
+	repos, err := models.GetAppRepositoriesByAppID(appId)
+	if err != nil {
+		return fmt.Errorf("failed to get app repositories: %w", err)
+	}
+	if len(repos) == 0 {
+		return nil
+	}
+
+	app, err := models.GetApplicationByID(appId)
+	if err != nil {
+		return fmt.Errorf("failed to fetch app: %w", err)
+	}
+	contextPath := filepath.Join(workspace, app.RootDirectory)
+
+	for _, repo := range repos {
+		cloneURL, accessToken, err := repo.CloneCredentials()
+		if err != nil {
+			return fmt.Errorf("failed to resolve credentials for %s: %w", repo.RepoFullName, err)
+		}
+		if accessToken != "" {
+			cloneURL = github.CreateCloneUrl(accessToken, cloneURL)
+		}
+
+		relPath, err := models.CleanAppRepositoryPath(repo.Path)
+		if err != nil {
+			return fmt.Errorf("invalid path for %s: %w", repo.RepoFullName, err)
+		}
+		target := filepath.Join(contextPath, filepath.FromSlash(relPath))
+
+		// the main repo may already have something at that path (eg. a submodule placeholder)
+		if err := os.RemoveAll(target); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", relPath, err)
+		}
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		log.Info().Int64("app_id", appId).Str("repo", repo.RepoFullName).Str("branch", repo.Branch).Str("path", relPath).Msg("Cloning extra repository")
+		if err := CloneGitRepo(ctx, cloneURL, repo.Branch, logFile, target); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("git clone timed out after 10 minutes")
+			}
+			return fmt.Errorf("error cloning %s: %w", repo.RepoFullName, err)
+		}
+
+		// the pushed commit is pinned when the deployment came from this repository
+		if dep.SourceRepository != nil && *dep.SourceRepository == repo.RepoFullName {
+			if err := checkoutCommit(target, dep.CommitHash, logFile); err != nil {
+				return err
+			}
+			recordCommitInfo(ctx, target, dep, logFile)
+		}
+
+		if err := models.MarkAppRepositorySynced(repo.ID); err != nil {
+			log.Warn().Err(err).Int64("repo_id", repo.ID).Msg("Failed to update last synced time")
+		}
+	}
+	return nil
+}
@@ -14,14 +14,19 @@ import (
 )
 
 func CloneGitRepo(ctx context.Context, url string, branch string, logFile *os.File, path string) error {
-	_, err := fmt.Fprintf(logFile, "[GIT]: Cloning into %s\n", path)
+	return CloneGitRef(ctx, url, plumbing.NewBranchReferenceName(branch), logFile, path)
+}
+
+// same as CloneGitRepo but takes a full reference name, used for tag triggered deployments
+func CloneGitRef(ctx context.Context, url string, ref plumbing.ReferenceName, logFile *os.File, path string) error {
+	_, err := fmt.Fprintf(logFile, "[GIT]: Cloning %s into %s\n", ref.Short(), path)
 	if err != nil {
 		log.Warn().Msg("error logging into log file")
 	}
 	_, err = git.PlainCloneContext(ctx, path, &git.CloneOptions{
-		URL: url,
-		// Progress:      logFile,
-		ReferenceName: plumbing.NewBranchReferenceName(branch),
+		URL:           url,
+		Progress:      newProgressWriter(logFile),
+		ReferenceName: ref,
 		SingleBranch:  true,
 	})
 	if err != nil {
@@ -34,8 +39,33 @@ func CloneGitRepo(ctx context.Context, url string, branch string, logFile *os.Fi
 	return nil
 }
 
+// checks out the exact commit a deployment was created for, the clone is a full single branch clone so any
+// commit reachable from the branch head can be checked out
+func checkoutCommit(path string, commitHash string, logFile *os.File) error {
+	if !plumbing.IsHash(commitHash) {
+		return nil
+	}
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return fmt.Errorf("failed to open cloned repository: %w", err)
+	}
+	head, err := repo.Head()
+	if err == nil && head.Hash().String() == commitHash {
+		return nil
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	fmt.Fprintf(logFile, "[GIT]: Checking out commit %s\n", commitHash)
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(commitHash), Force: true}); err != nil {
+		return fmt.Errorf("failed to checkout commit %s: %w", commitHash, err)
+	}
+	return nil
+}
+
 // TODO: make this git provider independent
-func CloneRepo(ctx context.Context, appId int64, logFile *os.File) error {
+func CloneRepo(ctx context.Context, appId int64, dep *models.Deployment, logFile *os.File) error {
 	log.Info().Int64("app_id", appId).Msg("Starting repository clone")
 
 	userId, err := models.GetUserIDByAppID(appId)
@@ -52,6 +82,13 @@ func CloneRepo(ctx context.Context, appId int64, logFile *os.File) error {
 	if err != nil {
 		return fmt.Errorf("failed to fetch app: %w", err)
 	}
+	if dep.Branch != nil && *dep.Branch != "" {
+		branch = *dep.Branch
+	}
+	ref := plumbing.NewBranchReferenceName(branch)
+	if dep.Ref != nil && plumbing.ReferenceName(*dep.Ref).IsTag() {
+		ref = plumbing.ReferenceName(*dep.Ref)
+	}
 
 	if shouldMigrate {
 		log.Info().Int64("app_id", appId).Msg("Migrating legacy app to new git format")
@@ -94,7 +131,7 @@ func CloneRepo(ctx context.Context, appId int64, logFile *os.File) error {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	log.Info().Str("clone_url", cloneURL).Str("branch", branch).Str("path", path).Msg("Cloning repository")
+	log.Info().Str("clone_url", cloneURL).Str("ref", ref.String()).Str("path", path).Msg("Cloning repository")
 
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
@@ -112,7 +149,7 @@ func CloneRepo(ctx context.Context, appId int64, logFile *os.File) error {
 	// }
 
 	// new git sdk implementation
-	err = CloneGitRepo(ctx, repoURL, branch, logFile, path)
+	err = CloneGitRef(ctx, repoURL, ref, logFile, path)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			return fmt.Errorf("git clone timed out after 10 minutes")
@@ -120,6 +157,18 @@ func CloneRepo(ctx context.Context, appId int64, logFile *os.File) error {
 		return fmt.Errorf("error cloning repository: %v\n", err)
 	}
 
+	// deployments triggered from an extra repository build the app's branch head
+	if dep.SourceRepository == nil {
+		if err := checkoutCommit(path, dep.CommitHash, logFile); err != nil {
+			return err
+		}
+		recordCommitInfo(ctx, path, dep, logFile)
+	}
+
+	if err := cloneAppRepositories(ctx, appId, dep, path, logFile); err != nil {
+		return err
+	}
+
 	log.Info().Int64("app_id", appId).Str("path", path).Msg("Repository cloned successfully")
 	return nil
 }
@@ -13,6 +13,11 @@ import (
 )
 
 func GetLatestCommit(appID int64, userID int64) (*models.LatestCommit, error) {
+	return GetLatestCommitOnBranch(appID, userID, "")
+}
+
+// branch is optional, when empty the app's configured branch (or remote HEAD for plain clone urls) is used
+func GetLatestCommitOnBranch(appID int64, userID int64, branch string) (*models.LatestCommit, error) {
 	gitProvider, err := models.GetGitProviderNameByAppID(appID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get git provider: %w", err)
@@ -28,11 +33,11 @@ func GetLatestCommit(appID int64, userID int64) (*models.LatestCommit, error) {
 	}
 
 	if gitProvider == nil && gitCloneUrl != nil {
-		return latestRemoteCommit(*gitCloneUrl)
+		return latestRemoteCommit(*gitCloneUrl, branch)
 	}
 
 	if *gitProvider == models.GitProviderGitHub {
-		return github.GetLatestCommit(appID, userID)
+		return github.GetLatestCommitOnBranch(appID, userID, branch)
 	}
 	return nil, fmt.Errorf("failed to get latest commit")
 
@@ -41,7 +46,11 @@ func GetLatestCommit(appID int64, userID int64) (*models.LatestCommit, error) {
 // for repositories which are linked via git clone url and not any github provider
 // we temporarily clone it (not fully) to get the latest commit information
 // the path for this temp repo is `/var/lib/mist/git-meta/repo-`
-func latestRemoteCommit(repoURL string) (*models.LatestCommit, error) {
+func latestRemoteCommit(repoURL string, branch string) (*models.LatestCommit, error) {
+	ref := "HEAD"
+	if branch != "" {
+		ref = branch
+	}
 
 	tmpPath := filepath.Join(constants.Constants["RootPath"].(string), "git-meta")
 	if err := os.MkdirAll(tmpPath, 0o755); err != nil {
@@ -72,7 +81,7 @@ func latestRemoteCommit(repoURL string) (*models.LatestCommit, error) {
 		"--depth=1",
 		"--filter=blob:none",
 		"origin",
-		"HEAD",
+		ref,
 	)
 	cmd.Dir = tmpDir
 	if out, err := cmd.CombinedOutput(); err != nil {
@@ -0,0 +1,77 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/corecollectives/mist/models"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/rs/zerolog/log"
+)
+
+// reads author, timestamp and a changed files summary from the checked out HEAD and stores them on the deployment,
+// failures are only logged since the build itself doesn't depend on any of it
+func recordCommitInfo(ctx context.Context, path string, dep *models.Deployment, logFile *os.File) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		log.Warn().Err(err).Int64("deployment_id", dep.ID).Msg("Failed to open repository for commit info")
+		return
+	}
+	head, err := repo.Head()
+	if err != nil {
+		log.Warn().Err(err).Int64("deployment_id", dep.ID).Msg("Failed to resolve HEAD for commit info")
+		return
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		log.Warn().Err(err).Int64("deployment_id", dep.ID).Msg("Failed to read HEAD commit")
+		return
+	}
+
+	author := commit.Author.Name
+	message := strings.TrimSpace(commit.Message)
+	timestamp := commit.Author.When
+	var summary *string
+	if stats, err := commit.StatsContext(ctx); err == nil {
+		s := summarizeFileStats(stats)
+		summary = &s
+	} else {
+		log.Warn().Err(err).Int64("deployment_id", dep.ID).Msg("Failed to compute commit stats")
+	}
+
+	title, _, _ := strings.Cut(message, "\n")
+	fmt.Fprintf(logFile, "[GIT]: HEAD is now at %s %s (%s, %s)\n", head.Hash().String()[:7], title, author, timestamp.Format("2006-01-02 15:04:05 -0700"))
+	if summary != nil {
+		fmt.Fprintf(logFile, "[GIT]: %s\n", *summary)
+	}
+
+	if err := models.UpdateDeploymentCommitInfo(dep.ID, &message, &author, &timestamp, summary); err != nil {
+		log.Warn().Err(err).Int64("deployment_id", dep.ID).Msg("Failed to store commit info")
+		return
+	}
+	if dep.CommitMessage == nil || *dep.CommitMessage == "" {
+		dep.CommitMessage = &message
+	}
+	if dep.CommitAuthor == nil || *dep.CommitAuthor == "" {
+		dep.CommitAuthor = &author
+	}
+	dep.CommitTimestamp = &timestamp
+	dep.ChangedFiles = summary
+}
+
+// same shape as `git diff --shortstat`
+func summarizeFileStats(stats object.FileStats) string {
+	additions, deletions := 0, 0
+	for _, s := range stats {
+		additions += s.Addition
+		deletions += s.Deletion
+	}
+	files := "files"
+	if len(stats) == 1 {
+		files = "file"
+	}
+	return fmt.Sprintf("%d %s changed, %d insertions(+), %d deletions(-)", len(stats), files, additions, deletions)
+}
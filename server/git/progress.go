@@ -0,0 +1,62 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how often an in-progress phase (eg. "Receiving objects") is repeated in the build log
+const progressLogInterval = 2 * time.Second
+
+// progressWriter turns the sideband progress go-git emits (lines ending in \r that overwrite each other) into
+// a handful of readable log lines: the first update of each phase, one every progressLogInterval, and the final "done" line
+type progressWriter struct {
+	mu        sync.Mutex
+	out       io.Writer
+	buf       strings.Builder
+	phase     string
+	lastWrite time.Time
+}
+
+func newProgressWriter(out io.Writer) *progressWriter {
+	return &progressWriter{out: out}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, c := range string(b) {
+		if c == '\r' || c == '\n' {
+			p.flushLine()
+			continue
+		}
+		p.buf.WriteRune(c)
+	}
+	return len(b), nil
+}
+
+func (p *progressWriter) flushLine() {
+	line := strings.TrimSpace(p.buf.String())
+	p.buf.Reset()
+	if line == "" {
+		return
+	}
+
+	phase := line
+	if i := strings.Index(line, ":"); i > 0 {
+		phase = line[:i]
+	}
+	done := strings.HasSuffix(line, "done.") || strings.HasSuffix(line, "done")
+	now := time.Now()
+	if phase == p.phase && !done && now.Sub(p.lastWrite) < progressLogInterval {
+		return
+	}
+
+	p.phase = phase
+	p.lastWrite = now
+	fmt.Fprintf(p.out, "[GIT]: %s\n", line)
+}
@@ -7,11 +7,14 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/corecollectives/mist/models"
 )
 
-func CreateDeployment(repo string, branch string, userId int) (int64, error) {
+// the token comes from the installation owning the repo, so status updates keep working when the app creator leaves
+func CreateDeployment(repo string, branch string) (int64, error) {
 
-	token, _, err := GetGitHubAccessToken(userId)
+	token, err := models.GetInstallationTokenForRepo(repo)
 	if err != nil {
 		return 0, fmt.Errorf("error getting GH token %w", err)
 	}
@@ -47,8 +50,8 @@ func CreateDeployment(repo string, branch string, userId int) (int64, error) {
 	return out.ID, nil
 }
 
-func UpdateDeployment(repo string, depID int64, state string, message string, userID int) error {
-	token, _, err := GetGitHubAccessToken(userID)
+func UpdateDeployment(repo string, depID int64, state string, message string) error {
+	token, err := models.GetInstallationTokenForRepo(repo)
 	if err != nil {
 		return fmt.Errorf("error getting GH token %w", err)
 	}
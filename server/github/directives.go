@@ -0,0 +1,34 @@
+package github
+
+import "strings"
+
+// directives that can be put anywhere in the head commit message to change what a push does
+var (
+	skipDeployDirectives = []string{"[skip deploy]", "[mist skip]"}
+	noCacheDirectives    = []string{"[mist no-cache]"}
+)
+
+type CommitDirectives struct {
+	SkipDeploy bool
+	NoCache    bool
+	// the directives found in the message, as written in lowercase
+	Found []string
+}
+
+func ParseCommitDirectives(message string) CommitDirectives {
+	var d CommitDirectives
+	lower := strings.ToLower(message)
+	for _, directive := range skipDeployDirectives {
+		if strings.Contains(lower, directive) {
+			d.SkipDeploy = true
+			d.Found = append(d.Found, directive)
+		}
+	}
+	for _, directive := range noCacheDirectives {
+		if strings.Contains(lower, directive) {
+			d.NoCache = true
+			d.Found = append(d.Found, directive)
+		}
+	}
+	return d
+}
@@ -18,29 +18,26 @@ import (
 )
 
 func GetLatestCommit(appID, userID int64) (*models.LatestCommit, error) {
+	return GetLatestCommitOnBranch(appID, userID, "")
+}
+
+// same as GetLatestCommit, but looks at the given branch instead of the app's branch if one is passed
+func GetLatestCommitOnBranch(appID, userID int64, branchOverride string) (*models.LatestCommit, error) {
 	repoName, branch, err := models.GetAppRepoAndBranch(appID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch app repo: %w", err)
 	}
-
-	installationID, err := models.GetInstallationIDByUserID(userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch installation: %w", err)
-	}
-
-	appAppID, privateKey, err := models.GetGithubAppIDAndPrivateKey()
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch GitHub App credentials: %w", err)
-	}
-
-	jwtToken, err := generateAppJWTManual(appAppID, privateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create GitHub App JWT: %w", err)
+	if branchOverride != "" {
+		branch = branchOverride
 	}
 
-	accessToken, err := getInstallationAccessToken(installationID, jwtToken)
+	accessToken, err := models.GetInstallationTokenForRepo(repoName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get installation token: %w", err)
+		// repo owner unknown to mist, fall back to the user's own installation
+		accessToken, err = userInstallationAccessToken(userID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	url := fmt.Sprintf("https://api.github.com/repos/%s/commits/%s", repoName, branch)
@@ -82,6 +79,29 @@ func GetLatestCommit(appID, userID int64) (*models.LatestCommit, error) {
 	}, nil
 }
 
+func userInstallationAccessToken(userID int64) (string, error) {
+	installationID, err := models.GetInstallationIDByUserID(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch installation: %w", err)
+	}
+
+	appAppID, privateKey, err := models.GetGithubAppIDAndPrivateKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch GitHub App credentials: %w", err)
+	}
+
+	jwtToken, err := generateAppJWTManual(appAppID, privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GitHub App JWT: %w", err)
+	}
+
+	accessToken, err := getInstallationAccessToken(installationID, jwtToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to get installation token: %w", err)
+	}
+	return accessToken, nil
+}
+
 func generateAppJWTManual(appID int64, privateKeyPEM string) (string, error) {
 	now := time.Now().Unix()
 	header := map[string]string{
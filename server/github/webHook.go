@@ -2,6 +2,7 @@ package github
 
 import (
 	"errors"
+	"slices"
 	"strings"
 
 	"github.com/corecollectives/mist/models"
@@ -9,55 +10,222 @@ import (
 	"gorm.io/gorm"
 )
 
-func CreateDeploymentFromGithubPushEvent(evt PushEvent) (int64, error) {
+// github only includes the first 20 commits of a push in the payload
+const maxPushEventCommits = 20
+
+// collects every added, modified and removed file in the push, the second return value
+// is false when the payload doesn't carry enough information to filter on (truncated
+// commit list, branch creation without commits, tag pushes, ...)
+func changedFilesFromPushEvent(evt PushEvent) ([]string, bool) {
+	// a tag push carries no commits, its head commit is only the tagged one and says nothing
+	// about what changed since the last tag
+	if strings.HasPrefix(evt.Ref, "refs/tags/") {
+		return nil, false
+	}
+	commits := evt.Commits
+	if len(commits) == 0 && evt.HeadCommit.ID != "" {
+		commits = []Commit{evt.HeadCommit}
+	}
+	if len(commits) == 0 || len(commits) >= maxPushEventCommits {
+		return nil, false
+	}
+
+	seen := make(map[string]bool)
+	files := []string{}
+	for _, c := range commits {
+		for _, list := range [][]string{c.Added, c.Modified, c.Removed} {
+			for _, f := range list {
+				if !seen[f] {
+					seen[f] = true
+					files = append(files, f)
+				}
+			}
+		}
+	}
+	return files, true
+}
+
+type PushEventResult struct {
+	// every app whose trigger rule matched, including the ones which were skipped
+	AppIDs        []int64
+	DeploymentIDs []int64
+}
+
+// creates a deployment for every app whose trigger rule matches the pushed branch or tag,
+// apps whose watch paths don't match any of the changed files are skipped
+func CreateDeploymentFromGithubPushEvent(evt PushEvent) (*PushEventResult, error) {
 	repoName := evt.Repository.FullName
-	branch := evt.Ref
+	ref := evt.Ref
 	commit := evt.After
 
-	branch = strings.TrimPrefix(branch, "refs/heads/")
-
 	log.Info().
 		Str("repo", repoName).
-		Str("branch", branch).
+		Str("ref", ref).
 		Str("commit", commit).
 		Msg("Push event received")
 
-	appID, err := models.FindApplicationIDByGitRepoAndBranch(repoName, branch)
+	if evt.Deleted {
+		log.Info().
+			Str("repo", repoName).
+			Str("ref", ref).
+			Msg("Ignoring push event for deleted ref")
+		return &PushEventResult{}, nil
+	}
 
+	apps, err := models.FindApplicationsByGitRepoAndRef(repoName, ref)
 	if err != nil {
 		log.Error().Err(err).
 			Str("repo", repoName).
-			Str("branch", branch).
+			Str("ref", ref).
 			Msg("Error finding application")
-		return 0, err
+		return nil, err
 	}
 
-	if appID == 0 {
+	// apps using this repository as an extra repository, only for branches and only with auto deploy on
+	var extraApps []models.App
+	var extraRepos []models.AppRepositories
+	if branch, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+		repos, err := models.FindAutoDeployAppRepositories(repoName, branch)
+		if err != nil {
+			log.Error().Err(err).
+				Str("repo", repoName).
+				Str("ref", ref).
+				Msg("Error finding app repositories")
+			return nil, err
+		}
+		for _, repo := range repos {
+			if slices.ContainsFunc(apps, func(a models.App) bool { return a.ID == repo.AppID }) ||
+				slices.ContainsFunc(extraApps, func(a models.App) bool { return a.ID == repo.AppID }) {
+				continue
+			}
+			app, err := models.GetApplicationByID(repo.AppID)
+			if err != nil {
+				log.Error().Err(err).Int64("app_id", repo.AppID).Msg("Error getting application")
+				continue
+			}
+			extraApps = append(extraApps, *app)
+			extraRepos = append(extraRepos, repo)
+		}
+	}
+
+	if len(apps) == 0 && len(extraApps) == 0 {
+		// tags are pushed all the time without any app caring about them
+		if strings.HasPrefix(ref, "refs/tags/") {
+			log.Info().
+				Str("repo", repoName).
+				Str("ref", ref).
+				Msg("No application has a tag trigger matching this tag")
+			return &PushEventResult{}, nil
+		}
 		log.Warn().
 			Str("repo", repoName).
-			Str("branch", branch).
+			Str("ref", ref).
 			Msg("No application found for this repository and branch")
-		return 0, errors.New("no application found for this repository and branch")
+		return nil, errors.New("no application found for this repository and branch")
 	}
 
-	app, err := models.GetApplicationByID(appID)
-	if err != nil {
-		log.Error().Err(err).
-			Int64("app_id", appID).
-			Msg("Error getting application")
-		return 0, err
+	changedFiles, filesKnown := changedFilesFromPushEvent(evt)
+
+	result := &PushEventResult{}
+	var firstErr error
+	handle := func(app *models.App, extraRepo *models.AppRepositories) {
+		result.AppIDs = append(result.AppIDs, app.ID)
+		depID, err := createDeploymentForPush(app, extraRepo, evt, changedFiles, filesKnown)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		if depID != 0 {
+			result.DeploymentIDs = append(result.DeploymentIDs, depID)
+		}
+	}
+	for i := range apps {
+		handle(&apps[i], nil)
+	}
+	for i := range extraApps {
+		handle(&extraApps[i], &extraRepos[i])
+	}
+
+	// only fail the webhook if nothing could be handled, otherwise one broken app
+	// would make github retry deployments for all the others
+	if len(result.DeploymentIDs) == 0 && firstErr != nil {
+		return result, firstErr
+	}
+	return result, nil
+}
+
+// extraRepo is set when the push is for one of the app's extra repositories instead of its own
+func createDeploymentForPush(app *models.App, extraRepo *models.AppRepositories, evt PushEvent, changedFiles []string, filesKnown bool) (int64, error) {
+	appID := app.ID
+	repoName := evt.Repository.FullName
+	ref := evt.Ref
+	commit := evt.After
+
+	var branch, tag string
+	if t, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+		tag = t
+		// for annotated tags `after` is the sha of the tag object, head_commit is the tagged commit
+		if evt.HeadCommit.ID != "" {
+			commit = evt.HeadCommit.ID
+		}
+	} else {
+		branch = strings.TrimPrefix(ref, "refs/heads/")
 	}
 
 	if app.DeploymentStrategy == models.DeploymentManual {
 		log.Info().
 			Int64("app_id", appID).
 			Str("repo", repoName).
-			Str("branch", branch).
+			Str("ref", ref).
 			Msg("Skipping automatic deployment - deployment strategy is set to manual")
 		return 0, nil
 	}
 
-	dep, err := models.GetDeploymentByAppIDAndCommitHash(appID, commit)
+	directives := ParseCommitDirectives(evt.HeadCommit.Message)
+	if directives.SkipDeploy {
+		log.Info().
+			Int64("app_id", appID).
+			Str("repo", repoName).
+			Str("ref", ref).
+			Str("commit", commit).
+			Msg("Skipping automatic deployment - skip directive in commit message")
+		models.LogWebhookAudit("skip", "application", &appID, map[string]interface{}{
+			"reason":      "skip directive in commit message",
+			"directives":  directives.Found,
+			"commit_hash": commit,
+			"repository":  repoName,
+			"ref":         ref,
+			"pusher":      evt.Pusher.Name,
+		})
+		return 0, nil
+	}
+
+	// watch paths are relative to the app's own repository
+	if extraRepo == nil && filesKnown && !app.MatchesChangedFiles(changedFiles) {
+		log.Info().
+			Int64("app_id", appID).
+			Str("repo", repoName).
+			Str("ref", ref).
+			Str("commit", commit).
+			Int("changed_files", len(changedFiles)).
+			Msg("Skipping automatic deployment - no changes in watch paths")
+		models.LogWebhookAudit("skip", "application", &appID, map[string]interface{}{
+			"reason":        "no changes in watch paths",
+			"commit_hash":   commit,
+			"repository":    repoName,
+			"ref":           ref,
+			"pusher":        evt.Pusher.Name,
+			"watch_paths":   app.EffectiveWatchPaths(),
+			"ignore_paths":  app.IgnorePaths,
+			"changed_files": len(changedFiles),
+		})
+		return 0, nil
+	}
+
+	// tagging an already deployed commit is the usual release flow, so duplicates are per ref
+	dep, err := models.GetDeploymentByAppIDRefAndCommitHash(appID, ref, commit)
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		log.Error().Err(err).
 			Int64("app_id", appID).
@@ -69,8 +237,9 @@ func CreateDeploymentFromGithubPushEvent(evt PushEvent) (int64, error) {
 		log.Warn().
 			Int64("dep_id", dep.ID).
 			Int64("app_id", appID).
+			Str("ref", ref).
 			Str("commit", commit).
-			Msg("Deployment already exists for this commit, skipping duplicate")
+			Msg("Deployment already exists for this ref and commit, skipping duplicate")
 		return 0, nil
 	}
 
@@ -79,6 +248,15 @@ func CreateDeploymentFromGithubPushEvent(evt PushEvent) (int64, error) {
 		AppID:         appID,
 		CommitHash:    commit,
 		CommitMessage: &commitMsg,
+		Ref:           &ref,
+		NoCache:       directives.NoCache,
+	}
+	if extraRepo != nil {
+		commitMsg = repoName + ": " + commitMsg
+		deployment.SourceRepository = &repoName
+	} else if branch != "" && branch != app.GitBranch {
+		// pattern triggers can fire for branches other than the app's own
+		deployment.Branch = &branch
 	}
 
 	if err := deployment.CreateDeployment(); err != nil {
@@ -91,6 +269,7 @@ func CreateDeploymentFromGithubPushEvent(evt PushEvent) (int64, error) {
 	log.Info().
 		Int64("deployment_id", deployment.ID).
 		Int64("app_id", appID).
+		Str("ref", ref).
 		Msg("Deployment created from GitHub webhook")
 
 	models.LogWebhookAudit("create", "deployment", &deployment.ID, map[string]interface{}{
@@ -98,10 +277,14 @@ func CreateDeploymentFromGithubPushEvent(evt PushEvent) (int64, error) {
 		"commit_hash":    commit,
 		"commit_message": evt.HeadCommit.Message,
 		"repository":     repoName,
+		"ref":            ref,
 		"branch":         branch,
+		"tag":            tag,
 		"pusher":         evt.Pusher.Name,
+		"no_cache":       directives.NoCache,
+		"directives":     directives.Found,
+		"extra_repo":     extraRepo != nil,
 	})
 
 	return deployment.ID, nil
-
 }
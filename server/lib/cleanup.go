@@ -21,9 +21,33 @@ func CleanupOnStartup() error {
 	if err != nil {
 		return err
 	}
+	cleanupWebhookDeliveries()
 	return nil
 }
 
+// deliveries keep coming in while mist runs, so the pruning repeats daily and not only on startup
+func StartWebhookDeliveryCleanup() {
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			cleanupWebhookDeliveries()
+		}
+	}()
+}
+
+// webhook deliveries keep the full payload around, so only the last month is kept
+func cleanupWebhookDeliveries() {
+	deleted, err := models.DeleteWebhookDeliveriesBefore(time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to prune old webhook deliveries")
+		return
+	}
+	if deleted > 0 {
+		log.Info().Int64("count", deleted).Msg("Pruned old webhook deliveries")
+	}
+}
+
 // checks for all pending deployments which couldn't be completed because of server crash or something
 // which lead mist to stop
 func cleanupDeployments() error {
@@ -42,9 +66,9 @@ func cleanupDeployments() error {
 	errorMsg := "system died before deployment could complete"
 	for _, dep := range deployments {
 
-		// if deployment was in deploying/ building phase, we force fail them as they can't be continued
+		// if deployment was in deploying/ building/ extracting phase, we force fail them as they can't be continued
 		// from here
-		if dep.Status == "deploying" || dep.Status == "building" {
+		if dep.Status == "deploying" || dep.Status == "building" || dep.Status == models.DeploymentStatusExtracting {
 			log.Warn().
 				Int64("deployment_id", dep.ID).
 				Str("status", string(dep.Status)).
@@ -55,6 +79,7 @@ func cleanupDeployments() error {
 				log.Error().Err(err).Int64("deployment_id", dep.ID).Msg("Failed to mark deployment as failed")
 				return err
 			}
+			queue.RemoveSourceArchive(dep.ID)
 			// if deployment was pending, i.e. it was sitting in queue waiting for its turn, then we can
 			// continue from here and put it back in the queue for re-deployment
 		} else if dep.Status == "pending" {
@@ -2,11 +2,13 @@ package main
 
 import (
 	"github.com/corecollectives/mist/api"
+	"github.com/corecollectives/mist/compose"
 	"github.com/corecollectives/mist/db"
 	"github.com/corecollectives/mist/lib"
 	"github.com/corecollectives/mist/models"
 	"github.com/corecollectives/mist/queue"
 	"github.com/corecollectives/mist/store"
+	"github.com/corecollectives/mist/traefik"
 	"github.com/corecollectives/mist/utils"
 	"github.com/rs/zerolog/log"
 )
@@ -40,6 +42,8 @@ func main() {
 	if err := lib.CleanupOnStartup(); err != nil {
 		log.Warn().Err(err).Msg("Failed to check pending updates and deployments")
 	}
+	lib.StartWebhookDeliveryCleanup()
+	compose.ResolveLegacyProjects()
 
 	// TODO: extend the store to contain more configurations for fast access
 	err = store.InitStore()
@@ -58,5 +62,11 @@ func main() {
 			log.Info().Msg("Traefik configuration initialized successfully")
 		}
 	}
+	// app routing files are regenerated from the db, this covers apps routed by labels before and
+	// files left behind by deleted apps
+	traefik.EnsureStaticConfig()
+	traefik.RenderAllApps()
+	traefik.StartSSLMonitor()
+	traefik.StartDomainMonitor()
 	api.InitApiServer()
 }
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type ipRuleAction string
+
+const (
+	IPRuleAllow ipRuleAction = "allow"
+	IPRuleDeny  ipRuleAction = "deny"
+)
+
+// basic auth credentials in front of an app, a nil DomainID applies them to every domain of the app
+type AccessUser struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	AppID        int64     `gorm:"index;not null;constraint:OnDelete:CASCADE" json:"appId"`
+	DomainID     *int64    `gorm:"index" json:"domainId,omitempty"`
+	Username     string    `gorm:"not null" json:"username"`
+	PasswordHash string    `gorm:"not null" json:"-"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// an ip or cidr range allowed or denied in front of an app, scoped like AccessUser
+type AccessIPRule struct {
+	ID          int64        `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	AppID       int64        `gorm:"index;not null;constraint:OnDelete:CASCADE" json:"appId"`
+	DomainID    *int64       `gorm:"index" json:"domainId,omitempty"`
+	Action      ipRuleAction `gorm:"not null" json:"action"`
+	Source      string       `gorm:"not null" json:"source"`
+	Description string       `json:"description"`
+	CreatedAt   time.Time    `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func GetAccessUsersByAppID(appID int64) ([]AccessUser, error) {
+	var users []AccessUser
+	err := db.Where("app_id = ?", appID).Order("created_at ASC").Find(&users).Error
+	return users, err
+}
+
+func GetAccessUserByID(id int64) (*AccessUser, error) {
+	var u AccessUser
+	err := db.First(&u, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// true when the username is already taken in the same scope
+func AccessUserExists(appID int64, domainID *int64, username string) (bool, error) {
+	var count int64
+	query := db.Model(&AccessUser{}).Where("app_id = ? AND username = ?", appID, username)
+	if domainID == nil {
+		query = query.Where("domain_id IS NULL")
+	} else {
+		query = query.Where("domain_id = ?", *domainID)
+	}
+	err := query.Count(&count).Error
+	return count > 0, err
+}
+
+// the password is only kept as a bcrypt hash, which traefik's basicAuth checks directly
+func CreateAccessUser(appID int64, domainID *int64, username, password string) (*AccessUser, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	u := &AccessUser{
+		AppID:        appID,
+		DomainID:     domainID,
+		Username:     username,
+		PasswordHash: string(hash),
+	}
+	if err := db.Create(u).Error; err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func UpdateAccessUserPassword(id int64, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return db.Model(&AccessUser{}).Where("id = ?", id).Update("password_hash", string(hash)).Error
+}
+
+func DeleteAccessUser(id int64) error {
+	return db.Delete(&AccessUser{}, id).Error
+}
+
+func GetAccessIPRulesByAppID(appID int64) ([]AccessIPRule, error) {
+	var rules []AccessIPRule
+	err := db.Where("app_id = ?", appID).Order("created_at ASC").Find(&rules).Error
+	return rules, err
+}
+
+func GetAccessIPRuleByID(id int64) (*AccessIPRule, error) {
+	var rule AccessIPRule
+	err := db.First(&rule, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func CreateAccessIPRule(rule *AccessIPRule) error {
+	return db.Create(rule).Error
+}
+
+func DeleteAccessIPRule(id int64) error {
+	return db.Delete(&AccessIPRule{}, id).Error
+}
+
+// rules scoped to a domain go with it
+func deleteDomainAccessRules(tx *gorm.DB, domainID int64) error {
+	if err := tx.Where("domain_id = ?", domainID).Delete(&AccessUser{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("domain_id = ?", domainID).Delete(&AccessIPRule{}).Error
+}
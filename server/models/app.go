@@ -2,15 +2,20 @@ package models
 
 import (
 	"fmt"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/corecollectives/mist/utils"
+	"gorm.io/gorm"
 )
 
 type DeploymentStrategy string
 type AppStatus string
 type AppType string
 type RestartPolicy string
+type TriggerType string
+type SupersedePolicy string
 
 const (
 	DeploymentAuto   DeploymentStrategy = "auto"
@@ -26,11 +31,27 @@ const (
 	AppTypeService  AppType = "service"
 	AppTypeDatabase AppType = "database"
 	AppTypeCompose  AppType = "compose"
+	// no container of its own, the build output is served by the shared static file server
+	AppTypeStatic AppType = "static"
 
 	RestartPolicyNo            RestartPolicy = "no"
 	RestartPolicyAlways        RestartPolicy = "always"
 	RestartPolicyOnFailure     RestartPolicy = "on-failure"
 	RestartPolicyUnlessStopped RestartPolicy = "unless-stopped"
+
+	// exact match on GitBranch (the original behaviour)
+	TriggerBranch TriggerType = "branch"
+	// glob on the branch name, eg. `release/*`
+	TriggerBranchPattern TriggerType = "branch_pattern"
+	// glob on the tag name, eg. `v*`
+	TriggerTag TriggerType = "tag"
+
+	// every queued deployment runs, in order
+	SupersedeNone SupersedePolicy = "none"
+	// a new deployment cancels the ones still waiting in the queue
+	SupersedePending SupersedePolicy = "pending"
+	// same as pending, and also aborts the one currently building
+	SupersedeRunning SupersedePolicy = "running"
 )
 
 type App struct {
@@ -45,13 +66,24 @@ type App struct {
 	GitRepository       *string            `json:"git_repository,omitempty"`
 	GitBranch           string             `gorm:"default:'main'" json:"git_branch,omitempty"`
 	GitCloneURL         *string            `json:"git_clone_url,omitempty"`
+	TriggerType         TriggerType        `gorm:"default:'branch'" json:"trigger_type"`
+	TriggerPattern      *string            `json:"trigger_pattern,omitempty"`
 	DeploymentStrategy  DeploymentStrategy `gorm:"default:'auto'" json:"deployment_strategy"`
+	SupersedePolicy     SupersedePolicy    `gorm:"default:'none'" json:"supersede_policy"`
 	Port                *int64             `json:"port,omitempty"`
 	ShouldExpose        *bool              `json:"shouldExpose,omitempty" gorm:"default:false"`
 	ExposePort          *int64             `json:"exposePort,omitempty"`
 	RootDirectory       string             `gorm:"default:'.'" json:"root_directory,omitempty"`
+	WatchPathsString    string             `gorm:"column:watch_paths" json:"-"`
+	WatchPaths          []string           `gorm:"-" json:"watch_paths"`
+	IgnorePathsString   string             `gorm:"column:ignore_paths" json:"-"`
+	IgnorePaths         []string           `gorm:"-" json:"ignore_paths"`
 	BuildCommand        *string            `json:"build_command,omitempty"`
 	StartCommand        *string            `json:"start_command,omitempty"`
+	BuilderImage        *string            `json:"builder_image,omitempty"`
+	OutputDirectory     *string            `json:"output_directory,omitempty"`
+	ComposeDefinition   *string            `json:"compose_definition,omitempty"`
+	ComposeProject      string             `json:"-"`
 	DockerfilePath      *string            `gorm:"default:'DOCKERFILE'" json:"dockerfile_path,omitempty"`
 	CPULimit            *float64           `json:"cpu_limit,omitempty"`
 	MemoryLimit         *int               `json:"memory_limit,omitempty"`
@@ -61,8 +93,13 @@ type App struct {
 	HealthcheckTimeout  int                `gorm:"default:10" json:"healthcheck_timeout"`
 	HealthcheckRetries  int                `gorm:"default:3" json:"healthcheck_retries"`
 	Status              AppStatus          `gorm:"default:'stopped';index" json:"status"`
-	CreatedAt           time.Time          `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt           time.Time          `gorm:"autoUpdateTime" json:"updated_at"`
+	// traefik serves the maintenance page instead of the app while this is on and the error page
+	// whenever the container can't be reached, nil pages fall back to mist's defaults
+	MaintenanceMode bool      `gorm:"default:false" json:"maintenance_mode"`
+	MaintenancePage *string   `json:"-"`
+	ErrorPage       *string   `json:"-"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 func (a *App) ToJson() map[string]interface{} {
@@ -78,13 +115,21 @@ func (a *App) ToJson() map[string]interface{} {
 		"gitRepository":       a.GitRepository,
 		"gitBranch":           a.GitBranch,
 		"gitCloneUrl":         a.GitCloneURL,
+		"triggerType":         a.TriggerType,
+		"triggerPattern":      a.TriggerPattern,
 		"deploymentStrategy":  a.DeploymentStrategy,
+		"supersedePolicy":     a.SupersedePolicy,
 		"port":                a.Port,
 		"shouldExpose":        a.ShouldExpose,
 		"exposePort":          a.ExposePort,
 		"rootDirectory":       a.RootDirectory,
+		"watchPaths":          nonNilStrings(a.WatchPaths),
+		"ignorePaths":         nonNilStrings(a.IgnorePaths),
 		"buildCommand":        a.BuildCommand,
 		"startCommand":        a.StartCommand,
+		"builderImage":        a.BuilderImage,
+		"outputDirectory":     a.OutputDirectory,
+		"composeDefinition":   a.ComposeDefinition,
 		"dockerfilePath":      a.DockerfilePath,
 		"cpuLimit":            a.CPULimit,
 		"memoryLimit":         a.MemoryLimit,
@@ -94,11 +139,82 @@ func (a *App) ToJson() map[string]interface{} {
 		"healthcheckTimeout":  a.HealthcheckTimeout,
 		"healthcheckRetries":  a.HealthcheckRetries,
 		"status":              a.Status,
+		"maintenanceMode":     a.MaintenanceMode,
 		"createdAt":           a.CreatedAt,
 		"updatedAt":           a.UpdatedAt,
 	}
 }
 
+func (a *App) BeforeSave(tx *gorm.DB) (err error) {
+	a.WatchPathsString = strings.Join(a.WatchPaths, ",")
+	a.IgnorePathsString = strings.Join(a.IgnorePaths, ",")
+	return
+}
+
+func (a *App) AfterFind(tx *gorm.DB) (err error) {
+	a.WatchPaths = splitPatterns(a.WatchPathsString)
+	a.IgnorePaths = splitPatterns(a.IgnorePathsString)
+	return
+}
+
+func splitPatterns(s string) []string {
+	patterns := []string{}
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// include patterns used to decide if a push touches this app, when none are
+// configured everything under the root directory is watched
+func (a *App) EffectiveWatchPaths() []string {
+	if len(a.WatchPaths) > 0 {
+		return a.WatchPaths
+	}
+	root := strings.Trim(path.Clean("/"+strings.TrimSpace(a.RootDirectory)), "/")
+	if root == "" {
+		return []string{"**"}
+	}
+	return []string{root + "/**"}
+}
+
+// reports whether any of the changed files (paths relative to the repo root) is
+// matched by the include patterns and not by any of the exclude patterns
+func (a *App) MatchesChangedFiles(files []string) bool {
+	include := a.EffectiveWatchPaths()
+	for _, file := range files {
+		matched := false
+		for _, pattern := range include {
+			if utils.MatchGlob(pattern, file) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		for _, pattern := range a.IgnorePaths {
+			if utils.MatchGlob(pattern, file) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *App) InsertInDB() error {
 	a.ID = utils.GenerateRandomId()
 	if a.AppType == "" {
@@ -113,6 +229,12 @@ func (a *App) InsertInDB() error {
 	if a.Status == "" {
 		a.Status = StatusStopped
 	}
+	if a.TriggerType == "" {
+		a.TriggerType = TriggerBranch
+	}
+	if a.SupersedePolicy == "" {
+		a.SupersedePolicy = SupersedeNone
+	}
 
 	return db.Create(a).Error
 }
@@ -134,14 +256,64 @@ func GetApplicationByID(appId int64) (*App, error) {
 
 func (a *App) UpdateApplication() error {
 	return db.Model(a).Select("Name", "Description", "AppType", "TemplateName",
-		"GitProviderID", "GitRepository", "GitBranch", "GitCloneURL",
-		"DeploymentStrategy", "Port", "ShouldExpose", "ExposePort", "RootDirectory",
-		"BuildCommand", "StartCommand", "DockerfilePath",
+		"GitProviderID", "GitRepository", "GitBranch", "GitCloneURL", "TriggerType", "TriggerPattern",
+		"DeploymentStrategy", "SupersedePolicy", "Port", "ShouldExpose", "ExposePort", "RootDirectory",
+		"WatchPathsString", "IgnorePathsString",
+		"BuildCommand", "StartCommand", "BuilderImage", "OutputDirectory", "DockerfilePath",
 		"CPULimit", "MemoryLimit", "RestartPolicy",
 		"HealthcheckPath", "HealthcheckInterval", "HealthcheckTimeout", "HealthcheckRetries",
 		"Status", "UpdatedAt").Updates(a).Error
 }
 
+// compose yaml pasted in the app settings is deployed instead of a compose file from the repository
+func (a *App) HasInlineCompose() bool {
+	return a.AppType == AppTypeCompose && a.ComposeDefinition != nil && strings.TrimSpace(*a.ComposeDefinition) != ""
+}
+
+// nil or blank switches the app back to the compose file in its repository
+func UpdateAppComposeDefinition(appID int64, definition *string) error {
+	if definition != nil && strings.TrimSpace(*definition) == "" {
+		definition = nil
+	}
+	return db.Model(&App{}).Where("id = ?", appID).Update("compose_definition", definition).Error
+}
+
+func GetAppComposeProject(appID int64) (string, error) {
+	var app App
+	err := db.Select("compose_project").First(&app, "id = ?", appID).Error
+	return app.ComposeProject, err
+}
+
+func UpdateAppComposeProject(appID int64, project string) error {
+	return db.Model(&App{}).Where("id = ?", appID).Update("compose_project", project).Error
+}
+
+// a compose project name belongs to one app only, a shared name would let one app's `down` take
+// the other's containers with it
+func ComposeProjectUsedByOtherApp(project string, appID int64) (bool, error) {
+	var count int64
+	err := db.Model(&App{}).Where("compose_project = ? AND id <> ?", project, appID).Count(&count).Error
+	return count > 0, err
+}
+
+// compose apps still running under `mist-app-<id>` or whose old project hasn't been resolved yet
+func GetComposeAppsWithoutProject() ([]App, error) {
+	var apps []App
+	err := db.Where("app_type = ? AND (compose_project IS NULL OR compose_project = '')", AppTypeCompose).Find(&apps).Error
+	return apps, err
+}
+
+// the project name compose derives from a directory name when no name is given
+func NormalizeComposeProjectName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimLeft(b.String(), "-_")
+}
+
 func IsUserApplicationOwner(userId int64, appId int64) (bool, error) {
 	var count int64
 	err := db.Model(&App{}).
@@ -151,16 +323,67 @@ func IsUserApplicationOwner(userId int64, appId int64) (bool, error) {
 	return count > 0, err
 }
 
-func FindApplicationIDByGitRepoAndBranch(gitRepo string, gitBranch string) (int64, error) {
-	var app App
-	err := db.Select("id").
-		Where("git_repository = ? AND git_branch = ?", gitRepo, gitBranch).
-		First(&app).Error
+// reports whether a pushed ref (`refs/heads/<branch>` or `refs/tags/<tag>`) matches the app's trigger rule
+func (a *App) MatchesRef(ref string) bool {
+	pattern := ""
+	if a.TriggerPattern != nil {
+		pattern = strings.TrimSpace(*a.TriggerPattern)
+	}
 
-	if err != nil {
-		return 0, err
+	switch a.TriggerType {
+	case TriggerTag:
+		tag, ok := strings.CutPrefix(ref, "refs/tags/")
+		return ok && pattern != "" && utils.MatchGlob(pattern, tag)
+	case TriggerBranchPattern:
+		branch, ok := strings.CutPrefix(ref, "refs/heads/")
+		return ok && pattern != "" && utils.MatchGlob(pattern, branch)
+	default:
+		branch, ok := strings.CutPrefix(ref, "refs/heads/")
+		return ok && branch == a.GitBranch
+	}
+}
+
+// returns every app on the repository whose trigger rule matches the pushed ref,
+// a monorepo can back several apps, each with its own watch paths
+func FindApplicationsByGitRepoAndRef(gitRepo string, ref string) ([]App, error) {
+	var apps []App
+	if err := db.Where("git_repository = ?", gitRepo).Find(&apps).Error; err != nil {
+		return nil, err
+	}
+
+	matched := []App{}
+	for _, app := range apps {
+		// pushes don't change what an inline compose app deploys
+		if app.HasInlineCompose() {
+			continue
+		}
+		if app.MatchesRef(ref) {
+			matched = append(matched, app)
+		}
+	}
+	return matched, nil
+}
+
+// nil or blank pages go back to the defaults
+func UpdateAppMaintenance(appID int64, enabled bool, maintenancePage, errorPage *string) error {
+	if maintenancePage != nil && strings.TrimSpace(*maintenancePage) == "" {
+		maintenancePage = nil
+	}
+	if errorPage != nil && strings.TrimSpace(*errorPage) == "" {
+		errorPage = nil
 	}
-	return app.ID, nil
+	return db.Model(&App{}).Where("id = ?", appID).Updates(map[string]interface{}{
+		"maintenance_mode": enabled,
+		"maintenance_page": maintenancePage,
+		"error_page":       errorPage,
+	}).Error
+}
+
+// apps with at least one domain, the ones traefik routes to
+func GetRoutedApps() ([]App, error) {
+	var apps []App
+	err := db.Where("id IN (?)", db.Model(&Domain{}).Select("app_id")).Find(&apps).Error
+	return apps, err
 }
 
 func GetUserIDByAppID(appID int64) (*int64, error) {
@@ -235,15 +458,13 @@ func GetAppCloneURL(appID int64, userID int64) (string, string, bool, error) {
 	if gitCloneURL != nil && *gitCloneURL != "" {
 		var accessToken string
 		if gitProviderID != nil {
-			token, _, needsRefresh, err := GetGitProviderAccessToken(*gitProviderID)
-			if err != nil {
-				// try to get GitHub access token as fallback
-				_, err := GetInstallationIDByUserID(userID)
-				if err == nil {
-					installation, err := GetInstallationByUserID(int(userID))
-					if err == nil {
-						accessToken = installation.AccessToken
-					}
+			token, provider, needsRefresh, err := GetGitProviderAccessToken(*gitProviderID)
+			if err != nil || provider == GitProviderGitHub {
+				// github tokens come from the installation owning the repo, not from whoever created the app
+				if repoToken := githubRepoAccessToken(gitRepository, userID); repoToken != "" {
+					accessToken = repoToken
+				} else if err == nil {
+					accessToken = token
 				}
 			} else {
 				// Check if token needs refresh
@@ -265,16 +486,7 @@ func GetAppCloneURL(appID int64, userID int64) (string, string, bool, error) {
 	if gitRepository != nil && *gitRepository != "" {
 		// assume GitHub and construct the clone URL
 		cloneURL := fmt.Sprintf("https://github.com/%s.git", *gitRepository)
-
-		// ary to get access token from GitHub installation
-		var accessToken string
-		_, err := GetInstallationIDByUserID(userID)
-		if err == nil {
-			installation, err := GetInstallationByUserID(int(userID))
-			if err == nil {
-				accessToken = installation.AccessToken
-			}
-		}
+		accessToken := githubRepoAccessToken(gitRepository, userID)
 
 		// mark that we should migrate this app's data
 		return cloneURL, accessToken, true, nil
@@ -283,6 +495,21 @@ func GetAppCloneURL(appID int64, userID int64) (string, string, bool, error) {
 	return "", "", false, fmt.Errorf("app has no git repository or clone URL configured")
 }
 
+// resolves the installation from the repository owner first, the user's own installation is only
+// a fallback for repos whose account isn't known to mist yet
+func githubRepoAccessToken(gitRepository *string, userID int64) string {
+	if gitRepository != nil && *gitRepository != "" {
+		if token, err := GetInstallationTokenForRepo(*gitRepository); err == nil {
+			return token
+		}
+	}
+	installation, err := GetInstallationByUserID(int(userID))
+	if err == nil {
+		return installation.AccessToken
+	}
+	return ""
+}
+
 func GetCloneUrlfromAppID(appID int64) (*string, error) {
 	var result struct {
 		GitCloneURL *string `gorm:"column:git_clone_url"`
@@ -1,7 +1,12 @@
 package models
 
 import (
+	"fmt"
+	"path"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type AppRepositorySourceType string
@@ -11,6 +16,8 @@ const (
 	SourceGithubApp   AppRepositorySourceType = "github_app"
 )
 
+// extra repositories an app builds from, each one is cloned into `Path` inside the build context
+// after the app's own repository, eg. a shared proto or config repo
 type AppRepositories struct {
 	ID           int64                   `gorm:"primaryKey;autoIncrement:true" json:"id"`
 	AppID        int64                   `gorm:"uniqueIndex:idx_app_repo_unique;not null;constraint:OnDelete:CASCADE" json:"app_id"`
@@ -19,7 +26,118 @@ type AppRepositories struct {
 	RepoFullName string                  `gorm:"uniqueIndex:idx_app_repo_unique;not null" json:"repo_full_name"`
 	RepoURL      string                  `gorm:"not null" json:"repo_url"`
 	Branch       string                  `gorm:"default:'main'" json:"branch"`
+	Path         string                  `gorm:"not null;default:''" json:"path"`
 	WebhookID    int64                   `json:"webhook_id"`
 	AutoDeploy   bool                    `gorm:"default:false" json:"auto_deploy"`
 	LastSyncedAt *time.Time              `json:"last_synced_at,omitempty"`
 }
+
+func (r *AppRepositories) ToJson() map[string]interface{} {
+	return map[string]interface{}{
+		"id":           r.ID,
+		"appId":        r.AppID,
+		"sourceType":   r.SourceType,
+		"sourceId":     r.SourceID,
+		"repoFullName": r.RepoFullName,
+		"repoUrl":      r.RepoURL,
+		"branch":       r.Branch,
+		"path":         r.Path,
+		"autoDeploy":   r.AutoDeploy,
+		"lastSyncedAt": r.LastSyncedAt,
+	}
+}
+
+// the checkout path has to stay inside the build context and can't clash with the app's own .git
+func CleanAppRepositoryPath(p string) (string, error) {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if path.IsAbs(p) {
+		return "", fmt.Errorf("path must be relative to the build context")
+	}
+	cleaned := path.Clean(p)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("path must be a subdirectory of the build context")
+	}
+	if cleaned == ".git" || strings.HasPrefix(cleaned, ".git/") {
+		return "", fmt.Errorf("path cannot be inside .git")
+	}
+	return cleaned, nil
+}
+
+func GithubRepoCloneURL(repoFullName string) string {
+	return fmt.Sprintf("https://github.com/%s.git", repoFullName)
+}
+
+func (r *AppRepositories) InsertInDB() error {
+	if r.Branch == "" {
+		r.Branch = "main"
+	}
+	return db.Create(r).Error
+}
+
+func (r *AppRepositories) Update() error {
+	return db.Model(r).Select("SourceType", "SourceID", "RepoURL", "Branch", "Path", "AutoDeploy").Updates(r).Error
+}
+
+func GetAppRepositoriesByAppID(appID int64) ([]AppRepositories, error) {
+	var repos []AppRepositories
+	err := db.Where("app_id = ?", appID).Order("id ASC").Find(&repos).Error
+	return repos, err
+}
+
+func GetAppRepositoryByID(id int64) (*AppRepositories, error) {
+	var repo AppRepositories
+	err := db.First(&repo, "id = ?", id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &repo, nil
+}
+
+// extra repositories with auto deploy on which track the pushed branch
+func FindAutoDeployAppRepositories(repoFullName, branch string) ([]AppRepositories, error) {
+	var repos []AppRepositories
+	err := db.Where("repo_full_name = ? AND branch = ? AND auto_deploy = ?", repoFullName, branch, true).
+		Find(&repos).Error
+	return repos, err
+}
+
+func MarkAppRepositorySynced(id int64) error {
+	return db.Model(&AppRepositories{}).Where("id = ?", id).Update("last_synced_at", time.Now()).Error
+}
+
+func DeleteAppRepository(id int64) error {
+	return db.Delete(&AppRepositories{}, id).Error
+}
+
+// resolves the clone url and the token to authenticate it with, tokens are refreshed when expired
+func (r *AppRepositories) CloneCredentials() (string, string, error) {
+	switch r.SourceType {
+	case SourceGithubApp:
+		// the installation token is shared by the whole installation, it only ever goes to github
+		cloneURL := GithubRepoCloneURL(r.RepoFullName)
+		token, err := GetFreshInstallationToken(r.SourceID)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get installation token: %w", err)
+		}
+		return cloneURL, token, nil
+	case SourceGitProvider:
+		token, _, needsRefresh, err := GetGitProviderAccessToken(r.SourceID)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get git provider token: %w", err)
+		}
+		if needsRefresh {
+			if newToken, err := RefreshGitProviderToken(r.SourceID); err == nil {
+				token = newToken
+			}
+		}
+		return r.RepoURL, token, nil
+	default:
+		return "", "", fmt.Errorf("unknown repository source type: %s", r.SourceType)
+	}
+}
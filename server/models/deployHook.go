@@ -0,0 +1,158 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/corecollectives/mist/utils"
+	"gorm.io/gorm"
+)
+
+// a deploy hook is a secret url (`/api/hooks/deploy/<token>`) which lets external CI systems trigger
+// deployments of an app without a mist session, if a secret is set every request must be signed with it.
+// only a hash of the token is stored, like api tokens, so the url can only be shown when it is generated
+type DeployHook struct {
+	ID    int64 `gorm:"primaryKey;autoIncrement:false" json:"id"`
+	AppID int64 `gorm:"uniqueIndex;not null;constraint:OnDelete:CASCADE" json:"appId"`
+	// plain token, only set right after it was generated
+	Token       string     `gorm:"-" json:"-"`
+	TokenHash   string     `gorm:"column:token;uniqueIndex:idx_deploy_hooks_token;not null" json:"-"`
+	TokenPrefix string     `json:"tokenPrefix"`
+	Secret      *string    `json:"-"`
+	CreatedBy   int64      `gorm:"index" json:"createdBy"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	UsageCount  int        `gorm:"default:0" json:"usageCount"`
+	RotatedAt   *time.Time `json:"rotatedAt,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (h *DeployHook) ToJson() map[string]interface{} {
+	return map[string]interface{}{
+		"id":               h.ID,
+		"appId":            h.AppID,
+		"tokenPrefix":      h.TokenPrefix,
+		"signatureEnabled": h.SignatureEnabled(),
+		"createdBy":        h.CreatedBy,
+		"lastUsedAt":       h.LastUsedAt,
+		"usageCount":       h.UsageCount,
+		"rotatedAt":        h.RotatedAt,
+		"createdAt":        h.CreatedAt,
+		"updatedAt":        h.UpdatedAt,
+	}
+}
+
+// empty unless the token was just generated
+func (h *DeployHook) Path() string {
+	if h.Token == "" {
+		return ""
+	}
+	return "/api/hooks/deploy/" + h.Token
+}
+
+func (h *DeployHook) SignatureEnabled() bool {
+	return h.Secret != nil && *h.Secret != ""
+}
+
+func HashDeployHookToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func DeployHookTokenPrefix(token string) string {
+	return token[:min(len(token), 8)]
+}
+
+func (h *DeployHook) setToken(token string) {
+	h.Token = token
+	h.TokenHash = HashDeployHookToken(token)
+	h.TokenPrefix = DeployHookTokenPrefix(token)
+}
+
+func generateDeployHookToken() string {
+	return utils.GenerateRandomString(48)
+}
+
+func generateDeployHookSecret() string {
+	return utils.GenerateRandomString(64)
+}
+
+func CreateDeployHook(appID, userID int64, withSecret bool) (*DeployHook, error) {
+	hook := &DeployHook{
+		ID:        utils.GenerateRandomId(),
+		AppID:     appID,
+		CreatedBy: userID,
+	}
+	hook.setToken(generateDeployHookToken())
+	if withSecret {
+		secret := generateDeployHookSecret()
+		hook.Secret = &secret
+	}
+	if err := db.Create(hook).Error; err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func GetDeployHookByAppID(appID int64) (*DeployHook, error) {
+	var hook DeployHook
+	err := db.Where("app_id = ?", appID).First(&hook).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func GetDeployHookByToken(token string) (*DeployHook, error) {
+	var hook DeployHook
+	err := db.Where("token = ?", HashDeployHookToken(token)).First(&hook).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// rotating invalidates the old url immediately, the secret is rotated as well if signing is enabled
+func (h *DeployHook) Rotate() error {
+	now := time.Now()
+	h.setToken(generateDeployHookToken())
+	h.RotatedAt = &now
+	if h.SignatureEnabled() {
+		secret := generateDeployHookSecret()
+		h.Secret = &secret
+	}
+	return db.Model(h).Updates(map[string]interface{}{
+		"token":        h.TokenHash,
+		"token_prefix": h.TokenPrefix,
+		"secret":       h.Secret,
+		"rotated_at":   h.RotatedAt,
+	}).Error
+}
+
+func (h *DeployHook) SetSignature(enabled bool) error {
+	if enabled {
+		secret := generateDeployHookSecret()
+		h.Secret = &secret
+	} else {
+		h.Secret = nil
+	}
+	return db.Model(h).Update("secret", h.Secret).Error
+}
+
+func (h *DeployHook) MarkUsed() error {
+	return db.Model(h).Updates(map[string]interface{}{
+		"last_used_at": time.Now(),
+		"usage_count":  gorm.Expr("usage_count + ?", 1),
+	}).Error
+}
+
+func DeleteDeployHook(id int64) error {
+	return db.Delete(&DeployHook{}, id).Error
+}
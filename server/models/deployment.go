@@ -12,12 +12,15 @@ type DeploymentStatus string
 
 const (
 	DeploymentStatusPending    DeploymentStatus = "pending"
+	DeploymentStatusExtracting DeploymentStatus = "extracting"
 	DeploymentStatusBuilding   DeploymentStatus = "building"
 	DeploymentStatusDeploying  DeploymentStatus = "deploying"
 	DeploymentStatusSuccess    DeploymentStatus = "success"
 	DeploymentStatusFailed     DeploymentStatus = "failed"
 	DeploymentStatusStopped    DeploymentStatus = "stopped"
 	DeploymentStatusRolledBack DeploymentStatus = "rolled_back"
+	// replaced by a newer deployment of the same app before it could finish
+	DeploymentStatusSuperseded DeploymentStatus = "superseded"
 )
 
 type Deployment struct {
@@ -30,6 +33,29 @@ type Deployment struct {
 	CommitMessage *string `json:"commit_message,omitempty"`
 	CommitAuthor  *string `json:"commit_author,omitempty"`
 
+	// filled from the checked out commit, so manual deploys carry the same metadata as webhook ones
+	CommitTimestamp *time.Time `json:"commit_timestamp,omitempty"`
+	// eg. "3 files changed, 12 insertions(+), 4 deletions(-)"
+	ChangedFiles *string `json:"changed_files,omitempty"`
+
+	// overrides the app's branch for this deployment only
+	Branch *string `json:"branch,omitempty"`
+
+	// full git ref (refs/heads/... or refs/tags/...) of the push that triggered this deployment
+	Ref *string `json:"ref,omitempty"`
+
+	// set when the push came from one of the app's extra repositories, CommitHash then belongs to that repository
+	SourceRepository *string `json:"source_repository,omitempty"`
+
+	// uploaded archive to extract instead of cloning, CommitHash then holds the archive's sha256
+	SourceArchive *string `json:"source_archive,omitempty"`
+
+	// inline compose yaml as it was when the deployment was created, CommitHash then holds its sha256
+	ComposeDefinition *string `json:"compose_definition,omitempty"`
+
+	// build without the docker layer cache, set by the `[mist no-cache]` commit directive
+	NoCache bool `gorm:"default:false" json:"no_cache"`
+
 	GithubDepId *int64 `json:"github_dep_id,omitempty"`
 
 	TriggeredBy *int64 `gorm:"constraint:OnDelete:SET NULL" json:"triggered_by,omitempty"`
@@ -63,28 +89,36 @@ type Deployment struct {
 
 func (d *Deployment) ToJson() map[string]interface{} {
 	return map[string]interface{}{
-		"id":               d.ID,
-		"appId":            d.AppID,
-		"commitHash":       d.CommitHash,
-		"commitMessage":    d.CommitMessage,
-		"commitAuthor":     d.CommitAuthor,
-		"triggeredBy":      d.TriggeredBy,
-		"deploymentNumber": d.DeploymentNumber,
-		"containerId":      d.ContainerID,
-		"containerName":    d.ContainerName,
-		"imageTag":         d.ImageTag,
-		"logs":             d.Logs,
-		"buildLogsPath":    d.BuildLogsPath,
-		"status":           d.Status,
-		"stage":            d.Stage,
-		"progress":         d.Progress,
-		"errorMessage":     d.ErrorMessage,
-		"createdAt":        d.CreatedAt,
-		"startedAt":        d.StartedAt,
-		"finishedAt":       d.FinishedAt,
-		"duration":         d.Duration,
-		"isActive":         d.IsActive,
-		"rolledBackFrom":   d.RolledBackFrom,
+		"id":                d.ID,
+		"appId":             d.AppID,
+		"commitHash":        d.CommitHash,
+		"commitMessage":     d.CommitMessage,
+		"commitAuthor":      d.CommitAuthor,
+		"commitTimestamp":   d.CommitTimestamp,
+		"changedFiles":      d.ChangedFiles,
+		"branch":            d.Branch,
+		"ref":               d.Ref,
+		"sourceRepository":  d.SourceRepository,
+		"sourceArchive":     d.SourceArchive,
+		"composeDefinition": d.ComposeDefinition,
+		"noCache":           d.NoCache,
+		"triggeredBy":       d.TriggeredBy,
+		"deploymentNumber":  d.DeploymentNumber,
+		"containerId":       d.ContainerID,
+		"containerName":     d.ContainerName,
+		"imageTag":          d.ImageTag,
+		"logs":              d.Logs,
+		"buildLogsPath":     d.BuildLogsPath,
+		"status":            d.Status,
+		"stage":             d.Stage,
+		"progress":          d.Progress,
+		"errorMessage":      d.ErrorMessage,
+		"createdAt":         d.CreatedAt,
+		"startedAt":         d.StartedAt,
+		"finishedAt":        d.FinishedAt,
+		"duration":          d.Duration,
+		"isActive":          d.IsActive,
+		"rolledBackFrom":    d.RolledBackFrom,
 	}
 }
 
@@ -142,6 +176,28 @@ func GetDeploymentByAppIDAndCommitHash(appID int64, commitHash string) (*Deploym
 	}
 	return &deployment, nil
 }
+
+// the same commit can be deployed once per ref, e.g. as the branch head and again when it's tagged.
+// deployments from before refs were stored have none, they were pushes to the app's branch
+func GetDeploymentByAppIDRefAndCommitHash(appID int64, ref string, commitHash string) (*Deployment, error) {
+	var app App
+	if err := db.Select("git_branch").First(&app, "id = ?", appID).Error; err != nil {
+		return nil, err
+	}
+	query := db.Where("app_id = ? AND commit_hash = ?", appID, commitHash)
+	if ref == "refs/heads/"+app.GitBranch {
+		query = query.Where("ref = ? OR ref IS NULL", ref)
+	} else {
+		query = query.Where("ref = ?", ref)
+	}
+	var deployment Deployment
+	result := query.First(&deployment)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &deployment, nil
+}
+
 func GetActiveDeploymentByAppID(appID int64) (*Deployment, error) {
 	var deployment Deployment
 	err := db.Where("app_id = ? AND is_active = ?", appID, true).First(&deployment)
@@ -170,14 +226,13 @@ func UpdateDeploymentStatus(depID int64, status, stage string, progress int, err
 	if result.Error != nil {
 		return result.Error
 	}
-
 	updates := map[string]interface{}{
 		"status":        status,
 		"stage":         stage,
 		"progress":      progress,
 		"error_message": errorMsg,
 	}
-	if status == string(DeploymentStatusFailed) || status == string(DeploymentStatusSuccess) || status == string(DeploymentStatusStopped) {
+	if status == string(DeploymentStatusFailed) || status == string(DeploymentStatusSuccess) || status == string(DeploymentStatusStopped) || status == string(DeploymentStatusSuperseded) {
 		now := time.Now()
 		updates["finished_at"] = &now
 		if d.StartedAt != nil {
@@ -188,7 +243,13 @@ func UpdateDeploymentStatus(depID int64, status, stage string, progress int, err
 	if errorMsg != nil {
 		fmt.Println("updated dep status: ", *errorMsg)
 	}
-	return db.Model(d).Updates(updates).Error
+	// a superseded deployment is cancelled asynchronously and may still reach a later stage,
+	// superseded stays its final status. checked in the update itself so it can't be superseded in between
+	query := db.Model(&Deployment{}).Where("id = ?", depID)
+	if status != string(DeploymentStatusSuperseded) {
+		query = query.Where("status <> ?", DeploymentStatusSuperseded)
+	}
+	return query.Updates(updates).Error
 }
 func MarkDeploymentStarted(depID int64) error {
 	now := time.Now()
@@ -217,6 +278,33 @@ func UpdateContainerInfo(depID int64, containerID, containerName, imageTag strin
 	return db.Model(&Deployment{}).Where("id = ?", depID).Updates(updates).Error
 }
 
+// stores what was read from the checked out commit, message and author are only set when the deployment
+// doesn't have them yet since the webhook payload is the better source for those
+func UpdateDeploymentCommitInfo(depID int64, message, author *string, timestamp *time.Time, changedFiles *string) error {
+	var d Deployment
+	if err := db.Select("id", "commit_message", "commit_author").First(&d, "id = ?", depID).Error; err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{}
+	if message != nil && (d.CommitMessage == nil || *d.CommitMessage == "") {
+		updates["commit_message"] = message
+	}
+	if author != nil && (d.CommitAuthor == nil || *d.CommitAuthor == "") {
+		updates["commit_author"] = author
+	}
+	if timestamp != nil {
+		updates["commit_timestamp"] = timestamp
+	}
+	if changedFiles != nil {
+		updates["changed_files"] = changedFiles
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return db.Model(&Deployment{}).Where("id = ?", depID).Updates(updates).Error
+}
+
 func GetDeploymentStatus(depID int64) (string, error) {
 	var status string
 	result := db.Model(&Deployment{}).Select("status").Where("id = ?", depID).Scan(&status)
@@ -523,11 +611,24 @@ func GetDeploymentStatus(depID int64) (string, error) {
 //		_, err := db.Exec(query, containerID, containerName, imageTag, depID)
 //		return err
 //	}
+
+// deployments of the app created before `before` which haven't finished yet, either still waiting
+// in the queue or in one of the running stages
+func GetUnfinishedDeploymentsBefore(appID int64, before *Deployment) ([]Deployment, error) {
+	var deployments []Deployment
+	err := db.
+		Where("app_id = ? AND id <> ? AND created_at <= ?", appID, before.ID, before.CreatedAt).
+		Where("status IN ?", []string{"pending", "extracting", "cloning", "building", "deploying"}).
+		Order("created_at DESC").
+		Find(&deployments).Error
+	return deployments, err
+}
+
 func GetIncompleteDeployments() ([]Deployment, error) {
 	var deployments []Deployment
 
 	err := db.
-		Where("status IN ?", []string{"building", "deploying"}).
+		Where("status IN ?", []string{"extracting", "building", "deploying"}).
 		Order("created_at DESC").
 		Find(&deployments).Error
 
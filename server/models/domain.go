@@ -1,14 +1,20 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/corecollectives/mist/utils"
+	"gorm.io/gorm"
 )
 
 type sslStatus string
 type sslProvider string
 type acmeChallengeType string
+type verificationMethod string
 
 const (
 	SSLStatusPending  sslStatus = "pending"
@@ -16,6 +22,8 @@ const (
 	SSLStatusFailed   sslStatus = "failed"
 	SSLStatusDisabled sslStatus = "disabled"
 	SSLStatusExpired  sslStatus = "expired"
+	// the domain has no router, eg. a compose domain without a service, so no certificate is requested
+	SSLStatusNotRouted sslStatus = "not_routed"
 
 	SSLProvider       sslProvider = "letsencrypt"
 	SSLProviderCustom sslProvider = "custom"
@@ -24,6 +32,15 @@ const (
 	AcmeChallengeTypeHttp01    acmeChallengeType = "http-01"
 	AcmeChallengeTypeDns01     acmeChallengeType = "dns-01"
 	AcmeChallengeTypeTlsAlpn01 acmeChallengeType = "tls-alpn-01"
+
+	VerificationMethodDnsTxt verificationMethod = "dns-txt"
+	VerificationMethodHttp   verificationMethod = "http"
+	// below the system wildcard domain, which the admin already points at mist
+	VerificationMethodWildcard verificationMethod = "wildcard"
+	// another route on the same host in the same project was verified
+	VerificationMethodSharedHost verificationMethod = "shared-host"
+	// added before ownership was verified
+	VerificationMethodExisting verificationMethod = "existing"
 )
 
 type Domain struct {
@@ -31,7 +48,15 @@ type Domain struct {
 
 	AppID int64 `gorm:"index;not null;constraint:OnDelete:CASCADE" json:"appId"`
 
-	Domain string `gorm:"column:domain_name;uniqueIndex;not null" json:"domain"`
+	// several apps can share a host under different path prefixes, an empty prefix routes the whole host
+	Domain      string `gorm:"column:domain_name;uniqueIndex:idx_domains_host_path;not null" json:"domain"`
+	PathPrefix  string `gorm:"uniqueIndex:idx_domains_host_path;default:''" json:"pathPrefix"`
+	StripPrefix bool   `gorm:"default:false" json:"stripPrefix"`
+	Priority    int    `gorm:"default:0" json:"priority"`
+
+	// compose apps only, which service and container port the domain routes to
+	ComposeService *string `json:"composeService,omitempty"`
+	ComposePort    *int    `json:"composePort,omitempty"`
 
 	SslStatus   sslStatus   `gorm:"default:'pending';index" json:"sslStatus"`
 	SslProvider sslProvider `gorm:"default:'letsencrypt'" json:"sslProvider,omitempty"`
@@ -58,21 +83,48 @@ type Domain struct {
 	RedirectWww       bool `gorm:"default:false" json:"redirectWww"`
 	RedirectWwwToRoot bool `gorm:"default:true" json:"redirectWwwToRoot"`
 
+	// requests per second per client ip, 0 turns rate limiting off
+	RateLimitAverage int           `gorm:"default:0" json:"rateLimitAverage"`
+	RateLimitBurst   int           `gorm:"default:0" json:"rateLimitBurst"`
+	Headers          DomainHeaders `json:"headers"`
+
 	DnsConfigured bool       `gorm:"default:false" json:"dnsConfigured"`
 	DnsVerifiedAt *time.Time `json:"dnsVerifiedAt,omitempty"`
 	LastDnsCheck  *time.Time `json:"lastDnsCheck,omitempty"`
 	DnsCheckError *string    `json:"dnsCheckError,omitempty"`
 
+	// a domain is only routed once its owner proved control over it
+	VerificationToken   string             `json:"verificationToken"`
+	OwnershipVerified   bool               `gorm:"default:false;index" json:"ownershipVerified"`
+	VerificationMethod  verificationMethod `json:"verificationMethod,omitempty"`
+	OwnershipVerifiedAt *time.Time         `json:"ownershipVerifiedAt,omitempty"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 }
 
+// where on a host a domain routes, priority 0 leaves the order to traefik which prefers longer rules
+type DomainRoute struct {
+	PathPrefix  string `json:"pathPrefix"`
+	StripPrefix bool   `json:"stripPrefix"`
+	Priority    int    `json:"priority"`
+}
+
 func CreateDomain(appID int64, domain string) (*Domain, error) {
+	return CreateDomainRoute(appID, domain, DomainRoute{})
+}
+
+func CreateDomainRoute(appID int64, domain string, route DomainRoute) (*Domain, error) {
 	var d Domain
 	id := utils.GenerateRandomId()
 	d.ID = id
 	d.AppID = appID
 	d.Domain = domain
+	d.PathPrefix = route.PathPrefix
+	d.StripPrefix = route.StripPrefix
+	d.Priority = route.Priority
+	d.ForceHttps = true
+	d.VerificationToken = utils.GenerateRandomString(32)
 	result := db.Create(&d)
 	if result.Error != nil {
 		return nil, result.Error
@@ -97,14 +149,258 @@ func GetPrimaryDomainByAppID(appID int64) (*Domain, error) {
 	return &d, nil
 }
 
+// a new host has to be verified again
 func UpdateDomain(id int64, domain string) error {
-	result := db.Model(&Domain{}).Where("id=?", id).Update("domain_name", domain)
-	return result.Error
+	var current Domain
+	if err := db.First(&current, id).Error; err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"domain_name": domain}
+	if !strings.EqualFold(current.Domain, domain) {
+		updates["verification_token"] = utils.GenerateRandomString(32)
+		updates["ownership_verified"] = false
+		updates["verification_method"] = ""
+		updates["ownership_verified_at"] = nil
+	}
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (d *Domain) MarkOwnershipVerified(method verificationMethod) error {
+	now := time.Now()
+	err := db.Model(&Domain{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+		"ownership_verified":    true,
+		"verification_method":   method,
+		"ownership_verified_at": now,
+	}).Error
+	if err != nil {
+		return err
+	}
+	d.OwnershipVerified = true
+	d.VerificationMethod = method
+	d.OwnershipVerifiedAt = &now
+	return nil
+}
+
+// domains from before verification have no token yet
+func EnsureVerificationToken(d *Domain) error {
+	if d.VerificationToken != "" {
+		return nil
+	}
+	d.VerificationToken = utils.GenerateRandomString(32)
+	return db.Model(&Domain{}).Where("id = ?", d.ID).Update("verification_token", d.VerificationToken).Error
+}
+
+// true when an app outside the project already uses the host
+func HostUsedByOtherProject(host string, projectID int64) (bool, error) {
+	var count int64
+	err := db.Model(&Domain{}).
+		Joins("JOIN apps ON apps.id = domains.app_id").
+		Where("LOWER(domains.domain_name) = LOWER(?) AND apps.project_id <> ?", host, projectID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// true when another route on the host in the same project is already verified
+func HostVerifiedInProject(host string, projectID int64) (bool, error) {
+	var count int64
+	err := db.Model(&Domain{}).
+		Joins("JOIN apps ON apps.id = domains.app_id").
+		Where("LOWER(domains.domain_name) = LOWER(?) AND apps.project_id = ? AND domains.ownership_verified = ?", host, projectID, true).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func UpdateDomainRoute(id int64, route DomainRoute) error {
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"path_prefix":  route.PathPrefix,
+		"strip_prefix": route.StripPrefix,
+		"priority":     route.Priority,
+	}).Error
+}
+
+// every route on a host across all apps, hosts are compared case-insensitively
+func GetDomainsByHost(host string) ([]Domain, error) {
+	var domains []Domain
+	result := db.Where("LOWER(domain_name) = LOWER(?)", host).Order("created_at ASC").Find(&domains)
+	return domains, result.Error
+}
+
+func UpdateDomainComposeTarget(id int64, service *string, port *int) error {
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"compose_service": service,
+		"compose_port":    port,
+	}).Error
+}
+
+// headers traefik sets on the way in and out, an empty value in Request or Response removes the header
+type DomainHeaders struct {
+	Request               map[string]string `json:"request,omitempty"`
+	Response              map[string]string `json:"response,omitempty"`
+	ContentSecurityPolicy string            `json:"contentSecurityPolicy,omitempty"`
+	// DENY or SAMEORIGIN, empty leaves X-Frame-Options to the app
+	FrameOptions         string   `json:"frameOptions,omitempty"`
+	CorsAllowOrigins     []string `json:"corsAllowOrigins,omitempty"`
+	CorsAllowMethods     []string `json:"corsAllowMethods,omitempty"`
+	CorsAllowHeaders     []string `json:"corsAllowHeaders,omitempty"`
+	CorsAllowCredentials bool     `json:"corsAllowCredentials,omitempty"`
+	CorsMaxAge           int      `json:"corsMaxAge,omitempty"`
+}
+
+// cors settings without an allowed origin don't do anything
+func (h DomainHeaders) Empty() bool {
+	return len(h.Request) == 0 && len(h.Response) == 0 && h.ContentSecurityPolicy == "" &&
+		h.FrameOptions == "" && len(h.CorsAllowOrigins) == 0
+}
+
+// stored as json in a text column
+func (DomainHeaders) GormDataType() string {
+	return "string"
+}
+
+func (h DomainHeaders) Value() (driver.Value, error) {
+	b, err := json.Marshal(h)
+	if err != nil || string(b) == "{}" {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (h *DomainHeaders) Scan(value interface{}) error {
+	*h = DomainHeaders{}
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported headers value %T", value)
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, h)
+}
+
+type DomainRoutingSettings struct {
+	ForceHttps        bool              `json:"forceHttps"`
+	HstsEnabled       bool              `json:"hstsEnabled"`
+	HstsMaxAge        int               `json:"hstsMaxAge"`
+	RedirectWww       bool              `json:"redirectWww"`
+	RedirectWwwToRoot bool              `json:"redirectWwwToRoot"`
+	AcmeChallengeType acmeChallengeType `json:"acmeChallengeType"`
+	RateLimitAverage  int               `json:"rateLimitAverage"`
+	RateLimitBurst    int               `json:"rateLimitBurst"`
+	Headers           DomainHeaders     `json:"headers"`
+}
+
+func UpdateDomainRoutingSettings(id int64, s DomainRoutingSettings) error {
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"force_https":          s.ForceHttps,
+		"hsts_enabled":         s.HstsEnabled,
+		"hsts_max_age":         s.HstsMaxAge,
+		"redirect_www":         s.RedirectWww,
+		"redirect_www_to_root": s.RedirectWwwToRoot,
+		"acme_challenge_type":  s.AcmeChallengeType,
+		"rate_limit_average":   s.RateLimitAverage,
+		"rate_limit_burst":     s.RateLimitBurst,
+		"headers":              s.Headers,
+	}).Error
+}
+
+// empty means http-01, which traefik's default resolver uses
+func ParseAcmeChallengeType(s string) (acmeChallengeType, error) {
+	switch acmeChallengeType(s) {
+	case "", AcmeChallengeTypeHttp01:
+		return AcmeChallengeTypeHttp01, nil
+	case AcmeChallengeTypeDns01:
+		return AcmeChallengeTypeDns01, nil
+	}
+	return "", fmt.Errorf("unsupported challenge type %q, use http-01 or dns-01", s)
+}
+
+type CustomCertificate struct {
+	Certificate     string
+	Key             string
+	CertificatePath string
+	KeyPath         string
+	Issuer          string
+	IssuedAt        time.Time
+	ExpiresAt       time.Time
+}
+
+// switches the domain to an uploaded certificate, acme renewals don't apply to it anymore
+func SetDomainCertificate(id int64, c CustomCertificate) error {
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"ssl_provider":     SSLProviderCustom,
+		"ssl_status":       SSLStatusActive,
+		"certificate_data": c.Certificate,
+		"key_data":         c.Key,
+		"certificate_path": c.CertificatePath,
+		"key_path":         c.KeyPath,
+		"chain_path":       nil,
+		"issuer":           c.Issuer,
+		"issued_at":        c.IssuedAt,
+		"expires_at":       c.ExpiresAt,
+		"auto_renew":       false,
+		"renewal_error":    nil,
+	}).Error
+}
+
+// goes back to let's encrypt, the certificate is issued again on the next request
+func ClearDomainCertificate(id int64) error {
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"ssl_provider":     SSLProvider,
+		"ssl_status":       SSLStatusPending,
+		"certificate_data": nil,
+		"key_data":         nil,
+		"certificate_path": nil,
+		"key_path":         nil,
+		"chain_path":       nil,
+		"issuer":           nil,
+		"issued_at":        nil,
+		"expires_at":       nil,
+		"auto_renew":       true,
+		"renewal_error":    nil,
+	}).Error
+}
+
+func GetAllDomains() ([]Domain, error) {
+	var domains []Domain
+	result := db.Order("created_at ASC").Find(&domains)
+	return domains, result.Error
+}
+
+// what the ssl monitor found out about a domain's certificate, nil fields are cleared
+type DomainCertificateState struct {
+	Status             sslStatus
+	Issuer             *string
+	IssuedAt           *time.Time
+	ExpiresAt          *time.Time
+	LastRenewalAttempt *time.Time
+	RenewalError       *string
+}
+
+func UpdateDomainCertificateState(id int64, s DomainCertificateState) error {
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"ssl_status":           s.Status,
+		"issuer":               s.Issuer,
+		"issued_at":            s.IssuedAt,
+		"expires_at":           s.ExpiresAt,
+		"last_renewal_attempt": s.LastRenewalAttempt,
+		"renewal_error":        s.RenewalError,
+	}).Error
 }
 
 func DeleteDomain(id int64) error {
-	result := db.Delete(&Domain{}, id)
-	return result.Error
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteDomainAccessRules(tx, id); err != nil {
+			return err
+		}
+		return tx.Delete(&Domain{}, id).Error
+	})
 }
 
 func GetDomainByID(id int64) (*Domain, error) {
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -35,12 +36,40 @@ type GithubInstallation struct {
 	AccessToken    string    `json:"access_token"`
 	TokenExpiresAt time.Time `json:"token_expires_at"`
 
+	// the user who installed the app, installations are only usable by them unless shared
 	UserID int `gorm:"index" json:"user_id"`
 
+	Scope     InstallationScope `gorm:"default:'user';index" json:"scope"`
+	ProjectID *int64            `gorm:"index" json:"project_id,omitempty"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
+type InstallationScope string
+
+const (
+	// only the installing user can use it (the original behaviour)
+	InstallationScopeUser InstallationScope = "user"
+	// every member of ProjectID can use it
+	InstallationScopeProject InstallationScope = "project"
+	// every user of the instance can use it
+	InstallationScopeInstance InstallationScope = "instance"
+)
+
+func (i *GithubInstallation) ToJson() map[string]interface{} {
+	return map[string]interface{}{
+		"installationId": i.InstallationID,
+		"accountLogin":   i.AccountLogin,
+		"accountType":    i.AccountType,
+		"userId":         i.UserID,
+		"scope":          i.Scope,
+		"projectId":      i.ProjectID,
+		"createdAt":      i.CreatedAt,
+		"updatedAt":      i.UpdatedAt,
+	}
+}
+
 func (app *GithubApp) InsertInDB() error {
 	return db.Create(app).Error
 }
@@ -64,22 +93,104 @@ func GetApp(userID int) (GithubApp, bool, error) {
 		return GithubApp{}, false, err
 	}
 
-	var count int64
-	err = db.Model(&GithubInstallation{}).
-		Where("user_id = ?", userID).
-		Count(&count).Error
-
-	isInstalled := count > 0
+	// shared installations count as installed too
+	installations, err := GetAccessibleInstallations(int64(userID))
+	isInstalled := len(installations) > 0
 	return app, isInstalled, err
 }
 
+// re-installing (or re-authorizing) refreshes the account and token but keeps who it is shared with
 func (i *GithubInstallation) InsertOrReplace() error {
+	if i.Scope == "" {
+		i.Scope = InstallationScopeUser
+	}
 	return db.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "installation_id"}},
-		UpdateAll: true,
+		DoUpdates: clause.AssignmentColumns([]string{"account_login", "account_type", "access_token", "token_expires_at", "updated_at"}),
 	}).Create(i).Error
 }
 
+func GetInstallationByInstallationID(installationID int64) (*GithubInstallation, error) {
+	var inst GithubInstallation
+	err := db.Where("installation_id = ?", installationID).First(&inst).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &inst, nil
+}
+
+// a github app installation belongs to exactly one account (user or org), so the owner part of
+// `owner/repo` is enough to know which installation can access a repository
+func GetInstallationForRepo(repoFullName string) (*GithubInstallation, error) {
+	owner, _, found := strings.Cut(repoFullName, "/")
+	if !found || owner == "" {
+		return nil, fmt.Errorf("invalid repository name %q", repoFullName)
+	}
+	var inst GithubInstallation
+	err := db.Where("LOWER(account_login) = LOWER(?)", owner).First(&inst).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &inst, nil
+}
+
+// installations the user installed themselves, plus the ones shared with the whole instance
+// or with a project they are a member of
+func GetAccessibleInstallations(userID int64) ([]GithubInstallation, error) {
+	var installations []GithubInstallation
+	err := db.Where("user_id = ?", userID).
+		Or("scope = ?", InstallationScopeInstance).
+		Or("scope = ? AND project_id IN (?)", InstallationScopeProject,
+			db.Table("project_members").Select("project_id").Where("user_id = ?", userID)).
+		Order("account_login ASC").
+		Find(&installations).Error
+	return installations, err
+}
+
+// projectID is the project the installation is about to be used in, 0 if not project specific
+func CanUserUseInstallation(userID int64, inst *GithubInstallation, projectID int64) (bool, error) {
+	switch {
+	case int64(inst.UserID) == userID:
+		return true, nil
+	case inst.Scope == InstallationScopeInstance:
+		return true, nil
+	case inst.Scope == InstallationScopeProject && inst.ProjectID != nil:
+		if projectID != 0 && projectID != *inst.ProjectID {
+			return false, nil
+		}
+		return HasUserAccessToProject(userID, *inst.ProjectID)
+	}
+	return false, nil
+}
+
+func (i *GithubInstallation) SetScope(scope InstallationScope, projectID *int64) error {
+	i.Scope = scope
+	i.ProjectID = projectID
+	return db.Model(&GithubInstallation{}).Where("installation_id = ?", i.InstallationID).
+		Updates(map[string]interface{}{
+			"scope":      scope,
+			"project_id": projectID,
+		}).Error
+}
+
+// token for the installation that has access to the repository, independent of who created the app
+func GetInstallationTokenForRepo(repoFullName string) (string, error) {
+	inst, err := GetInstallationForRepo(repoFullName)
+	if err != nil {
+		return "", err
+	}
+	if inst == nil {
+		return "", fmt.Errorf("no GitHub installation has access to %s", repoFullName)
+	}
+	return GetFreshInstallationToken(inst.InstallationID)
+}
+
 func GetInstallationID(userID int) (int64, error) {
 	var inst GithubInstallation
 	err := db.Select("installation_id").
@@ -158,6 +269,34 @@ func GetGithubAppIDAndPrivateKey() (int64, string, error) {
 	return app.AppID, app.PrivateKey, nil
 }
 
+// returns the cached installation token, or a newly issued one if it is about to expire
+func GetFreshInstallationToken(installationID int64) (string, error) {
+	var inst GithubInstallation
+	if err := db.Where("installation_id = ?", installationID).First(&inst).Error; err != nil {
+		return "", err
+	}
+	if inst.AccessToken != "" && time.Now().Add(time.Minute).Before(inst.TokenExpiresAt) {
+		return inst.AccessToken, nil
+	}
+
+	appID, privateKey, err := GetGithubAppIDAndPrivateKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to get GitHub App credentials: %w", err)
+	}
+	jwtToken, err := generateGithubJwt(appID, privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate GitHub JWT: %w", err)
+	}
+	token, expiry, err := regenerateGithubInstallationToken(jwtToken, installationID)
+	if err != nil {
+		return "", fmt.Errorf("failed to regenerate installation token: %w", err)
+	}
+	if err := UpdateInstallationToken(installationID, token, expiry); err != nil {
+		return "", fmt.Errorf("failed to update installation token: %w", err)
+	}
+	return token, nil
+}
+
 //########################################################################################################################
 //ARCHIVED CODE BELOW-------------------------------->
 
@@ -108,6 +108,15 @@ func (n *Notification) InsertInDB() error {
 	return db.Create(n).Error
 }
 
+// lets background jobs raise a notification once instead of on every run
+func HasNotificationSince(notificationType NotificationType, resourceType string, resourceID int64, since time.Time) (bool, error) {
+	var count int64
+	err := db.Model(&Notification{}).
+		Where("type = ? AND resource_type = ? AND resource_id = ? AND created_at >= ?", notificationType, resourceType, resourceID, since).
+		Count(&count).Error
+	return count > 0, err
+}
+
 func GetNotificationsByUserID(userID int64, unreadOnly bool) ([]Notification, error) {
 	var notifications []Notification
 
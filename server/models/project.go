@@ -138,6 +138,14 @@ func IsUserProjectOwner(userID, projectID int64) (bool, error) {
 	return count > 0, err
 }
 
+func GetProjectMemberIDs(projectID int64) ([]int64, error) {
+	var ids []int64
+	err := db.Table("project_members").
+		Where("project_id = ?", projectID).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
 func UpdateProjectMembers(projectID int64, userIDs []int64) error {
 	return db.Transaction(func(tx *gorm.DB) error {
 		var project Project
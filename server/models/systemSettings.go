@@ -254,6 +254,75 @@ func (s *SystemSettings) UpdateSystemSettings() error {
 	return nil
 }
 
+// dns-01 through an rfc2136 dynamic update server, lets traefik issue certificates for hosts port 80
+// can't reach and the wildcard certificate for the wildcard domain
+type DNSChallengeSettings struct {
+	Enabled             bool   `json:"enabled"`
+	Nameserver          string `json:"nameserver"`
+	TsigKey             string `json:"tsigKey"`
+	TsigAlgorithm       string `json:"tsigAlgorithm"`
+	TsigSecret          string `json:"-"`
+	WildcardCertificate bool   `json:"wildcardCertificate"`
+}
+
+func GetDNSChallengeSettings() (*DNSChallengeSettings, error) {
+	var s DNSChallengeSettings
+	values := map[string]*string{
+		"rfc2136_nameserver":     &s.Nameserver,
+		"rfc2136_tsig_key":       &s.TsigKey,
+		"rfc2136_tsig_algorithm": &s.TsigAlgorithm,
+		"rfc2136_tsig_secret":    &s.TsigSecret,
+	}
+	for key, dst := range values {
+		value, err := GetSystemSetting(key)
+		if err != nil {
+			return nil, err
+		}
+		*dst = value
+	}
+	if s.TsigAlgorithm == "" {
+		s.TsigAlgorithm = "hmac-sha256."
+	}
+
+	enabled, err := GetSystemSetting("dns_challenge_enabled")
+	if err != nil {
+		return nil, err
+	}
+	s.Enabled = enabled == "true"
+
+	wildcard, err := GetSystemSetting("wildcard_certificate")
+	if err != nil {
+		return nil, err
+	}
+	s.WildcardCertificate = wildcard == "true"
+
+	return &s, nil
+}
+
+func UpdateDNSChallengeSettings(s DNSChallengeSettings) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		values := map[string]string{
+			"dns_challenge_enabled":  fmt.Sprintf("%t", s.Enabled),
+			"rfc2136_nameserver":     s.Nameserver,
+			"rfc2136_tsig_key":       s.TsigKey,
+			"rfc2136_tsig_algorithm": s.TsigAlgorithm,
+			"rfc2136_tsig_secret":    s.TsigSecret,
+			"wildcard_certificate":   fmt.Sprintf("%t", s.WildcardCertificate),
+		}
+		for key, value := range values {
+			entry := SystemSettingEntry{Key: key, Value: value}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+			}).Create(&entry).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func GenerateAutoDomain(projectName, appName string) (string, error) {
 	settings, err := GetSystemSettings()
 	if err != nil {
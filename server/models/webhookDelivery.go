@@ -0,0 +1,169 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corecollectives/mist/utils"
+	"gorm.io/gorm"
+)
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryReceived  WebhookDeliveryStatus = "received"
+	WebhookDeliveryProcessed WebhookDeliveryStatus = "processed"
+	WebhookDeliveryIgnored   WebhookDeliveryStatus = "ignored"
+	WebhookDeliveryRejected  WebhookDeliveryStatus = "rejected"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// every inbound git provider webhook is stored as-is so failed deliveries can be inspected and replayed
+type WebhookDelivery struct {
+	ID             int64                 `gorm:"primaryKey;autoIncrement:false" json:"id"`
+	Source         string                `gorm:"index;not null" json:"source"`
+	Event          string                `json:"event"`
+	DeliveryID     string                `gorm:"index" json:"deliveryId"`
+	Headers        string                `json:"headers"`
+	Payload        string                `json:"payload"`
+	SignatureValid bool                  `json:"signatureValid"`
+	Status         WebhookDeliveryStatus `gorm:"default:'received';index" json:"status"`
+	Repository     *string               `json:"repository,omitempty"`
+	Ref            *string               `json:"ref,omitempty"`
+
+	AppIDsString        string  `gorm:"column:app_ids" json:"-"`
+	AppIDs              []int64 `gorm:"-" json:"appIds"`
+	DeploymentIDsString string  `gorm:"column:deployment_ids" json:"-"`
+	DeploymentIDs       []int64 `gorm:"-" json:"deploymentIds"`
+
+	Error        *string    `json:"error,omitempty"`
+	RedeliveryOf *int64     `gorm:"index" json:"redeliveryOf,omitempty"`
+	TriggeredBy  *int64     `gorm:"constraint:OnDelete:SET NULL" json:"triggeredBy,omitempty"`
+	ProcessedAt  *time.Time `json:"processedAt,omitempty"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+func (d *WebhookDelivery) BeforeSave(tx *gorm.DB) (err error) {
+	d.AppIDsString = joinIDs(d.AppIDs)
+	d.DeploymentIDsString = joinIDs(d.DeploymentIDs)
+	return
+}
+
+func (d *WebhookDelivery) AfterFind(tx *gorm.DB) (err error) {
+	d.AppIDs = splitIDs(d.AppIDsString)
+	d.DeploymentIDs = splitIDs(d.DeploymentIDsString)
+	return
+}
+
+func joinIDs(ids []int64) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitIDs(s string) []int64 {
+	ids := []int64{}
+	for _, part := range strings.Split(s, ",") {
+		if id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// the payload and headers are left out, they can be large and are only needed when looking at a single delivery
+func (d *WebhookDelivery) ToJson() map[string]interface{} {
+	appIDs := d.AppIDs
+	if appIDs == nil {
+		appIDs = []int64{}
+	}
+	deploymentIDs := d.DeploymentIDs
+	if deploymentIDs == nil {
+		deploymentIDs = []int64{}
+	}
+	return map[string]interface{}{
+		"id":             d.ID,
+		"source":         d.Source,
+		"event":          d.Event,
+		"deliveryId":     d.DeliveryID,
+		"signatureValid": d.SignatureValid,
+		"status":         d.Status,
+		"repository":     d.Repository,
+		"ref":            d.Ref,
+		"appIds":         appIDs,
+		"deploymentIds":  deploymentIDs,
+		"error":          d.Error,
+		"redeliveryOf":   d.RedeliveryOf,
+		"triggeredBy":    d.TriggeredBy,
+		"processedAt":    d.ProcessedAt,
+		"createdAt":      d.CreatedAt,
+	}
+}
+
+func (d *WebhookDelivery) InsertInDB() error {
+	d.ID = utils.GenerateRandomId()
+	if d.Status == "" {
+		d.Status = WebhookDeliveryReceived
+	}
+	return db.Create(d).Error
+}
+
+// records how the delivery was handled, errMsg is only stored when non empty
+func (d *WebhookDelivery) Finish(status WebhookDeliveryStatus, errMsg string) error {
+	now := time.Now()
+	d.Status = status
+	d.ProcessedAt = &now
+	if errMsg != "" {
+		d.Error = &errMsg
+	}
+	return db.Model(d).Select("Status", "SignatureValid", "ProcessedAt", "Error", "Repository", "Ref",
+		"AppIDsString", "DeploymentIDsString").Updates(d).Error
+}
+
+// headers and payload are only kept once the signature checked out, so unauthenticated requests
+// can't fill the database
+func (d *WebhookDelivery) StoreContent(headers, payload string) error {
+	d.Headers = headers
+	d.Payload = payload
+	return db.Model(d).Select("Headers", "Payload").Updates(d).Error
+}
+
+func GetWebhookDeliveryByID(id int64) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := db.First(&delivery, "id = ?", id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func GetWebhookDeliveries(status string, limit, offset int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	query := db.Omit("payload", "headers").Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Limit(limit).Offset(offset).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func GetWebhookDeliveriesCount(status string) (int64, error) {
+	var count int64
+	query := db.Model(&WebhookDelivery{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+func DeleteWebhookDeliveriesBefore(before time.Time) (int64, error) {
+	result := db.Where("created_at < ?", before).Delete(&WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/corecollectives/mist/constants"
+	"github.com/corecollectives/mist/fs"
+	"github.com/corecollectives/mist/models"
+	"github.com/rs/zerolog/log"
+)
+
+// replaces the app workspace with the contents of the uploaded archive, takes the place of git.CloneRepo
+// for archive deployments. extraction happens next to the workspace so a broken archive leaves the old one intact
+func extractSourceArchive(ctx context.Context, app *models.App, dep *models.Deployment, logFile *os.File) error {
+	archivePath := sourceArchivePath(*dep.SourceArchive)
+	if _, err := os.Stat(archivePath); err != nil {
+		return fmt.Errorf("uploaded archive is no longer available: %w", err)
+	}
+
+	workspace := fmt.Sprintf("/var/lib/mist/projects/%d/apps/%s", app.ProjectID, app.Name)
+	staging := fmt.Sprintf("%s.upload-%d", workspace, dep.ID)
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(logFile, "[ARCHIVE]: Extracting %s (sha256 %s)\n", filepath.Base(archivePath), dep.CommitHash)
+	maxSize := int64(constants.Constants["MaxArchiveExtractedSize"].(int))
+	if err := fs.ExtractArchive(ctx, archivePath, staging, maxSize); err != nil {
+		os.RemoveAll(staging)
+		return fmt.Errorf("failed to extract archive: %w", err)
+	}
+
+	if err := os.RemoveAll(workspace); err != nil {
+		os.RemoveAll(staging)
+		return fmt.Errorf("failed to clear workspace: %w", err)
+	}
+	if err := os.Rename(staging, workspace); err != nil {
+		return fmt.Errorf("failed to move extracted archive into workspace: %w", err)
+	}
+	fmt.Fprintf(logFile, "[ARCHIVE]: Extracted into %s\n", workspace)
+	return nil
+}
+
+func sourceArchivePath(name string) string {
+	return filepath.Join(constants.Constants["ArchiveDirPath"].(string), filepath.Base(name))
+}
+
+// every upload gets its own archive file, it is removed once its deployment reached a final status
+// no matter whether it was deployed, failed, stopped or superseded
+func RemoveSourceArchive(depID int64) {
+	dep, err := models.GetDeploymentByID(depID)
+	if err != nil || dep.SourceArchive == nil {
+		return
+	}
+	path := sourceArchivePath(*dep.SourceArchive)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warn().Err(err).Str("path", path).Msg("Failed to remove uploaded archive")
+	}
+}
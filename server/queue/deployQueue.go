@@ -51,6 +51,12 @@ func (q *Queue) StartWorker(db *gorm.DB) {
 			}
 			if status == "stopped" {
 				log.Info().Msgf("Deployment %d has been stopped before processing, skipping", id)
+				RemoveSourceArchive(id)
+				continue
+			}
+			if status == string(models.DeploymentStatusSuperseded) {
+				log.Info().Msgf("Deployment %d has been superseded by a newer deployment, skipping", id)
+				RemoveSourceArchive(id)
 				continue
 			}
 			q.HandleWork(id, db)
@@ -62,6 +68,7 @@ func (q *Queue) StartWorker(db *gorm.DB) {
 func (q *Queue) AddJob(Id int64) error {
 	select {
 	case q.jobs <- Id:
+		supersedeOlderDeployments(Id)
 		return nil
 	case <-q.ctx.Done():
 		return fmt.Errorf("queue is closed")
@@ -11,6 +11,7 @@ import (
 	"github.com/corecollectives/mist/git"
 	"github.com/corecollectives/mist/github"
 	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/staticsite"
 	"github.com/corecollectives/mist/utils"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
@@ -36,6 +37,7 @@ func (q *Queue) HandleWork(id int64, db *gorm.DB) {
 	defer cancel()
 	Register(id, cancel)
 	defer Unregister(id)
+	defer RemoveSourceArchive(id)
 
 	appId, err := models.GetAppIDByDeploymentID(id)
 	if err != nil {
@@ -85,21 +87,44 @@ func (q *Queue) HandleWork(id int64, db *gorm.DB) {
 	}
 	defer logFile.Close()
 
-	if app.AppType != models.AppTypeDatabase {
+	if dep.SourceArchive != nil {
+		logger.Info("Extracting uploaded archive")
+		models.UpdateDeploymentStatus(id, "extracting", "extracting", 20, nil)
+		if err := extractSourceArchive(ctx, app, dep, logFile); err != nil {
+			if ctx.Err() == context.Canceled {
+				markCancelled(id, dep.Progress, logger)
+				return
+			}
+			logger.Error(err, "Failed to extract archive")
+			errMsg := fmt.Sprintf("Failed to extract archive: %v", err)
+			models.UpdateDeploymentStatus(id, "failed", "failed", 0, &errMsg)
+			fmt.Fprint(logFile, "error extracting archive: ", err.Error())
+			return
+		}
+		logger.Info("Archive extracted successfully")
+	} else if dep.ComposeDefinition != nil {
+		logger.Info("Writing inline compose definition")
+		path := fmt.Sprintf("/var/lib/mist/projects/%d/apps/%s", app.ProjectID, app.Name)
+		if err := compose.WriteInlineDefinition(path, *dep.ComposeDefinition, logFile); err != nil {
+			logger.Error(err, "Failed to write compose definition")
+			errMsg := fmt.Sprintf("Failed to write compose definition: %v", err)
+			models.UpdateDeploymentStatus(id, "failed", "failed", 0, &errMsg)
+			fmt.Fprint(logFile, "error writing compose definition: ", err.Error())
+			return
+		}
+	} else if app.AppType != models.AppTypeDatabase {
 		logger.Info("Cloning repository")
 		models.UpdateDeploymentStatus(id, "cloning", "cloning", 20, nil)
 		if dep.GithubDepId != nil {
-			err = github.UpdateDeployment(*app.GitRepository, *dep.GithubDepId, "in_progress", "building application", int(app.CreatedBy))
+			err = github.UpdateDeployment(*app.GitRepository, *dep.GithubDepId, "in_progress", "building application")
 			if err != nil {
 				log.Err(err).Msg("error updating GH deployment")
 			}
 		}
-		err = git.CloneRepo(ctx, appId, logFile)
+		err = git.CloneRepo(ctx, appId, dep, logFile)
 		if err != nil {
 			if ctx.Err() == context.Canceled {
-				logger.Info("Deployment cancelled by user")
-				errMsg := "deployment stopped by user"
-				models.UpdateDeploymentStatus(id, "stopped", "stopped", dep.Progress, &errMsg)
+				markCancelled(id, dep.Progress, logger)
 				return
 			}
 			logger.Error(err, "Failed to clone repository")
@@ -117,16 +142,17 @@ func (q *Queue) HandleWork(id int64, db *gorm.DB) {
 	if app.AppType == models.AppTypeCompose {
 		path := fmt.Sprintf("/var/lib/mist/projects/%d/apps/%s", app.ProjectID, app.Name)
 		err = compose.DeployComposeApp(ctx, dep, app, path, db, logFile, logger)
+	} else if app.AppType == models.AppTypeStatic {
+		path := fmt.Sprintf("/var/lib/mist/projects/%d/apps/%s", app.ProjectID, app.Name)
+		err = staticsite.DeployStaticApp(ctx, dep, app, path, db, logFile, logger)
 	} else {
 		_, err = docker.ExecuteDeploymentWorkflow(ctx, id, db, logFile, logger)
 	}
 	if err != nil {
 		if ctx.Err() == context.Canceled {
-			logger.Info("Deployment cancelled by user")
-			errMsg := "deployment stopped by user"
-			models.UpdateDeploymentStatus(id, "stopped", "stopped", dep.Progress, &errMsg)
+			markCancelled(id, dep.Progress, logger)
 			if dep.GithubDepId != nil {
-				err = github.UpdateDeployment(*app.GitRepository, *dep.GithubDepId, "failure", "deployment stopped by user", int(app.CreatedBy))
+				err = github.UpdateDeployment(*app.GitRepository, *dep.GithubDepId, "failure", "deployment stopped by user")
 				if err != nil {
 					log.Err(err).Msg("error updating GH deployment")
 				}
@@ -137,7 +163,7 @@ func (q *Queue) HandleWork(id int64, db *gorm.DB) {
 		errMsg := fmt.Sprintf("Deployment failed: %v", err)
 		models.UpdateDeploymentStatus(id, "failed", "failed", 0, &errMsg)
 		if dep.GithubDepId != nil {
-			err = github.UpdateDeployment(*app.GitRepository, *dep.GithubDepId, "error", err.Error(), int(app.CreatedBy))
+			err = github.UpdateDeployment(*app.GitRepository, *dep.GithubDepId, "error", err.Error())
 			if err != nil {
 				log.Err(err).Msg("error updating GH deployment")
 			}
@@ -146,7 +172,7 @@ func (q *Queue) HandleWork(id int64, db *gorm.DB) {
 		return
 	} else {
 		if dep.GithubDepId != nil {
-			err = github.UpdateDeployment(*app.GitRepository, *dep.GithubDepId, "success", "deployed successfully", int(app.CreatedBy))
+			err = github.UpdateDeployment(*app.GitRepository, *dep.GithubDepId, "success", "deployed successfully")
 			if err != nil {
 				log.Err(err).Msg("error updating GH deployment")
 			}
@@ -155,3 +181,15 @@ func (q *Queue) HandleWork(id int64, db *gorm.DB) {
 		logger.Info("Deployment completed successfully")
 	}
 }
+
+// a cancelled deployment is either stopped by the user or superseded by a newer one, the
+// superseded status is written before cancelling so it must not be overwritten here
+func markCancelled(id int64, progress int, logger *utils.DeploymentLogger) {
+	if status, err := models.GetDeploymentStatus(id); err == nil && status == string(models.DeploymentStatusSuperseded) {
+		logger.Info("Deployment superseded by a newer deployment")
+		return
+	}
+	logger.Info("Deployment cancelled by user")
+	errMsg := "deployment stopped by user"
+	models.UpdateDeploymentStatus(id, "stopped", "stopped", progress, &errMsg)
+}
@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/corecollectives/mist/models"
+	"github.com/rs/zerolog/log"
+)
+
+// stages in which a deployment is actively being worked on by HandleWork
+var runningDeploymentStatuses = []models.DeploymentStatus{models.DeploymentStatusExtracting, "cloning", models.DeploymentStatusBuilding, models.DeploymentStatusDeploying}
+
+// when an app gets several deployments in a short time (eg. a few pushes in a row) only the newest
+// one is worth building, depending on the app's supersede policy older ones are dropped from the
+// queue and the running one can be aborted as well
+func supersedeOlderDeployments(depID int64) {
+	dep, err := models.GetDeploymentByID(depID)
+	if err != nil {
+		log.Warn().Err(err).Int64("deployment_id", depID).Msg("Failed to load deployment for supersede check")
+		return
+	}
+
+	app, err := models.GetApplicationByID(dep.AppID)
+	if err != nil {
+		log.Warn().Err(err).Int64("app_id", dep.AppID).Msg("Failed to load app for supersede check")
+		return
+	}
+	if app.SupersedePolicy != models.SupersedePending && app.SupersedePolicy != models.SupersedeRunning {
+		return
+	}
+
+	older, err := models.GetUnfinishedDeploymentsBefore(app.ID, dep)
+	if err != nil {
+		log.Warn().Err(err).Int64("app_id", app.ID).Msg("Failed to get older deployments for supersede check")
+		return
+	}
+
+	errMsg := fmt.Sprintf("superseded by deployment %d", dep.ID)
+	for _, old := range older {
+		running := slices.Contains(runningDeploymentStatuses, old.Status)
+		if running && app.SupersedePolicy != models.SupersedeRunning {
+			continue
+		}
+
+		// the status is written before cancelling so HandleWork sees it and doesn't mark it as stopped
+		if err := models.UpdateDeploymentStatus(old.ID, string(models.DeploymentStatusSuperseded), string(models.DeploymentStatusSuperseded), old.Progress, &errMsg); err != nil {
+			log.Error().Err(err).Int64("deployment_id", old.ID).Msg("Failed to mark deployment as superseded")
+			continue
+		}
+		wasRunning := false
+		if running {
+			wasRunning = Cancel(old.ID)
+		}
+
+		log.Info().
+			Int64("deployment_id", old.ID).
+			Int64("superseded_by", dep.ID).
+			Int64("app_id", app.ID).
+			Bool("was_running", wasRunning).
+			Msg("Deployment superseded")
+
+		models.LogSystemAudit("supersede", "deployment", &old.ID, map[string]interface{}{
+			"app_id":        app.ID,
+			"commit_hash":   old.CommitHash,
+			"superseded_by": dep.ID,
+			"policy":        app.SupersedePolicy,
+			"was_running":   wasRunning,
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package staticsite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/moby/moby/api/pkg/stdcopy"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+const DefaultBuilderImage = "node:20-alpine"
+
+// runs the app's build command in a throwaway builder container with the workspace mounted at /app,
+// whatever the command writes into the workspace (eg. dist/) is what gets published afterwards
+func RunBuildCommand(ctx context.Context, appID int64, image, workspace, rootDirectory, command string, env map[string]string, logFile *os.File) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 15*time.Minute)
+	defer cancel()
+
+	cli, err := client.New(client.FromEnv)
+	if err != nil {
+		return fmt.Errorf("error creating moby client: %s", err.Error())
+	}
+
+	if err := pullImage(timeoutCtx, cli, image, logFile); err != nil {
+		return err
+	}
+
+	var envList []string
+	for k, v := range env {
+		envList = append(envList, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	name := fmt.Sprintf("app-%d-build", appID)
+	// a leftover from a crashed build would block the name
+	cli.ContainerRemove(timeoutCtx, name, client.ContainerRemoveOptions{Force: true})
+
+	resp, err := cli.ContainerCreate(timeoutCtx, client.ContainerCreateOptions{
+		Name: name,
+		Config: &container.Config{
+			Image:      image,
+			Cmd:        []string{"sh", "-c", command},
+			Env:        envList,
+			WorkingDir: path.Join("/app", rootDirectory),
+		},
+		HostConfig: &container.HostConfig{
+			Binds: []string{workspace + ":/app"},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create build container: %w", err)
+	}
+	defer func() {
+		removeCtx, removeCancel := context.WithTimeout(context.Background(), time.Minute)
+		defer removeCancel()
+		cli.ContainerRemove(removeCtx, resp.ID, client.ContainerRemoveOptions{Force: true})
+	}()
+
+	fmt.Fprintf(logFile, "[BUILD]: Running `%s` in %s\n", command, image)
+	if _, err := cli.ContainerStart(timeoutCtx, resp.ID, client.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("failed to start build container: %w", err)
+	}
+
+	logs, err := cli.ContainerLogs(timeoutCtx, resp.ID, client.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+	if err != nil {
+		return fmt.Errorf("failed to attach to build logs: %w", err)
+	}
+	defer logs.Close()
+	stdcopy.StdCopy(logFile, logFile, logs)
+
+	wait := cli.ContainerWait(timeoutCtx, resp.ID, client.ContainerWaitOptions{Condition: container.WaitConditionNotRunning})
+	select {
+	case err := <-wait.Error:
+		if timeoutCtx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("build command timed out after 15 minutes")
+		}
+		if timeoutCtx.Err() == context.Canceled {
+			return context.Canceled
+		}
+		return fmt.Errorf("failed waiting for build container: %w", err)
+	case result := <-wait.Result:
+		if result.StatusCode != 0 {
+			return fmt.Errorf("build command exited with code %d", result.StatusCode)
+		}
+	}
+	return nil
+}
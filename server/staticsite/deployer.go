@@ -0,0 +1,127 @@
+package staticsite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/corecollectives/mist/docker"
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
+	"github.com/corecollectives/mist/utils"
+	"gorm.io/gorm"
+)
+
+// builds (optionally) and publishes a static app, the workspace has already been cloned or extracted
+func DeployStaticApp(ctx context.Context, dep *models.Deployment, app *models.App, workspace string, db *gorm.DB, logfile *os.File, logger *utils.DeploymentLogger) error {
+	logger.Info("Starting static site deployment process")
+
+	fail := func(stage string, err error) error {
+		logger.Error(err, stage+" failed")
+		dep.Status = models.DeploymentStatusFailed
+		dep.Stage = "failed"
+		dep.Progress = 0
+		errMsg := fmt.Sprintf("%s failed: %v", stage, err)
+		dep.ErrorMessage = &errMsg
+		docker.UpdateDeploymentRecord(dep, db)
+		models.UpdateDeploymentStatus(dep.ID, "failed", "failed", 0, &errMsg)
+		docker.UpdateApplicationStatus(app.ID, "error", db)
+		return fmt.Errorf("%s failed: %w", stage, err)
+	}
+
+	// the root directory is also the build container's working dir, it has to stay inside the repo
+	rootDirectory := strings.Trim(app.RootDirectory, "/")
+	if rootDirectory != "" && !filepath.IsLocal(filepath.FromSlash(rootDirectory)) {
+		return fail("Build", fmt.Errorf("root directory must be a path inside the repository"))
+	}
+	contextPath := filepath.Join(workspace, rootDirectory)
+
+	if app.BuildCommand != nil && *app.BuildCommand != "" {
+		_, _, envSet, err := docker.FetchFullDeploymentConfiguration(dep.ID, app, db)
+		if err != nil {
+			return fail("Fetch deployment config", err)
+		}
+
+		dep.Status = models.DeploymentStatusBuilding
+		dep.Stage = "building"
+		dep.Progress = 50
+		docker.UpdateDeploymentRecord(dep, db)
+		models.UpdateDeploymentStatus(dep.ID, "building", "building", 50, nil)
+
+		image := DefaultBuilderImage
+		if app.BuilderImage != nil && *app.BuilderImage != "" {
+			image = *app.BuilderImage
+		}
+		logger.InfoWithFields("Running static build command", map[string]interface{}{
+			"image":            image,
+			"buildTimeEnvVars": envSet.GetBuildTimeCount(),
+		})
+		if err := RunBuildCommand(ctx, app.ID, image, workspace, rootDirectory, *app.BuildCommand, envSet.BuildTime, logfile); err != nil {
+			if ctx.Err() == context.Canceled {
+				logger.Info("Static build canceled")
+				return ctx.Err()
+			}
+			return fail("Build", err)
+		}
+	} else {
+		logger.Info("No build command set, serving the directory as-is")
+	}
+
+	dep.Status = models.DeploymentStatusDeploying
+	dep.Stage = "deploying"
+	dep.Progress = 80
+	docker.UpdateDeploymentRecord(dep, db)
+	models.UpdateDeploymentStatus(dep.ID, "deploying", "deploying", 80, nil)
+
+	outputDir := contextPath
+	if app.OutputDirectory != nil && *app.OutputDirectory != "" {
+		if !filepath.IsLocal(filepath.FromSlash(*app.OutputDirectory)) {
+			return fail("Publish", fmt.Errorf("output directory must be relative to the root directory"))
+		}
+		outputDir = filepath.Join(contextPath, filepath.FromSlash(*app.OutputDirectory))
+	}
+
+	fmt.Fprintf(logfile, "[STATIC]: Publishing %s as version %d\n", outputDir, dep.ID)
+	if err := Publish(app.ID, dep.ID, workspace, outputDir); err != nil {
+		return fail("Publish", err)
+	}
+
+	if err := EnsureServer(ctx, logfile); err != nil {
+		if ctx.Err() == context.Canceled {
+			return ctx.Err()
+		}
+		return fail("Static server", err)
+	}
+	if err := traefik.RenderApp(app.ID); err != nil {
+		return fail("Routing", err)
+	}
+
+	if err := PruneVersions(app.ID, VersionsToKeep); err != nil {
+		logger.Error(err, "Failed to prune old static versions (non-fatal)")
+	}
+
+	dep.Status = models.DeploymentStatusSuccess
+	dep.Stage = "success"
+	dep.Progress = 100
+	now := time.Now()
+	dep.FinishedAt = &now
+	docker.UpdateDeploymentRecord(dep, db)
+	models.UpdateDeploymentStatus(dep.ID, "success", "success", 100, nil)
+	if err := models.MarkDeploymentActive(dep.ID, app.ID); err != nil {
+		logger.Error(err, "Failed to mark deployment active (non-fatal)")
+	}
+
+	if err := docker.UpdateApplicationStatus(app.ID, "running", db); err != nil {
+		logger.Error(err, "Failed to update application status (non-fatal)")
+	}
+
+	logger.InfoWithFields("Deployment succeeded", map[string]interface{}{
+		"deployment_id": dep.ID,
+		"version":       dep.ID,
+		"app_status":    "running",
+	})
+	return nil
+}
@@ -0,0 +1,92 @@
+package staticsite
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/corecollectives/mist/traefik"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// one nginx container serves every static app, traefik adds the `/<appId>/current` prefix per app
+	ServerContainerName = traefik.StaticServerName
+	ServerImage         = "nginx:alpine"
+)
+
+// creates (or starts) the shared static file server if it isn't running yet
+func EnsureServer(ctx context.Context, logFile *os.File) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	cli, err := client.New(client.FromEnv)
+	if err != nil {
+		return fmt.Errorf("error creating moby client: %s", err.Error())
+	}
+
+	inspect, err := cli.ContainerInspect(timeoutCtx, ServerContainerName, client.ContainerInspectOptions{})
+	if err == nil {
+		if inspect.Container.State != nil && inspect.Container.State.Running {
+			return nil
+		}
+		if _, err := cli.ContainerStart(timeoutCtx, ServerContainerName, client.ContainerStartOptions{}); err != nil {
+			return fmt.Errorf("failed to start static server: %w", err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(StaticRoot(), 0o755); err != nil {
+		return err
+	}
+
+	log.Info().Str("image", ServerImage).Msg("Creating shared static file server")
+	if err := pullImage(timeoutCtx, cli, ServerImage, logFile); err != nil {
+		return err
+	}
+
+	resp, err := cli.ContainerCreate(timeoutCtx, client.ContainerCreateOptions{
+		Name: ServerContainerName,
+		Config: &container.Config{
+			Image: ServerImage,
+		},
+		HostConfig: &container.HostConfig{
+			RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyUnlessStopped},
+			Binds:         []string{StaticRoot() + ":/usr/share/nginx/html:ro"},
+			NetworkMode:   container.NetworkMode("traefik-net"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create static server: %w", err)
+	}
+	if _, err := cli.ContainerStart(timeoutCtx, resp.ID, client.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("failed to start static server: %w", err)
+	}
+	return nil
+}
+
+// pulls an image unless it is already present locally
+func pullImage(ctx context.Context, cli *client.Client, image string, logFile *os.File) error {
+	if _, err := cli.ImageInspect(ctx, image); err == nil {
+		return nil
+	}
+	resp, err := cli.ImagePull(ctx, image, client.ImagePullOptions{})
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return context.Canceled
+		}
+		return fmt.Errorf("failed to pull %s: %w", image, err)
+	}
+	defer resp.Close()
+
+	var out io.Writer = io.Discard
+	if logFile != nil {
+		out = logFile
+	}
+	_, err = io.Copy(out, resp)
+	return err
+}
@@ -0,0 +1,253 @@
+package staticsite
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corecollectives/mist/constants"
+)
+
+// how many published versions of an app are kept around for rollbacks
+const VersionsToKeep = 5
+
+// every app gets `/var/lib/mist/static/<appId>/<deploymentId>` per published version and a `current` symlink
+// pointing at the live one, the static server only ever serves `<appId>/current`
+func StaticRoot() string {
+	return filepath.Join(constants.Constants["RootPath"].(string), "static")
+}
+
+func AppDir(appID int64) string {
+	return filepath.Join(StaticRoot(), strconv.FormatInt(appID, 10))
+}
+
+func VersionDir(appID, deploymentID int64) string {
+	return filepath.Join(AppDir(appID), strconv.FormatInt(deploymentID, 10))
+}
+
+// sits next to the version directory, outside of what the static server serves
+func publishedMarker(appID, deploymentID int64) string {
+	return VersionDir(appID, deploymentID) + ".published"
+}
+
+// when the version was published, versions from before the marker fall back to their directory's mtime
+func publishedAt(appID, deploymentID int64, info os.FileInfo) int64 {
+	content, err := os.ReadFile(publishedMarker(appID, deploymentID))
+	if err == nil {
+		if t, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64); err == nil {
+			return t
+		}
+	}
+	return info.ModTime().UnixNano()
+}
+
+// copies the build output into a new version directory and switches `current` to it
+func Publish(appID, deploymentID int64, workspace, outputDir string) error {
+	info, err := os.Stat(outputDir)
+	if err != nil {
+		return fmt.Errorf("output directory not found: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("output path %s is not a directory", outputDir)
+	}
+	// the root and output directory come from the repo, either of them may be a link leading out of it
+	realOutput, err := filepath.EvalSymlinks(outputDir)
+	if err != nil {
+		return err
+	}
+	if !resolvesInside(workspace, realOutput) {
+		return fmt.Errorf("output directory %s resolves outside the repository", outputDir)
+	}
+
+	target := VersionDir(appID, deploymentID)
+	staging := target + ".tmp"
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	if err := copyDir(realOutput, staging); err != nil {
+		os.RemoveAll(staging)
+		return fmt.Errorf("failed to copy build output: %w", err)
+	}
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	if err := os.Rename(staging, target); err != nil {
+		return err
+	}
+	// deployment ids are random and a directory's mtime moves with its contents, the publish time
+	// is what orders versions
+	published := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := os.WriteFile(publishedMarker(appID, deploymentID), []byte(published), 0o644); err != nil {
+		return err
+	}
+
+	return Activate(appID, deploymentID)
+}
+
+// points `current` at an already published version, the swap is a rename so requests never see a missing link
+func Activate(appID, deploymentID int64) error {
+	if _, err := os.Stat(VersionDir(appID, deploymentID)); err != nil {
+		return fmt.Errorf("version %d is not available: %w", deploymentID, err)
+	}
+
+	link := filepath.Join(AppDir(appID), "current")
+	tmpLink := link + ".tmp"
+	os.Remove(tmpLink)
+	// relative so the link also resolves inside the static server container
+	if err := os.Symlink(strconv.FormatInt(deploymentID, 10), tmpLink); err != nil {
+		return err
+	}
+	return os.Rename(tmpLink, link)
+}
+
+// deployment ids of the published versions, newest first
+func ListVersions(appID int64) ([]int64, error) {
+	entries, err := os.ReadDir(AppDir(appID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []int64{}, nil
+		}
+		return nil, err
+	}
+
+	type version struct {
+		id          int64
+		publishedAt int64
+	}
+	var versions []version
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		id, err := strconv.ParseInt(e.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, version{id: id, publishedAt: publishedAt(appID, id, info)})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].publishedAt > versions[j].publishedAt })
+
+	ids := make([]int64, 0, len(versions))
+	for _, v := range versions {
+		ids = append(ids, v.id)
+	}
+	return ids, nil
+}
+
+// deployment id `current` points at, 0 when nothing is published
+func CurrentVersion(appID int64) int64 {
+	target, err := os.Readlink(filepath.Join(AppDir(appID), "current"))
+	if err != nil {
+		return 0
+	}
+	id, _ := strconv.ParseInt(filepath.Base(target), 10, 64)
+	return id
+}
+
+// removes all but the newest `keep` versions, the live one is never removed
+func PruneVersions(appID int64, keep int) error {
+	versions, err := ListVersions(appID)
+	if err != nil {
+		return err
+	}
+	current := CurrentVersion(appID)
+	kept := 0
+	for _, id := range versions {
+		if id == current || kept < keep {
+			kept++
+			continue
+		}
+		if err := os.RemoveAll(VersionDir(appID, id)); err != nil {
+			return err
+		}
+		if err := os.Remove(publishedMarker(appID, id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func RemoveApp(appID int64) error {
+	return os.RemoveAll(AppDir(appID))
+}
+
+// true when path, with its links already resolved, lies inside dir
+func resolvesInside(dir, path string) bool {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(realDir, path)
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		// the repo's git metadata has no business being served
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			// links leaving the output directory would expose files from the host, they are dropped.
+			// the link is resolved for real since a chain of links can look local one at a time
+			if filepath.IsAbs(link) {
+				return nil
+			}
+			resolved, err := filepath.EvalSymlinks(path)
+			if err != nil || !resolvesInside(src, resolved) {
+				return nil
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode())
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
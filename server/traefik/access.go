@@ -0,0 +1,152 @@
+package traefik
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/corecollectives/mist/models"
+)
+
+// what a domain's serving routers check before forwarding, app wide rules included
+type DomainAccess struct {
+	// htpasswd style "user:bcrypt hash" entries for basicAuth
+	Users []string
+	// ranges for ipAllowList with the denied ones already cut out, nil when every address is allowed
+	SourceRange []string
+}
+
+// by domain id
+type AccessRules map[int64]DomainAccess
+
+// resolves the app's users and ip rules into the access of each domain
+func BuildAccessRules(domains []models.Domain, users []models.AccessUser, ipRules []models.AccessIPRule) (AccessRules, error) {
+	rules := AccessRules{}
+	for _, d := range domains {
+		var access DomainAccess
+		for _, u := range users {
+			if appliesTo(u.DomainID, d.ID) {
+				access.Users = append(access.Users, u.Username+":"+u.PasswordHash)
+			}
+		}
+
+		var allow, deny []netip.Prefix
+		for _, rule := range ipRules {
+			if !appliesTo(rule.DomainID, d.ID) {
+				continue
+			}
+			prefix, err := ParseIPSource(rule.Source)
+			if err != nil {
+				return nil, err
+			}
+			if rule.Action == models.IPRuleDeny {
+				deny = append(deny, prefix)
+			} else {
+				allow = append(allow, prefix)
+			}
+		}
+		if len(allow) > 0 || len(deny) > 0 {
+			ranges := allowedRanges(allow, deny)
+			if len(ranges) == 0 {
+				return nil, fmt.Errorf("the ip rules of %s%s deny every address", d.Domain, d.PathPrefix)
+			}
+			for _, p := range ranges {
+				access.SourceRange = append(access.SourceRange, p.String())
+			}
+		}
+
+		if len(access.Users) > 0 || len(access.SourceRange) > 0 {
+			rules[d.ID] = access
+		}
+	}
+	return rules, nil
+}
+
+func appliesTo(scope *int64, domainID int64) bool {
+	return scope == nil || *scope == domainID
+}
+
+// accepts a single address or a cidr range, host bits are masked off
+func ParseIPSource(source string) (netip.Prefix, error) {
+	source = strings.TrimSpace(source)
+	if strings.Contains(source, "/") {
+		prefix, err := netip.ParsePrefix(source)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid cidr range %q", source)
+		}
+		if prefix.Addr().Is4In6() {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), max(prefix.Bits()-96, 0))
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(source)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid ip address %q", source)
+	}
+	addr = addr.Unmap().WithZone("")
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// traefik only has an allow list, so denied ranges are cut out of the allowed ones.
+// with only deny rules everything else stays allowed
+func allowedRanges(allow, deny []netip.Prefix) []netip.Prefix {
+	ranges := allow
+	if len(ranges) == 0 {
+		ranges = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}
+	}
+	for _, d := range deny {
+		var remaining []netip.Prefix
+		for _, p := range ranges {
+			remaining = append(remaining, subtractPrefix(p, d)...)
+		}
+		ranges = remaining
+	}
+	return ranges
+}
+
+// splits p in halves until the parts no longer overlap d, at most one prefix per bit between them
+func subtractPrefix(p, d netip.Prefix) []netip.Prefix {
+	if !p.Overlaps(d) {
+		return []netip.Prefix{p}
+	}
+	if d.Bits() <= p.Bits() {
+		return nil
+	}
+	low := netip.PrefixFrom(p.Addr(), p.Bits()+1)
+	high := netip.PrefixFrom(setBit(p.Addr(), p.Bits()), p.Bits()+1)
+	return append(subtractPrefix(low, d), subtractPrefix(high, d)...)
+}
+
+func setBit(addr netip.Addr, bit int) netip.Addr {
+	b := addr.AsSlice()
+	b[bit/8] |= 0x80 >> (bit % 8)
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+// middlewares for the domain's access rules, ip checks first so blocked clients never get a login prompt
+func (a DomainAccess) middlewares(routing Routing, base, host string) []string {
+	var names []string
+	if len(a.SourceRange) > 0 {
+		name := base + "-ipallow"
+		routing.Middlewares[name] = map[string]any{
+			"ipAllowList": map[string]any{
+				"sourceRange": a.SourceRange,
+			},
+		}
+		names = append(names, name)
+	}
+	if len(a.Users) > 0 {
+		name := base + "-auth"
+		routing.Middlewares[name] = map[string]any{
+			"basicAuth": map[string]any{
+				"users": a.Users,
+				"realm": host,
+				// the app never sees the credentials meant for mist
+				"removeHeader": true,
+			},
+		}
+		names = append(names, name)
+	}
+	return names
+}
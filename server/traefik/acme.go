@@ -0,0 +1,104 @@
+package traefik
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/corecollectives/mist/utils"
+)
+
+// traefik-compose.yml mounts ./letsencrypt, so the store ends up next to it
+var AcmeStorePath = filepath.Join(utils.TraefikStaticDir, "letsencrypt", "acme.json")
+
+// the certificate traefik answers with when it has none for the host
+const traefikDefaultCertName = "TRAEFIK DEFAULT CERT"
+
+type acmeStore map[string]struct {
+	Certificates []struct {
+		Domain struct {
+			Main string   `json:"main"`
+			SANs []string `json:"sans"`
+		} `json:"domain"`
+		Certificate string `json:"certificate"`
+	} `json:"Certificates"`
+}
+
+// leaf certificates of every resolver in traefik's acme store. traefik keeps them base64 encoded pem
+func readAcmeCertificates(path string) ([]*x509.Certificate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var store acmeStore
+	if err := json.Unmarshal(content, &store); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var certs []*x509.Certificate
+	for _, resolver := range store {
+		for _, c := range resolver.Certificates {
+			raw, err := base64.StdEncoding.DecodeString(c.Certificate)
+			if err != nil {
+				continue
+			}
+			block, _ := pem.Decode(raw)
+			if block == nil {
+				continue
+			}
+			leaf, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				continue
+			}
+			certs = append(certs, leaf)
+		}
+	}
+	return certs, nil
+}
+
+// the certificate for host with the latest expiry, nil when there is none
+func findCertificate(certs []*x509.Certificate, host string) *x509.Certificate {
+	var found *x509.Certificate
+	for _, c := range certs {
+		if !certificateCovers(c, host) {
+			continue
+		}
+		if found == nil || c.NotAfter.After(found.NotAfter) {
+			found = c
+		}
+	}
+	return found
+}
+
+// asks the local traefik which certificate it serves for host, used when the acme store can't be read.
+// nil when traefik falls back to its default certificate
+func probeCertificate(host string) (*x509.Certificate, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", "127.0.0.1:443", &tls.Config{
+		ServerName: host,
+		// only the certificate is looked at, the connection itself carries nothing
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	peers := conn.ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		return nil, nil
+	}
+	leaf := peers[0]
+	if strings.EqualFold(leaf.Subject.CommonName, traefikDefaultCertName) || !certificateCovers(leaf, host) {
+		return nil, nil
+	}
+	return leaf, nil
+}
@@ -0,0 +1,284 @@
+package traefik
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// shared nginx container serving every static app
+const StaticServerName = "mist-static"
+
+// same name docker.GetContainerName gives the app's container on traefik-net
+func containerHost(appID int64) string {
+	return fmt.Sprintf("app-%d", appID)
+}
+
+// network alias a routed compose service gets on traefik-net, docker's dns spreads it over every replica
+func ComposeServiceHost(appID int64, service string) string {
+	return fmt.Sprintf("app-%d-%s", appID, SanitizeName(service))
+}
+
+// defaults to 3000 like the deployer does
+func appPort(app *models.App) int {
+	if app.Port != nil {
+		return int(*app.Port)
+	}
+	return 3000
+}
+
+// statuses traefik answers with when the app's container can't be reached. the errors middleware
+// can't tell who produced a response, so a 502 or 504 sent by the app itself (eg. from its own
+// upstream) is replaced by the error page as well, every other status of the app passes through
+var ErrorPageStatuses = []string{"502", "504"}
+
+// pages mist serves for the app, see the public /api/pages route
+func MaintenancePagePath(appID int64) string {
+	return fmt.Sprintf("/api/pages/%d/maintenance", appID)
+}
+
+func ErrorPagePath(appID int64) string {
+	return fmt.Sprintf("/api/pages/%d/error", appID)
+}
+
+// routing for an app from its domains, empty for app types that aren't reachable over http
+func AppRouting(app *models.App, domains []models.Domain, tls TLSSettings, access AccessRules) Routing {
+	routing := NewRouting()
+	if len(domains) == 0 {
+		return routing
+	}
+	name := fmt.Sprintf("app-%d", app.ID)
+	pages := name + "-pages"
+	routing.Services[pages] = loadBalancer(utils.MistHostURL)
+
+	if app.MaintenanceMode {
+		// every route serves the maintenance page, access rules and headers still apply
+		maintenance := name + "-maintenance"
+		routing.Middlewares[maintenance] = map[string]any{
+			"replacePath": map[string]any{
+				"path": MaintenancePagePath(app.ID),
+			},
+		}
+		switch app.AppType {
+		case models.AppTypeWeb, models.AppTypeStatic:
+		case models.AppTypeCompose:
+			var routed []models.Domain
+			for _, route := range composeRoutes(app.ID, domains, appPort(app)) {
+				routed = append(routed, route.domains...)
+			}
+			domains = routed
+		default:
+			return routing
+		}
+		routing.merge(BuildRouting(name, pages, domains, tls, access, maintenance))
+		return routing
+	}
+
+	// a stopped or redeploying container gets the error page instead of traefik's bare 502
+	errorPages := name + "-errors"
+	routing.Middlewares[errorPages] = map[string]any{
+		"errors": map[string]any{
+			"status":  ErrorPageStatuses,
+			"service": pages,
+			"query":   ErrorPagePath(app.ID) + "?status={status}",
+		},
+	}
+
+	switch app.AppType {
+	case models.AppTypeWeb:
+		routing.merge(BuildRouting(name, name, domains, tls, access, errorPages))
+		routing.Services[name] = loadBalancer(fmt.Sprintf("http://%s:%d", containerHost(app.ID), appPort(app)))
+
+	case models.AppTypeStatic:
+		prefix := name + "-static"
+		routing.merge(BuildRouting(name, name, domains, tls, access, errorPages, prefix))
+		routing.Middlewares[prefix] = map[string]any{
+			"addPrefix": map[string]any{
+				"prefix": fmt.Sprintf("/%d/current", app.ID),
+			},
+		}
+		routing.Services[name] = loadBalancer(fmt.Sprintf("http://%s:80", StaticServerName))
+
+	case models.AppTypeCompose:
+		for _, route := range composeRoutes(app.ID, domains, appPort(app)) {
+			routing.merge(BuildRouting(route.name, route.name, route.domains, tls, access, errorPages))
+			routing.Services[route.name] = loadBalancer(fmt.Sprintf("http://%s:%d", ComposeServiceHost(app.ID, route.service), route.port))
+		}
+	}
+	return routing
+}
+
+type composeRoute struct {
+	name    string
+	service string
+	port    int
+	domains []models.Domain
+}
+
+// groups the domains by the service and port they point at, domains without a service aren't routed
+func composeRoutes(appID int64, domains []models.Domain, defaultPort int) []composeRoute {
+	routes := map[string]*composeRoute{}
+	perService := map[string]int{}
+	for _, d := range domains {
+		if d.ComposeService == nil || *d.ComposeService == "" {
+			continue
+		}
+		port := defaultPort
+		if d.ComposePort != nil && *d.ComposePort > 0 {
+			port = *d.ComposePort
+		}
+		key := fmt.Sprintf("%s:%d", *d.ComposeService, port)
+		if routes[key] == nil {
+			routes[key] = &composeRoute{service: *d.ComposeService, port: port}
+			perService[*d.ComposeService]++
+		}
+		routes[key].domains = append(routes[key].domains, d)
+	}
+
+	keys := make([]string, 0, len(routes))
+	for k := range routes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	result := make([]composeRoute, 0, len(keys))
+	for _, k := range keys {
+		route := routes[k]
+		// the port is only part of the name when one service is routed on more than one port
+		route.name = fmt.Sprintf("app-%d-%s", appID, SanitizeName(route.service))
+		if perService[route.service] > 1 {
+			route.name = fmt.Sprintf("%s-%d", route.name, route.port)
+		}
+		result = append(result, *route)
+	}
+	return result
+}
+
+// whether AppRouting gives the domain a router, only routed domains get a certificate
+func domainRouted(app *models.App, d models.Domain) bool {
+	if !d.OwnershipVerified || ValidateHostname(strings.TrimSpace(d.Domain)) != nil {
+		return false
+	}
+	switch app.AppType {
+	case models.AppTypeWeb, models.AppTypeStatic:
+		return true
+	case models.AppTypeCompose:
+		return d.ComposeService != nil && *d.ComposeService != ""
+	}
+	return false
+}
+
+// regenerates the app's routing file from the database, called whenever domains or the app's
+// backend change. containers are never touched, traefik reloads the file on its own
+func RenderApp(appID int64) error {
+	_, err := renderApp(appID)
+	return err
+}
+
+// returns the domains the file was rendered from
+func renderApp(appID int64) ([]models.Domain, error) {
+	renderMu.Lock()
+	defer renderMu.Unlock()
+
+	app, err := models.GetApplicationByID(appID)
+	if err != nil {
+		return nil, fmt.Errorf("get app failed: %w", err)
+	}
+	domains, err := models.GetDomainsByAppID(appID)
+	if err != nil {
+		return nil, fmt.Errorf("get domains failed: %w", err)
+	}
+	// certificates go first, traefik may pick up the routing file the moment it is renamed into place
+	for _, d := range domains {
+		if hasCustomCertificate(d) {
+			if err := writeCertificate(d); err != nil {
+				return nil, err
+			}
+		}
+	}
+	access, err := loadAccessRules(appID, domains)
+	if err != nil {
+		return nil, err
+	}
+	return domains, WriteAppConfig(appID, AppRouting(app, ownedDomains(domains), loadTLSSettings(), access))
+}
+
+// an app whose rules can't be loaded isn't rendered at all, dropping them would expose it
+func loadAccessRules(appID int64, domains []models.Domain) (AccessRules, error) {
+	users, err := models.GetAccessUsersByAppID(appID)
+	if err != nil {
+		return nil, fmt.Errorf("get access users failed: %w", err)
+	}
+	ipRules, err := models.GetAccessIPRulesByAppID(appID)
+	if err != nil {
+		return nil, fmt.Errorf("get ip rules failed: %w", err)
+	}
+	return BuildAccessRules(domains, users, ipRules)
+}
+
+func loadTLSSettings() TLSSettings {
+	settings, err := models.GetSystemSettings()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load system settings for routing")
+	}
+	dns, err := models.GetDNSChallengeSettings()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load dns challenge settings for routing")
+		return TLSSettings{}
+	}
+	return TLSSettings{
+		WildcardBase: wildcardCertificateBase(settings, dns),
+		DNSChallenge: dns.Enabled,
+	}
+}
+
+// brings every routing file in line with the database on startup, files of deleted apps and
+// certificates of deleted domains are removed
+func RenderAllApps() {
+	matches, _ := filepath.Glob(filepath.Join(utils.TraefikConfigDir, "app-*.yml"))
+	rendered := map[string]bool{}
+	certificates := map[int64]bool{}
+	complete := true
+
+	apps, err := models.GetRoutedApps()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load apps for routing")
+		return
+	}
+	for _, app := range apps {
+		domains, err := renderApp(app.ID)
+		if err != nil {
+			log.Warn().Err(err).Int64("app_id", app.ID).Msg("Failed to render app routing")
+			complete = false
+		}
+		for _, d := range domains {
+			if hasCustomCertificate(d) {
+				certificates[d.ID] = true
+			}
+		}
+		rendered[ConfigPath(app.ID)] = true
+	}
+
+	for _, path := range matches {
+		if rendered[path] {
+			continue
+		}
+		idStr := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "app-"), ".yml")
+		if _, err := strconv.ParseInt(idStr, 10, 64); err != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Failed to remove stale routing file")
+		}
+	}
+	// a failed render doesn't say which certificates are still in use
+	if complete {
+		removeStaleCertificates(certificates)
+	}
+}
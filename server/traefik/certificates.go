@@ -0,0 +1,163 @@
+package traefik
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/utils"
+)
+
+// uploaded certificates live below the dynamic directory, which traefik sees at containerConfigDir.
+// the file provider only loads yml and toml files, so certificates and keys next to them are ignored
+const containerConfigDir = "/etc/traefik/dynamic"
+
+var certDir = filepath.Join(utils.TraefikConfigDir, "certs")
+
+type CertificateInfo struct {
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	DNSNames    []string  `json:"dnsNames"`
+	IssuedAt    time.Time `json:"issuedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	Fingerprint string    `json:"fingerprint"`
+
+	// leaf followed by the chain, the way traefik wants to serve it
+	Bundle string `json:"-"`
+	Key    string `json:"-"`
+}
+
+// checks an uploaded certificate before it is stored: the key has to belong to the certificate, the
+// certificate has to cover the domain and must not have expired yet. chain may be empty
+func ParseCertificate(domain, certPEM, keyPEM, chainPEM string) (*CertificateInfo, error) {
+	certPEM = strings.TrimSpace(certPEM)
+	keyPEM = strings.TrimSpace(keyPEM)
+	chainPEM = strings.TrimSpace(chainPEM)
+	if certPEM == "" || keyPEM == "" {
+		return nil, fmt.Errorf("certificate and private key are required")
+	}
+
+	bundle := certPEM + "\n"
+	if chainPEM != "" {
+		bundle += chainPEM + "\n"
+	}
+	pair, err := tls.X509KeyPair([]byte(bundle), []byte(keyPEM+"\n"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate or key: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+	for _, der := range pair.Certificate[1:] {
+		if _, err := x509.ParseCertificate(der); err != nil {
+			return nil, fmt.Errorf("invalid certificate in chain: %w", err)
+		}
+	}
+
+	host := strings.ToLower(strings.TrimSpace(domain))
+	if !certificateCovers(leaf, host) {
+		return nil, fmt.Errorf("certificate doesn't cover %s, it is valid for %s", host, strings.Join(leaf.DNSNames, ", "))
+	}
+	if time.Now().After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate expired on %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	sum := sha256.Sum256(leaf.Raw)
+	return &CertificateInfo{
+		Issuer:      leaf.Issuer.String(),
+		Subject:     leaf.Subject.String(),
+		DNSNames:    leaf.DNSNames,
+		IssuedAt:    leaf.NotBefore,
+		ExpiresAt:   leaf.NotAfter,
+		Fingerprint: hex.EncodeToString(sum[:]),
+		Bundle:      bundle,
+		Key:         keyPEM + "\n",
+	}, nil
+}
+
+func certificateCovers(leaf *x509.Certificate, host string) bool {
+	if !strings.HasPrefix(host, "*.") {
+		return leaf.VerifyHostname(host) == nil
+	}
+	// VerifyHostname can't match a wildcard domain against itself
+	for _, name := range leaf.DNSNames {
+		if strings.EqualFold(name, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// where the domain's certificate and key are kept on the host
+func CertificatePaths(domainID int64) (certPath, keyPath string) {
+	base := filepath.Join(certDir, fmt.Sprintf("domain-%d", domainID))
+	return base + ".crt", base + ".key"
+}
+
+func hasCustomCertificate(d models.Domain) bool {
+	return d.SslProvider == models.SSLProviderCustom && d.CertificateData != nil && d.KeyData != nil
+}
+
+// the tls.certificates entry for a domain, with the paths as traefik sees them
+func certificateEntry(domainID int64) map[string]any {
+	certPath, keyPath := CertificatePaths(domainID)
+	return map[string]any{
+		"certFile": containerPath(certPath),
+		"keyFile":  containerPath(keyPath),
+	}
+}
+
+func containerPath(hostPath string) string {
+	rel, _ := filepath.Rel(utils.TraefikConfigDir, hostPath)
+	return filepath.ToSlash(filepath.Join(containerConfigDir, rel))
+}
+
+// puts the stored certificate and key on disk so the routing file can point traefik at them,
+// the database stays the source of truth and the files are rewritten on every render
+func writeCertificate(d models.Domain) error {
+	if err := os.MkdirAll(certDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	certPath, keyPath := CertificatePaths(d.ID)
+	if err := writeFileAtomic(certPath, []byte(*d.CertificateData), 0o644); err != nil {
+		return fmt.Errorf("failed to write certificate for %s: %w", d.Domain, err)
+	}
+	if err := writeFileAtomic(keyPath, []byte(*d.KeyData), 0o600); err != nil {
+		return fmt.Errorf("failed to write key for %s: %w", d.Domain, err)
+	}
+	return nil
+}
+
+func RemoveCertificate(domainID int64) error {
+	certPath, keyPath := CertificatePaths(domainID)
+	for _, path := range []string{certPath, keyPath} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removes certificate files no custom-certificate domain refers to anymore
+func removeStaleCertificates(keep map[int64]bool) {
+	matches, _ := filepath.Glob(filepath.Join(certDir, "domain-*"))
+	for _, path := range matches {
+		name := strings.TrimPrefix(filepath.Base(path), "domain-")
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ".crt"), ".key")
+		id, err := strconv.ParseInt(name, 10, 64)
+		if err != nil || keep[id] {
+			continue
+		}
+		os.Remove(path)
+	}
+}
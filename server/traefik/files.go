@@ -0,0 +1,86 @@
+package traefik
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/corecollectives/mist/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// renders read the domains and write the file, two of them for the same app must not interleave
+var renderMu sync.Mutex
+
+// every routed app gets its own file next to dynamic.yml, traefik's file provider watches the whole directory
+func ConfigPath(appID int64) string {
+	return filepath.Join(utils.TraefikConfigDir, fmt.Sprintf("app-%d.yml", appID))
+}
+
+// writes the app's routing, an empty routing removes the file
+func WriteAppConfig(appID int64, routing Routing) error {
+	if routing.Empty() {
+		return RemoveAppConfig(appID)
+	}
+
+	config := map[string]any{
+		"http": map[string]any{
+			"routers":     routing.Routers,
+			"middlewares": routing.Middlewares,
+			"services":    routing.Services,
+		},
+	}
+	if len(routing.Certificates) > 0 {
+		config["tls"] = map[string]any{"certificates": routing.Certificates}
+	}
+	content, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to generate routing config: %w", err)
+	}
+	header := []byte(fmt.Sprintf("# generated by mist for app %d, changes will be overwritten\n", appID))
+
+	if err := os.MkdirAll(utils.TraefikConfigDir, 0o755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(ConfigPath(appID), append(header, content...), 0o644); err != nil {
+		return fmt.Errorf("failed to write routing config: %w", err)
+	}
+	return nil
+}
+
+// written under a name traefik ignores and renamed into place, so the watcher never sees half a file
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func RemoveAppConfig(appID int64) error {
+	if err := os.Remove(ConfigPath(appID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// the generated file as traefik sees it, empty when the app isn't routed
+func ReadAppConfig(appID int64) (string, error) {
+	content, err := os.ReadFile(ConfigPath(appID))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(content), err
+}
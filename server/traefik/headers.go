@@ -0,0 +1,148 @@
+package traefik
+
+import (
+	"fmt"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/corecollectives/mist/models"
+)
+
+const maxCustomHeaders = 50
+
+// header names are http tokens
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// checks the headers a domain should get and brings names and values into the form traefik expects
+func NormalizeHeaders(h models.DomainHeaders) (models.DomainHeaders, error) {
+	var err error
+	if h.Request, err = normalizeHeaderMap(h.Request, "request"); err != nil {
+		return h, err
+	}
+	if h.Response, err = normalizeHeaderMap(h.Response, "response"); err != nil {
+		return h, err
+	}
+
+	h.ContentSecurityPolicy = strings.TrimSpace(h.ContentSecurityPolicy)
+	if strings.ContainsAny(h.ContentSecurityPolicy, "\r\n") {
+		return h, fmt.Errorf("content security policy can't contain line breaks")
+	}
+
+	h.FrameOptions = strings.ToUpper(strings.TrimSpace(h.FrameOptions))
+	if h.FrameOptions != "" && h.FrameOptions != "DENY" && h.FrameOptions != "SAMEORIGIN" {
+		return h, fmt.Errorf("frame options must be DENY or SAMEORIGIN")
+	}
+
+	for i, origin := range h.CorsAllowOrigins {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if origin != "*" {
+			u, err := url.Parse(origin)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+				return h, fmt.Errorf("invalid cors origin %q, use scheme://host[:port] or *", origin)
+			}
+		}
+		h.CorsAllowOrigins[i] = origin
+	}
+	if h.CorsAllowCredentials && slices.Contains(h.CorsAllowOrigins, "*") {
+		// browsers refuse credentials for a wildcard origin
+		return h, fmt.Errorf("cors credentials can't be allowed for every origin")
+	}
+	for i, method := range h.CorsAllowMethods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if !headerNamePattern.MatchString(method) {
+			return h, fmt.Errorf("invalid cors method %q", method)
+		}
+		h.CorsAllowMethods[i] = method
+	}
+	for i, name := range h.CorsAllowHeaders {
+		name = strings.TrimSpace(name)
+		if name != "*" && !headerNamePattern.MatchString(name) {
+			return h, fmt.Errorf("invalid cors header %q", name)
+		}
+		h.CorsAllowHeaders[i] = name
+	}
+	if h.CorsMaxAge < 0 {
+		return h, fmt.Errorf("cors max age can't be negative")
+	}
+	return h, nil
+}
+
+func normalizeHeaderMap(headers map[string]string, kind string) (map[string]string, error) {
+	if len(headers) > maxCustomHeaders {
+		return nil, fmt.Errorf("at most %d custom %s headers are allowed", maxCustomHeaders, kind)
+	}
+	normalized := make(map[string]string, len(headers))
+	for name, value := range headers {
+		name = strings.TrimSpace(name)
+		if !headerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid %s header name %q", kind, name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("%s header %s can't contain line breaks", kind, name)
+		}
+		normalized[textproto.CanonicalMIMEHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return normalized, nil
+}
+
+// the domain's own rate limit and headers, headers go first so cors preflights and error
+// responses from later middlewares still get them
+func trafficMiddlewares(routing Routing, base string, d models.Domain) []string {
+	var names []string
+	if !d.Headers.Empty() {
+		name := base + "-headers"
+		routing.Middlewares[name] = map[string]any{
+			"headers": headersConfig(d.Headers),
+		}
+		names = append(names, name)
+	}
+	if d.RateLimitAverage > 0 {
+		name := base + "-ratelimit"
+		routing.Middlewares[name] = map[string]any{
+			"rateLimit": map[string]any{
+				"average": d.RateLimitAverage,
+				"burst":   max(d.RateLimitBurst, 1),
+				"period":  "1s",
+			},
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func headersConfig(h models.DomainHeaders) map[string]any {
+	config := map[string]any{}
+	if len(h.Request) > 0 {
+		config["customRequestHeaders"] = h.Request
+	}
+	if len(h.Response) > 0 {
+		config["customResponseHeaders"] = h.Response
+	}
+	if h.ContentSecurityPolicy != "" {
+		config["contentSecurityPolicy"] = h.ContentSecurityPolicy
+	}
+	if h.FrameOptions != "" {
+		config["customFrameOptionsValue"] = h.FrameOptions
+	}
+	if len(h.CorsAllowOrigins) > 0 {
+		config["accessControlAllowOriginList"] = h.CorsAllowOrigins
+		// caches must not hand one origin's cors response to another
+		config["addVaryHeader"] = true
+		if len(h.CorsAllowMethods) > 0 {
+			config["accessControlAllowMethods"] = h.CorsAllowMethods
+		}
+		if len(h.CorsAllowHeaders) > 0 {
+			config["accessControlAllowHeaders"] = h.CorsAllowHeaders
+		}
+		if h.CorsAllowCredentials {
+			config["accessControlAllowCredentials"] = true
+		}
+		if h.CorsMaxAge > 0 {
+			config["accessControlMaxAge"] = h.CorsMaxAge
+		}
+	}
+	return config
+}
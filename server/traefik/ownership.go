@@ -0,0 +1,139 @@
+package traefik
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/utils"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	domainCheckInterval   = time.Hour
+	ownershipCheckTimeout = 10 * time.Second
+)
+
+// checks the txt record first and the well-known file second, the domain is marked verified on the
+// first one that matches. the error explains what is missing when neither does
+func VerifyOwnership(d *models.Domain) (bool, error) {
+	if err := models.EnsureVerificationToken(d); err != nil {
+		return false, err
+	}
+	host := strings.ToLower(strings.TrimSpace(d.Domain))
+
+	txtErr := utils.CheckOwnershipTXT(host, d.VerificationToken, ownershipCheckTimeout)
+	if txtErr == nil {
+		return true, d.MarkOwnershipVerified(models.VerificationMethodDnsTxt)
+	}
+	httpErr := utils.CheckOwnershipHTTP(host, d.VerificationToken, ownershipCheckTimeout)
+	if httpErr == nil {
+		return true, d.MarkOwnershipVerified(models.VerificationMethodHttp)
+	}
+	return false, errors.Join(txtErr, httpErr)
+}
+
+// domains below the wildcard domain or on a host the project already proved need no proof of their own
+func AutoVerifyOwnership(d *models.Domain) (bool, error) {
+	host := strings.ToLower(strings.TrimSpace(d.Domain))
+	if underWildcardDomain(host) {
+		return true, d.MarkOwnershipVerified(models.VerificationMethodWildcard)
+	}
+
+	app, err := models.GetApplicationByID(d.AppID)
+	if err != nil {
+		return false, err
+	}
+	verified, err := models.HostVerifiedInProject(host, app.ProjectID)
+	if err != nil || !verified {
+		return false, err
+	}
+	return true, d.MarkOwnershipVerified(models.VerificationMethodSharedHost)
+}
+
+// the dashboard's own host is below the wildcard domain too, but never handed to an app
+func underWildcardDomain(host string) bool {
+	if ValidateHostname(host) != nil {
+		return false
+	}
+	settings, err := models.GetSystemSettings()
+	if err != nil || settings.WildcardDomain == nil {
+		return false
+	}
+	base := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(*settings.WildcardDomain), "*"), "."))
+	if base == "" || host == strings.ToLower(settings.MistAppName)+"."+base {
+		return false
+	}
+	return strings.HasSuffix(host, "."+base) && !strings.Contains(host, "*")
+}
+
+// refreshes every domain's dns status and routes domains whose ownership proof showed up since
+func StartDomainMonitor() {
+	go func() {
+		time.Sleep(2 * time.Minute)
+		CheckDomains()
+
+		ticker := time.NewTicker(domainCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			CheckDomains()
+		}
+	}()
+}
+
+func CheckDomains() {
+	domains, err := models.GetAllDomains()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load domains for dns check")
+		return
+	}
+
+	rerender := map[int64]bool{}
+	for i := range domains {
+		d := &domains[i]
+		// wildcard hosts have no records of their own to look up
+		if !strings.Contains(d.Domain, "*") {
+			valid, validationErr := utils.ValidateDNSWithTimeout(d.Domain, 5*time.Second)
+			var errorMsg *string
+			if validationErr != nil {
+				msg := validationErr.Error()
+				errorMsg = &msg
+			}
+			if err := models.UpdateDomainDnsStatus(d.ID, valid, errorMsg); err != nil {
+				log.Warn().Err(err).Int64("domain_id", d.ID).Msg("Failed to update dns status")
+			}
+		}
+
+		if d.OwnershipVerified {
+			continue
+		}
+		verified, err := AutoVerifyOwnership(d)
+		if !verified && err == nil {
+			verified, err = VerifyOwnership(d)
+		}
+		if verified {
+			log.Info().Int64("domain_id", d.ID).Str("domain", d.Domain).Msg("Domain ownership verified")
+			rerender[d.AppID] = true
+		} else if err != nil {
+			log.Debug().Err(err).Str("domain", d.Domain).Msg("Domain ownership not verified yet")
+		}
+	}
+
+	for appID := range rerender {
+		if err := RenderApp(appID); err != nil {
+			log.Warn().Err(err).Int64("app_id", appID).Msg("Failed to route verified domain")
+		}
+	}
+}
+
+// only verified domains are routed
+func ownedDomains(domains []models.Domain) []models.Domain {
+	var owned []models.Domain
+	for _, d := range domains {
+		if d.OwnershipVerified {
+			owned = append(owned, d)
+		}
+	}
+	return owned
+}
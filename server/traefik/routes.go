@@ -0,0 +1,139 @@
+package traefik
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/corecollectives/mist/models"
+)
+
+// explicit priorities only need to beat the rule length traefik uses by default
+const MaxRoutePriority = 10000
+
+// path segments of unreserved and sub-delim characters, backticks would break the rule
+var pathPrefixPattern = regexp.MustCompile(`^(/[A-Za-z0-9._~%!$&'()*+,;=:@-]+)+$`)
+
+// rfc 1123 labels, anything else could break out of the Host rule
+var hostnameLabelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// a hostname, optionally with a leading `*.` for wildcard domains
+func ValidateHostname(host string) error {
+	name := strings.TrimPrefix(strings.ToLower(host), "*.")
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("invalid hostname %q", host)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !hostnameLabelPattern.MatchString(label) {
+			return fmt.Errorf("invalid hostname %q", host)
+		}
+	}
+	return nil
+}
+
+// "" and "/" both route the whole host, a trailing slash is dropped
+func NormalizePathPrefix(prefix string) (string, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" || prefix == "/" {
+		return "", nil
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !pathPrefixPattern.MatchString(prefix) {
+		return "", fmt.Errorf("invalid path prefix %q", prefix)
+	}
+	return prefix, nil
+}
+
+// checks a domain, with its pending changes, against every other route on the hosts it serves
+func ValidateRoute(d models.Domain) error {
+	if err := ValidateHostname(strings.TrimSpace(d.Domain)); err != nil {
+		return err
+	}
+	if d.Priority < 0 || d.Priority > MaxRoutePriority {
+		return fmt.Errorf("priority must be between 0 and %d", MaxRoutePriority)
+	}
+
+	// a www redirect on another domain serves this host too
+	var others []models.Domain
+	seen := map[int64]bool{d.ID: true}
+	for _, host := range candidateHosts(d) {
+		domains, err := models.GetDomainsByHost(host)
+		if err != nil {
+			return err
+		}
+		for _, o := range domains {
+			if !seen[o.ID] {
+				seen[o.ID] = true
+				others = append(others, o)
+			}
+		}
+	}
+	return checkRouteConflicts(d, others)
+}
+
+func checkRouteConflicts(d models.Domain, others []models.Domain) error {
+	for _, host := range servedHosts(d) {
+		for _, o := range others {
+			if !slices.Contains(servedHosts(o), host) {
+				continue
+			}
+			owner := "another app"
+			if o.AppID == d.AppID {
+				owner = "another domain of this app"
+			}
+
+			if o.PathPrefix == d.PathPrefix {
+				return fmt.Errorf("%s%s is already routed by %s", host, d.PathPrefix, owner)
+			}
+			// traefik's PathPrefix matches by string prefix, so /api also takes /apiv2
+			shorter, longer := o, d
+			if strings.HasPrefix(o.PathPrefix, d.PathPrefix) {
+				shorter, longer = d, o
+			} else if !strings.HasPrefix(d.PathPrefix, o.PathPrefix) {
+				continue
+			}
+			if routePriority(shorter, host) >= routePriority(longer, host) {
+				return fmt.Errorf("%s%s would never be reached because %s%s takes priority over it, raise the priority of the longer prefix",
+					host, longer.PathPrefix, host, shorter.PathPrefix)
+			}
+		}
+	}
+	return nil
+}
+
+// without an explicit priority traefik orders routers by the length of their rule
+func routePriority(d models.Domain, host string) int {
+	if d.Priority > 0 {
+		return d.Priority
+	}
+	rule, _ := RouteRule(host, d.PathPrefix)
+	return len(rule)
+}
+
+// hosts the domain's routers match, including the host that only redirects
+func servedHosts(d models.Domain) []string {
+	host := strings.ToLower(strings.TrimSpace(d.Domain))
+	canonical, alias := wwwHosts(host, d)
+	if alias == "" {
+		return []string{canonical}
+	}
+	return []string{canonical, alias}
+}
+
+// hosts that other domains could be stored under while serving one of d's hosts
+func candidateHosts(d models.Domain) []string {
+	var hosts []string
+	for _, host := range servedHosts(d) {
+		apex := strings.TrimPrefix(host, "www.")
+		for _, h := range []string{apex, "www." + apex} {
+			if !slices.Contains(hosts, h) {
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,258 @@
+package traefik
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/corecollectives/mist/models"
+	"github.com/rs/zerolog/log"
+)
+
+// CertResolver is the acme resolver from traefik-static.yml
+const CertResolver = "le"
+
+// routers, middlewares, services and uploaded certificates in the shape of traefik's dynamic configuration
+type Routing struct {
+	Routers      map[string]map[string]any
+	Middlewares  map[string]map[string]any
+	Services     map[string]map[string]any
+	Certificates []map[string]any
+}
+
+func NewRouting() Routing {
+	return Routing{
+		Routers:     map[string]map[string]any{},
+		Middlewares: map[string]map[string]any{},
+		Services:    map[string]map[string]any{},
+	}
+}
+
+func (r Routing) Empty() bool {
+	return len(r.Routers) == 0
+}
+
+func (r *Routing) merge(other Routing) {
+	for k, v := range other.Routers {
+		r.Routers[k] = v
+	}
+	for k, v := range other.Middlewares {
+		r.Middlewares[k] = v
+	}
+	for k, v := range other.Services {
+		r.Services[k] = v
+	}
+	r.Certificates = append(r.Certificates, other.Certificates...)
+}
+
+func loadBalancer(url string) map[string]any {
+	return map[string]any{
+		"loadBalancer": map[string]any{
+			"servers": []map[string]any{
+				{"url": url},
+			},
+		},
+	}
+}
+
+// how certificates are requested for domains without an uploaded one
+type TLSSettings struct {
+	// hosts directly below it share one wildcard certificate, empty when none is requested
+	WildcardBase string
+	DNSChallenge bool
+}
+
+// builds one set of routers per domain so every domain carries its own https, hsts and www settings.
+// name prefixes every router and middleware, service is what the routers forward to and
+// serveMiddlewares run after the domain's own middlewares on routers that serve the app
+func BuildRouting(name, service string, domains []models.Domain, tlsSettings TLSSettings, access AccessRules, serveMiddlewares ...string) Routing {
+	routing := NewRouting()
+
+	for _, d := range domains {
+		host := strings.ToLower(strings.TrimSpace(d.Domain))
+		if host == "" {
+			continue
+		}
+		base := fmt.Sprintf("%s-%s", name, SanitizeName(host))
+		if d.PathPrefix != "" {
+			base += "-" + SanitizeName(strings.TrimPrefix(d.PathPrefix, "/"))
+		}
+		canonical, alias := wwwHosts(host, d)
+		rule, err := RouteRule(canonical, d.PathPrefix)
+		if err != nil {
+			log.Warn().Err(err).Int64("domain_id", d.ID).Msg("Skipping domain with an invalid route")
+			continue
+		}
+
+		tls := tlsSettings.routerTLS(d, host)
+		if hasCustomCertificate(d) {
+			routing.Certificates = append(routing.Certificates, certificateEntry(d.ID))
+		}
+
+		var secureMiddlewares []string
+		if d.HstsEnabled {
+			hsts := base + "-hsts"
+			routing.Middlewares[hsts] = map[string]any{
+				"headers": map[string]any{
+					"stsSeconds": d.HstsMaxAge,
+				},
+			}
+			secureMiddlewares = append(secureMiddlewares, hsts)
+		}
+
+		// headers and rate limits come first, rate limiting ahead of the access checks keeps
+		// password guessing slow. the prefix is stripped before anything else sees the path,
+		// e.g. a static app's addPrefix
+		serve := trafficMiddlewares(routing, base, d)
+		serve = append(serve, access[d.ID].middlewares(routing, base, canonical)...)
+		if d.PathPrefix != "" && d.StripPrefix {
+			strip := base + "-strip"
+			routing.Middlewares[strip] = map[string]any{
+				"stripPrefix": map[string]any{
+					"prefixes": []string{d.PathPrefix},
+				},
+			}
+			serve = append(serve, strip)
+		}
+		serve = append(serve, serveMiddlewares...)
+
+		var plainMiddlewares []string
+		if d.ForceHttps {
+			redirect := base + "-https"
+			routing.Middlewares[redirect] = map[string]any{
+				"redirectScheme": map[string]any{
+					"scheme":    "https",
+					"permanent": true,
+				},
+			}
+			plainMiddlewares = append(plainMiddlewares, redirect)
+		} else {
+			plainMiddlewares = append(plainMiddlewares, serve...)
+		}
+
+		routing.Routers[base] = router(rule, "websecure", tls, service, append(secureMiddlewares, serve...), d.Priority)
+		routing.Routers[base+"-http"] = router(rule, "web", nil, service, plainMiddlewares, d.Priority)
+
+		if alias == "" {
+			continue
+		}
+		aliasRule, err := RouteRule(alias, d.PathPrefix)
+		if err != nil {
+			continue
+		}
+		// the other host only ever redirects, straight to https when that is forced anyway
+		wwwRedirect := base + "-www"
+		replacement := fmt.Sprintf("${1}://%s${3}", canonical)
+		if d.ForceHttps {
+			replacement = fmt.Sprintf("https://%s${3}", canonical)
+		}
+		routing.Middlewares[wwwRedirect] = map[string]any{
+			"redirectRegex": map[string]any{
+				"regex":       fmt.Sprintf(`^(https?)://%s(:[0-9]+)?(.*)$`, regexp.QuoteMeta(alias)),
+				"replacement": replacement,
+				"permanent":   true,
+			},
+		}
+		routing.Routers[base+"-www"] = router(aliasRule, "websecure", tls, service, append(secureMiddlewares, wwwRedirect), d.Priority)
+		routing.Routers[base+"-www-http"] = router(aliasRule, "web", nil, service, []string{wwwRedirect}, d.Priority)
+	}
+	return routing
+}
+
+// tls is only set on websecure routers, priority 0 keeps traefik's default
+func router(rule, entryPoint string, tls map[string]any, service string, middlewares []string, priority int) map[string]any {
+	r := map[string]any{
+		"rule":        rule,
+		"entryPoints": []string{entryPoint},
+		"service":     service,
+	}
+	if priority > 0 {
+		r["priority"] = priority
+	}
+	if tls != nil {
+		r["tls"] = tls
+	}
+	if len(middlewares) > 0 {
+		r["middlewares"] = append([]string{}, middlewares...)
+	}
+	return r
+}
+
+// the host and prefix end up inside backticks, so neither is trusted to be valid already
+func RouteRule(host, pathPrefix string) (string, error) {
+	if err := ValidateHostname(host); err != nil {
+		return "", err
+	}
+	if pathPrefix != "" && !pathPrefixPattern.MatchString(pathPrefix) {
+		return "", fmt.Errorf("invalid path prefix %q", pathPrefix)
+	}
+	// Host only matches literally, a wildcard covers exactly one label like its certificate does
+	rule := fmt.Sprintf("Host(`%s`)", host)
+	if base, ok := strings.CutPrefix(host, "*."); ok {
+		rule = fmt.Sprintf("HostRegexp(`^[a-z0-9-]+\\.%s$`)", regexp.QuoteMeta(strings.ToLower(base)))
+	}
+	if pathPrefix != "" {
+		rule += fmt.Sprintf(" && PathPrefix(`%s`)", pathPrefix)
+	}
+	return rule, nil
+}
+
+// the tls section of a domain's websecure routers
+func (t TLSSettings) routerTLS(d models.Domain, host string) map[string]any {
+	if hasCustomCertificate(d) {
+		// an empty tls section makes traefik pick the uploaded certificate from its store by sni
+		return map[string]any{}
+	}
+	if t.WildcardBase != "" && (host == t.WildcardBase || isDirectSubdomain(host, t.WildcardBase)) {
+		// every router asks for the same certificate, so traefik only requests it once
+		return map[string]any{
+			"certResolver": DNSCertResolver,
+			"domains": []map[string]any{
+				{"main": "*." + t.WildcardBase, "sans": []string{t.WildcardBase}},
+			},
+		}
+	}
+	if strings.HasPrefix(host, "*.") {
+		// traefik can't tell the certificate's name from a HostRegexp rule, and only dns-01 issues wildcards
+		return map[string]any{
+			"certResolver": DNSCertResolver,
+			"domains":      []map[string]any{{"main": host}},
+		}
+	}
+	if t.DNSChallenge && d.AcmeChallengeType == models.AcmeChallengeTypeDns01 {
+		return map[string]any{"certResolver": DNSCertResolver}
+	}
+	return map[string]any{"certResolver": CertResolver}
+}
+
+// a wildcard certificate only covers one label below its base
+func isDirectSubdomain(host, base string) bool {
+	label, ok := strings.CutSuffix(host, "."+base)
+	return ok && label != "" && !strings.Contains(label, ".")
+}
+
+// returns the host to serve and, when www redirects are on, the host that redirects to it
+func wwwHosts(host string, d models.Domain) (canonical, alias string) {
+	if !d.RedirectWww || strings.Contains(host, "*") {
+		return host, ""
+	}
+	apex := strings.TrimPrefix(host, "www.")
+	www := "www." + apex
+	if d.RedirectWwwToRoot {
+		return apex, www
+	}
+	return www, apex
+}
+
+// lowercases and replaces everything traefik doesn't allow in router names with a dash
+func SanitizeName(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,226 @@
+package traefik
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/corecollectives/mist/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	sslCheckInterval = 6 * time.Hour
+	sslExpiryWarning = 14 * 24 * time.Hour
+	// traefik renews let's encrypt certificates 30 days ahead, one this close to expiry means
+	// renewals have been failing for a while
+	sslRenewalOverdue = 20 * 24 * time.Hour
+	// how long a newly verified domain may go without a certificate before it counts as failed
+	sslIssueGracePeriod = time.Hour
+)
+
+// keeps the ssl fields of every domain in line with the certificates traefik actually serves
+func StartSSLMonitor() {
+	go func() {
+		// traefik may still be requesting certificates right after startup
+		time.Sleep(time.Minute)
+		CheckCertificates()
+
+		ticker := time.NewTicker(sslCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			CheckCertificates()
+		}
+	}()
+}
+
+func CheckCertificates() {
+	domains, err := models.GetAllDomains()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load domains for ssl check")
+		return
+	}
+	if len(domains) == 0 {
+		return
+	}
+
+	// the acme store has every certificate at once, probing traefik is the fallback when it can't be read
+	acmeCerts, err := readAcmeCertificates(AcmeStorePath)
+	probe := err != nil
+	if probe {
+		log.Debug().Err(err).Msg("Acme store not readable, probing traefik for certificates")
+	}
+
+	now := time.Now()
+	apps := map[int64]*models.App{}
+	for _, d := range domains {
+		// unverified domains aren't routed, so no certificate is requested for them yet
+		if !d.OwnershipVerified {
+			continue
+		}
+		app, ok := apps[d.AppID]
+		if !ok {
+			app, err = models.GetApplicationByID(d.AppID)
+			if err != nil {
+				continue
+			}
+			apps[d.AppID] = app
+		}
+		if !domainRouted(app, d) {
+			if d.SslStatus != models.SSLStatusNotRouted {
+				if err := models.UpdateDomainCertificateState(d.ID, models.DomainCertificateState{Status: models.SSLStatusNotRouted}); err != nil {
+					log.Warn().Err(err).Int64("domain_id", d.ID).Msg("Failed to update ssl status")
+				}
+			}
+			continue
+		}
+		state, ok := certificateState(d, acmeCerts, probe, now)
+		if !ok {
+			continue
+		}
+		if err := models.UpdateDomainCertificateState(d.ID, state); err != nil {
+			log.Warn().Err(err).Int64("domain_id", d.ID).Msg("Failed to update ssl status")
+			continue
+		}
+		notifyCertificateState(d, state, now)
+	}
+}
+
+// ok is false when the state couldn't be determined, the domain is left as it is then
+func certificateState(d models.Domain, acmeCerts []*x509.Certificate, probe bool, now time.Time) (models.DomainCertificateState, bool) {
+	switch d.SslProvider {
+	case models.SSLProviderNone:
+		return models.DomainCertificateState{Status: models.SSLStatusDisabled}, true
+
+	case models.SSLProviderCustom:
+		// uploaded certificates are never renewed, only their expiry matters
+		state := models.DomainCertificateState{
+			Status:    models.SSLStatusActive,
+			Issuer:    d.Issuer,
+			IssuedAt:  d.IssuedAt,
+			ExpiresAt: d.ExpiresAt,
+		}
+		if d.ExpiresAt != nil && now.After(*d.ExpiresAt) {
+			state.Status = models.SSLStatusExpired
+		}
+		return state, true
+	}
+
+	host := strings.ToLower(strings.TrimSpace(d.Domain))
+	var leaf *x509.Certificate
+	if probe {
+		// wildcard hosts can't be sent as sni, http-01 can't issue for them anyway
+		if strings.Contains(host, "*") {
+			return models.DomainCertificateState{}, false
+		}
+		var err error
+		leaf, err = probeCertificate(host)
+		if err != nil {
+			log.Debug().Err(err).Str("domain", host).Msg("Failed to probe certificate")
+			return models.DomainCertificateState{}, false
+		}
+	} else {
+		leaf = findCertificate(acmeCerts, host)
+	}
+
+	if leaf == nil {
+		// certificates are only requested once the domain is routed, which waits for ownership
+		requestedAt := d.CreatedAt
+		if d.OwnershipVerifiedAt != nil {
+			requestedAt = *d.OwnershipVerifiedAt
+		}
+		// a domain that was just given a route gets until the next check
+		if now.Sub(requestedAt) < sslIssueGracePeriod || d.SslStatus == models.SSLStatusNotRouted {
+			return models.DomainCertificateState{Status: models.SSLStatusPending}, true
+		}
+		msg := "no certificate has been issued yet, check that the domain's dns points at this server"
+		return models.DomainCertificateState{
+			Status:             models.SSLStatusFailed,
+			LastRenewalAttempt: d.LastRenewalAttempt,
+			RenewalError:       &msg,
+		}, true
+	}
+
+	issuer := leaf.Issuer.String()
+	issuedAt, expiresAt := leaf.NotBefore, leaf.NotAfter
+	state := models.DomainCertificateState{
+		Status:    models.SSLStatusActive,
+		Issuer:    &issuer,
+		IssuedAt:  &issuedAt,
+		ExpiresAt: &expiresAt,
+		// the store only records successful issuances, so this is when traefik last renewed
+		LastRenewalAttempt: &issuedAt,
+	}
+	if now.After(expiresAt) {
+		state.Status = models.SSLStatusExpired
+		msg := fmt.Sprintf("certificate expired on %s and hasn't been renewed", expiresAt.Format("2006-01-02"))
+		state.RenewalError = &msg
+	} else if expiresAt.Sub(now) < sslRenewalOverdue {
+		msg := fmt.Sprintf("certificate expires on %s and hasn't been renewed, check that the domain's dns still points at this server", expiresAt.Format("2006-01-02"))
+		state.RenewalError = &msg
+	}
+	return state, true
+}
+
+func notifyCertificateState(d models.Domain, state models.DomainCertificateState, now time.Time) {
+	if state.RenewalError != nil {
+		// repeated daily while the problem lasts
+		notifyDomain(d, models.NotificationSSLRenewalFailed, models.PriorityHigh, now.Add(-24*time.Hour),
+			fmt.Sprintf("SSL certificate problem for %s", d.Domain),
+			*state.RenewalError)
+	}
+
+	if state.ExpiresAt == nil || state.ExpiresAt.Sub(now) > sslExpiryWarning {
+		return
+	}
+	// once per certificate, a renewed certificate moves the window
+	if now.After(*state.ExpiresAt) {
+		notifyDomain(d, models.NotificationSSLExpiryWarning, models.PriorityUrgent, *state.ExpiresAt,
+			fmt.Sprintf("SSL certificate for %s has expired", d.Domain),
+			fmt.Sprintf("The certificate expired on %s, visitors get a certificate error.", state.ExpiresAt.Format("2006-01-02")))
+		return
+	}
+	days := int(state.ExpiresAt.Sub(now).Hours() / 24)
+	message := fmt.Sprintf("The certificate expires on %s (in %d days).", state.ExpiresAt.Format("2006-01-02"), days)
+	if d.SslProvider == models.SSLProviderCustom {
+		message += " Upload a renewed certificate before then."
+	}
+	notifyDomain(d, models.NotificationSSLExpiryWarning, models.PriorityHigh, state.ExpiresAt.Add(-sslExpiryWarning),
+		fmt.Sprintf("SSL certificate for %s expires soon", d.Domain), message)
+}
+
+// notifies every member of the domain's project, unless the same notification went out since `since`
+func notifyDomain(d models.Domain, notificationType models.NotificationType, priority models.NotificationPriority, since time.Time, title, message string) {
+	sent, err := models.HasNotificationSince(notificationType, "domain", d.ID, since)
+	if err != nil || sent {
+		return
+	}
+	app, err := models.GetApplicationByID(d.AppID)
+	if err != nil {
+		return
+	}
+	members, err := models.GetProjectMemberIDs(app.ProjectID)
+	if err != nil {
+		log.Warn().Err(err).Int64("project_id", app.ProjectID).Msg("Failed to load project members for notification")
+		return
+	}
+
+	resourceType := "domain"
+	link := fmt.Sprintf("/projects/%d/apps/%d", app.ProjectID, app.ID)
+	for _, userID := range members {
+		n := &models.Notification{
+			UserID:       &userID,
+			Type:         notificationType,
+			Title:        title,
+			Message:      message,
+			Link:         &link,
+			ResourceType: &resourceType,
+			ResourceID:   &d.ID,
+			Priority:     priority,
+		}
+		if err := n.InsertInDB(); err != nil {
+			log.Warn().Err(err).Int64("domain_id", d.ID).Msg("Failed to create ssl notification")
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package traefik
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/utils"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// DNSCertResolver is the dns-01 resolver mist adds to traefik-static.yml when a dns provider is configured
+const DNSCertResolver = "le-dns"
+
+// read by traefik-compose.yml, lego takes the provider credentials from the environment
+var traefikEnvPath = filepath.Join(utils.TraefikStaticDir, "traefik.env")
+
+var staticPath = filepath.Join(utils.TraefikStaticDir, utils.TraefikStaticFile)
+
+// static config changes mean recreating traefik, one at a time
+var staticMu sync.Mutex
+
+// the static config and environment file traefik needs for the given settings, the dns resolver is
+// removed again when dns-01 is turned off
+func renderStaticConfig(current []byte, s *models.DNSChallengeSettings) ([]byte, []byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(current, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", utils.TraefikStaticFile, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("%s is not a mapping", utils.TraefikStaticFile)
+	}
+
+	resolvers := mappingValue(doc.Content[0], "certificatesResolvers")
+	if resolvers == nil {
+		return nil, nil, fmt.Errorf("certificatesResolvers not found in %s", utils.TraefikStaticFile)
+	}
+	removeMappingKey(resolvers, DNSCertResolver)
+
+	// installs from before file based routing still have the docker provider, it would let a
+	// container's labels route any host around the ownership checks
+	if providers := mappingValue(doc.Content[0], "providers"); providers != nil {
+		removeMappingKey(providers, "docker")
+	}
+
+	var env []byte
+	if s.Enabled {
+		// same account email as the http resolver, both share acme.json
+		email := ""
+		if le := mappingValue(resolvers, CertResolver); le != nil {
+			if acme := mappingValue(le, "acme"); acme != nil {
+				if e := mappingValue(acme, "email"); e != nil {
+					email = e.Value
+				}
+			}
+		}
+		resolver := map[string]any{
+			"acme": map[string]any{
+				"email":   email,
+				"storage": "/letsencrypt/acme.json",
+				"dnsChallenge": map[string]any{
+					"provider": "rfc2136",
+				},
+			},
+		}
+		var key, value yaml.Node
+		key.SetString(DNSCertResolver)
+		if err := value.Encode(resolver); err != nil {
+			return nil, nil, err
+		}
+		resolvers.Content = append(resolvers.Content, &key, &value)
+
+		env = []byte(fmt.Sprintf(
+			"# generated by mist, changes will be overwritten\nRFC2136_NAMESERVER=%s\nRFC2136_TSIG_KEY=%s\nRFC2136_TSIG_ALGORITHM=%s\nRFC2136_TSIG_SECRET=%s\n",
+			s.Nameserver, s.TsigKey, s.TsigAlgorithm, s.TsigSecret,
+		))
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, err
+	}
+	return out.Bytes(), env, nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func removeMappingKey(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// writes the dns resolver into traefik's static config and recreates traefik. when traefik doesn't
+// come back up the previous config is put back, so a typo in the settings can't take every app offline
+func ApplyDNSChallenge(s *models.DNSChallengeSettings) error {
+	staticMu.Lock()
+	defer staticMu.Unlock()
+	return applyStaticConfig(s)
+}
+
+// puts the dns resolver back after an update reset traefik-static.yml and drops the docker provider
+func EnsureStaticConfig() {
+	s, err := models.GetDNSChallengeSettings()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load dns challenge settings")
+		return
+	}
+	staticMu.Lock()
+	defer staticMu.Unlock()
+	if err := applyStaticConfig(s); err != nil {
+		log.Warn().Err(err).Msg("Failed to apply dns challenge resolver")
+	}
+}
+
+// traefik is only recreated when the resolver or its credentials changed
+func applyStaticConfig(s *models.DNSChallengeSettings) error {
+	current, err := os.ReadFile(staticPath)
+	if os.IsNotExist(err) && !s.Enabled {
+		// nothing to add or remove, e.g. when traefik isn't managed by mist
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", utils.TraefikStaticFile, err)
+	}
+	currentEnv, err := os.ReadFile(traefikEnvPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read traefik environment: %w", err)
+	}
+
+	static, env, err := renderStaticConfig(current, s)
+	if err != nil {
+		return err
+	}
+	if resolverConfigured(current) == s.Enabled && bytes.Equal(env, currentEnv) && !dockerProviderConfigured(current) {
+		return nil
+	}
+
+	if err := writeStaticFiles(static, env); err != nil {
+		return err
+	}
+	if err := utils.RecreateTraefik(); err != nil {
+		log.Error().Err(err).Msg("Traefik failed with the new static config, restoring the previous one")
+		if restoreErr := writeStaticFiles(current, currentEnv); restoreErr != nil {
+			return fmt.Errorf("%w, restoring the previous config failed too: %v", err, restoreErr)
+		}
+		if restartErr := utils.RecreateTraefik(); restartErr != nil {
+			return fmt.Errorf("%w, traefik didn't come back with the previous config either: %v", err, restartErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func resolverConfigured(static []byte) bool {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(static, &doc); err != nil || len(doc.Content) == 0 {
+		return false
+	}
+	resolvers := mappingValue(doc.Content[0], "certificatesResolvers")
+	return resolvers != nil && mappingValue(resolvers, DNSCertResolver) != nil
+}
+
+func dockerProviderConfigured(static []byte) bool {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(static, &doc); err != nil || len(doc.Content) == 0 {
+		return false
+	}
+	providers := mappingValue(doc.Content[0], "providers")
+	return providers != nil && mappingValue(providers, "docker") != nil
+}
+
+// an empty env removes the environment file
+func writeStaticFiles(static, env []byte) error {
+	if err := writeFileAtomic(staticPath, static, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", utils.TraefikStaticFile, err)
+	}
+	if len(env) == 0 {
+		if err := os.Remove(traefikEnvPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	// holds the tsig secret
+	if err := writeFileAtomic(traefikEnvPath, env, 0o600); err != nil {
+		return fmt.Errorf("failed to write traefik environment: %w", err)
+	}
+	return nil
+}
+
+// the wildcard certificate's host, empty when it isn't requested
+func wildcardCertificateBase(settings *models.SystemSettings, dns *models.DNSChallengeSettings) string {
+	if settings == nil || dns == nil || !dns.Enabled || !dns.WildcardCertificate || settings.WildcardDomain == nil {
+		return ""
+	}
+	base := strings.TrimPrefix(strings.TrimPrefix(*settings.WildcardDomain, "*"), ".")
+	return strings.ToLower(strings.TrimSpace(base))
+}
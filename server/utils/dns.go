@@ -1,13 +1,24 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"strings"
 	"time"
 )
 
+const (
+	// txt record proving control over a domain's dns, `_mist-verification.example.com`
+	OwnershipTXTPrefix = "_mist-verification"
+	OwnershipTXTValue  = "mist-verification="
+	// file proving control over whatever serves the domain right now
+	OwnershipHTTPPath = "/.well-known/mist-verification.txt"
+)
+
 // returns the public IP, useful when no wildcard domain is configured
 func GetServerIP() (string, error) {
 	// TODO: remove this Getenv, not being used
@@ -71,6 +82,61 @@ func ValidateDNSWithTimeout(domain string, timeout time.Duration) (bool, error)
 	}
 }
 
+// the txt record sits on the wildcard's base for wildcard hosts
+func OwnershipTXTName(host string) string {
+	return OwnershipTXTPrefix + "." + strings.TrimPrefix(host, "*.")
+}
+
+func CheckOwnershipTXT(host, token string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	name := OwnershipTXTName(host)
+	records, err := net.DefaultResolver.LookupTXT(ctx, name)
+	if err != nil {
+		return fmt.Errorf("TXT lookup for %s failed: %w", name, err)
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == OwnershipTXTValue+token {
+			return nil
+		}
+	}
+	return fmt.Errorf("no TXT record %s with value %s%s found", name, OwnershipTXTValue, token)
+}
+
+// redirects are followed on the same host only, e.g. from http to https
+func CheckOwnershipHTTP(host, token string, timeout time.Duration) error {
+	if strings.Contains(host, "*") {
+		return fmt.Errorf("wildcard domains can only be verified with a TXT record")
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !strings.EqualFold(req.URL.Hostname(), host) || len(via) >= 5 {
+				return fmt.Errorf("redirected away from %s", host)
+			}
+			return nil
+		},
+	}
+	url := "http://" + host + OwnershipHTTPPath
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	if strings.TrimSpace(string(body)) != token {
+		return fmt.Errorf("%s does not contain the verification token", url)
+	}
+	return nil
+}
+
 func formatIPs(ips []net.IP) string {
 	strs := make([]string, len(ips))
 	for i, ip := range ips {
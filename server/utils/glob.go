@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// matches a slash separated file path against a glob pattern, same syntax as path.Match
+// plus `**` which matches any number of directories (including none)
+func MatchGlob(pattern string, name string) bool {
+	pattern = strings.Trim(path.Clean("/"+strings.TrimSpace(pattern)), "/")
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if pattern == "" {
+		return name == ""
+	}
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+func ValidateGlob(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("pattern cannot be empty")
+	}
+	if strings.Contains(pattern, ",") {
+		return fmt.Errorf("pattern %q cannot contain a comma", pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return nil
+}
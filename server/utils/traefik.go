@@ -7,6 +7,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
@@ -17,6 +18,8 @@ const (
 	TraefikDynamicFile = "dynamic.yml"
 	TraefikStaticDir   = "/opt/mist"
 	TraefikStaticFile  = "traefik-static.yml"
+	// mist itself as seen from traefik's container, through the docker bridge
+	MistHostURL = "http://172.17.0.1:8080"
 )
 
 // on app startup, its necessary to Initialize the traefik with dynamic config, which includes details about wildcard domain, the file is situated in `/var/lib/mist/traefik/dynamic.yml`
@@ -93,7 +96,7 @@ func generateDynamicYAML(wildcardDomain *string, mistAppName string) ([]byte, er
 		"mist-dashboard": map[string]any{
 			"loadBalancer": map[string]any{
 				"servers": []map[string]any{
-					{"url": "http://172.17.0.1:8080"},
+					{"url": MistHostURL},
 				},
 			},
 		},
@@ -199,3 +202,33 @@ func RestartTraefik() error {
 
 	return nil
 }
+
+// recreates the container instead of restarting it, so changes to the environment file are picked up.
+// returns an error when traefik doesn't stay up
+func RecreateTraefik() error {
+	log.Info().Msg("Recreating Traefik container...")
+
+	cmd := exec.Command("docker", "compose", "-f", path.Join(TraefikStaticDir, "traefik-compose.yml"), "up", "-d", "--force-recreate", "traefik")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("output", string(output)).
+			Msg("Failed to recreate Traefik container")
+		return fmt.Errorf("docker compose up failed: %w", err)
+	}
+
+	// a broken static config makes traefik exit right away, restart: unless-stopped then keeps it restarting
+	time.Sleep(5 * time.Second)
+	state, err := exec.Command("docker", "inspect", "-f", "{{.State.Running}} {{.State.Restarting}}", "traefik").Output()
+	if err != nil {
+		return fmt.Errorf("failed to inspect traefik container: %w", err)
+	}
+	if strings.TrimSpace(string(state)) != "true false" {
+		logs, _ := exec.Command("docker", "logs", "--tail", "20", "traefik").CombinedOutput()
+		return fmt.Errorf("traefik did not start: %s", strings.TrimSpace(string(logs)))
+	}
+
+	log.Info().Msg("Traefik container recreated successfully")
+	return nil
+}
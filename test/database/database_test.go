@@ -1,6 +1,10 @@
 package db
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,8 +12,12 @@ import (
 	"time"
 
 	mistdb "github.com/corecollectives/mist/db"
+	mistfs "github.com/corecollectives/mist/fs"
+	"github.com/corecollectives/mist/github"
 	"github.com/corecollectives/mist/models"
+	"github.com/corecollectives/mist/traefik"
 	"github.com/corecollectives/mist/utils"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -71,7 +79,7 @@ func TestMigrateDb_CreatesAllTables(t *testing.T) {
 		"users", "api_tokens", "apps", "audit_logs", "backups",
 		"deployments", "envs", "projects", "project_members",
 		"git_providers", "github_installations", "app_repositories", "domains",
-		"volumes", "crons", "registries", "sessions", "notifications",
+		"access_users", "access_ip_rules", "volumes", "crons", "registries", "sessions", "notifications",
 	}
 
 	for _, table := range expectedTables {
@@ -2303,3 +2311,1312 @@ func TestRelatedRecordsCascade(t *testing.T) {
 	}
 
 }
+
+func TestDeployHook_CreateAndRotate(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	owner := &models.User{
+		ID:           utils.GenerateRandomId(),
+		Username:     "hookowner",
+		Email:        "hookowner@example.com",
+		PasswordHash: "hash",
+	}
+	owner.Create()
+
+	project := &models.Project{
+		ID:      utils.GenerateRandomId(),
+		Name:    "Hook Project",
+		OwnerID: owner.ID,
+	}
+	project.InsertInDB()
+
+	app := &models.App{
+		ProjectID: project.ID,
+		Name:      "Hook App",
+		CreatedBy: owner.ID,
+	}
+	app.InsertInDB()
+
+	hook, err := models.CreateDeployHook(app.ID, owner.ID, true)
+	if err != nil {
+		t.Fatalf("CreateDeployHook failed: %v", err)
+	}
+	if !hook.SignatureEnabled() {
+		t.Error("hook should have a signing secret")
+	}
+
+	found, err := models.GetDeployHookByToken(hook.Token)
+	if err != nil || found == nil {
+		t.Fatalf("GetDeployHookByToken failed: %v", err)
+	}
+	if found.AppID != app.ID {
+		t.Error("app id should match")
+	}
+	// only the hash is stored, the plain token can't be read back
+	if found.Token != "" || found.TokenHash == hook.Token || found.TokenPrefix != hook.Token[:8] {
+		t.Errorf("token should be stored hashed, got %q %q %q", found.Token, found.TokenHash, found.TokenPrefix)
+	}
+	if _, ok := found.ToJson()["token"]; ok || found.Path() != "" {
+		t.Error("a stored hook should not expose its token")
+	}
+
+	oldToken := hook.Token
+	oldSecret := *hook.Secret
+	if err := hook.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if hook.Token == oldToken || *hook.Secret == oldSecret {
+		t.Error("token and secret should change on rotate")
+	}
+
+	stale, err := models.GetDeployHookByToken(oldToken)
+	if err != nil {
+		t.Fatalf("GetDeployHookByToken failed: %v", err)
+	}
+	if stale != nil {
+		t.Error("old token should no longer resolve")
+	}
+
+	if err := hook.SetSignature(false); err != nil {
+		t.Fatalf("SetSignature failed: %v", err)
+	}
+	byApp, _ := models.GetDeployHookByAppID(app.ID)
+	if byApp == nil || byApp.SignatureEnabled() {
+		t.Error("signature should be disabled")
+	}
+}
+
+func TestApp_WatchPaths(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	owner := &models.User{
+		ID:           utils.GenerateRandomId(),
+		Username:     "monorepoowner",
+		Email:        "monorepoowner@example.com",
+		PasswordHash: "hash",
+	}
+	owner.Create()
+
+	project := &models.Project{
+		ID:      utils.GenerateRandomId(),
+		Name:    "Monorepo Project",
+		OwnerID: owner.ID,
+	}
+	project.InsertInDB()
+
+	app := &models.App{
+		ProjectID:     project.ID,
+		Name:          "api",
+		CreatedBy:     owner.ID,
+		RootDirectory: "services/api",
+	}
+	app.InsertInDB()
+
+	if !app.MatchesChangedFiles([]string{"services/api/main.go"}) {
+		t.Error("default watch path should match files under the root directory")
+	}
+	if app.MatchesChangedFiles([]string{"services/web/index.ts", "README.md"}) {
+		t.Error("default watch path should not match files outside the root directory")
+	}
+
+	app.WatchPaths = []string{"services/api/**", "libs/shared/**"}
+	app.IgnorePaths = []string{"**/*.md"}
+	if err := app.UpdateApplication(); err != nil {
+		t.Fatalf("UpdateApplication failed: %v", err)
+	}
+
+	found, err := models.GetApplicationByID(app.ID)
+	if err != nil {
+		t.Fatalf("GetApplicationByID failed: %v", err)
+	}
+	if len(found.WatchPaths) != 2 || len(found.IgnorePaths) != 1 {
+		t.Fatalf("patterns not persisted, got %v and %v", found.WatchPaths, found.IgnorePaths)
+	}
+	if !found.MatchesChangedFiles([]string{"libs/shared/util/strings.go"}) {
+		t.Error("extra watch path should match")
+	}
+	if found.MatchesChangedFiles([]string{"services/api/README.md"}) {
+		t.Error("ignored files should not trigger a deploy")
+	}
+}
+
+func TestApp_FindByGitRepoAndRef(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	owner := &models.User{
+		ID:           utils.GenerateRandomId(),
+		Username:     "triggerowner",
+		Email:        "triggerowner@example.com",
+		PasswordHash: "hash",
+	}
+	owner.Create()
+
+	project := &models.Project{
+		ID:      utils.GenerateRandomId(),
+		Name:    "Trigger Project",
+		OwnerID: owner.ID,
+	}
+	project.InsertInDB()
+
+	repo := "acme/shop"
+	releasePattern := "release/*"
+	tagPattern := "v*"
+
+	mainApp := &models.App{ProjectID: project.ID, Name: "main", CreatedBy: owner.ID, GitRepository: &repo, GitBranch: "main"}
+	mainApp.InsertInDB()
+	releaseApp := &models.App{ProjectID: project.ID, Name: "release", CreatedBy: owner.ID, GitRepository: &repo,
+		TriggerType: models.TriggerBranchPattern, TriggerPattern: &releasePattern}
+	releaseApp.InsertInDB()
+	tagApp := &models.App{ProjectID: project.ID, Name: "prod", CreatedBy: owner.ID, GitRepository: &repo,
+		TriggerType: models.TriggerTag, TriggerPattern: &tagPattern}
+	tagApp.InsertInDB()
+
+	cases := map[string]int64{
+		"refs/heads/main":        mainApp.ID,
+		"refs/heads/release/1.4": releaseApp.ID,
+		"refs/tags/v1.4.0":       tagApp.ID,
+	}
+	for ref, expected := range cases {
+		apps, err := models.FindApplicationsByGitRepoAndRef(repo, ref)
+		if err != nil {
+			t.Fatalf("FindApplicationsByGitRepoAndRef failed: %v", err)
+		}
+		if len(apps) != 1 || apps[0].ID != expected {
+			t.Errorf("expected exactly one match for %s, got %d", ref, len(apps))
+		}
+	}
+
+	apps, _ := models.FindApplicationsByGitRepoAndRef(repo, "refs/heads/feature/x")
+	if len(apps) != 0 {
+		t.Errorf("expected no match for unrelated branch, got %d", len(apps))
+	}
+}
+
+func TestWebhookDelivery_StoreAndFinish(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	delivery := &models.WebhookDelivery{
+		Source: "github",
+		Event:  "push",
+	}
+	if err := delivery.InsertInDB(); err != nil {
+		t.Fatalf("InsertInDB failed: %v", err)
+	}
+
+	// the content only follows once the signature is verified
+	if err := delivery.StoreContent(`{"X-Github-Event":["push"]}`, `{"ref":"refs/heads/main"}`); err != nil {
+		t.Fatalf("StoreContent failed: %v", err)
+	}
+	delivery.SignatureValid = true
+	delivery.AppIDs = []int64{11, 12}
+	delivery.DeploymentIDs = []int64{21}
+	if err := delivery.Finish(models.WebhookDeliveryProcessed, ""); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+
+	found, err := models.GetWebhookDeliveryByID(delivery.ID)
+	if err != nil || found == nil {
+		t.Fatalf("GetWebhookDeliveryByID failed: %v", err)
+	}
+	if found.Status != models.WebhookDeliveryProcessed || !found.SignatureValid {
+		t.Errorf("unexpected status %s / signature %v", found.Status, found.SignatureValid)
+	}
+	if len(found.AppIDs) != 2 || len(found.DeploymentIDs) != 1 || found.DeploymentIDs[0] != 21 {
+		t.Errorf("ids not persisted, got %v and %v", found.AppIDs, found.DeploymentIDs)
+	}
+	if found.Payload != delivery.Payload {
+		t.Error("payload should be stored as received")
+	}
+
+	list, err := models.GetWebhookDeliveries(string(models.WebhookDeliveryProcessed), 10, 0)
+	if err != nil {
+		t.Fatalf("GetWebhookDeliveries failed: %v", err)
+	}
+	if len(list) != 1 || list[0].Payload != "" {
+		t.Error("list should contain the delivery without its payload")
+	}
+}
+
+func TestDeployment_GetUnfinishedDeploymentsBefore(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	owner := &models.User{
+		ID:           utils.GenerateRandomId(),
+		Username:     "supersedeowner",
+		Email:        "supersedeowner@example.com",
+		PasswordHash: "hash",
+	}
+	owner.Create()
+
+	project := &models.Project{
+		ID:      utils.GenerateRandomId(),
+		Name:    "Supersede Project",
+		OwnerID: owner.ID,
+	}
+	project.InsertInDB()
+
+	app := &models.App{ProjectID: project.ID, Name: "web", CreatedBy: owner.ID}
+	app.InsertInDB()
+
+	finished := &models.Deployment{AppID: app.ID, CommitHash: "aaa"}
+	finished.CreateDeployment()
+	models.UpdateDeploymentStatus(finished.ID, "success", "success", 100, nil)
+
+	running := &models.Deployment{AppID: app.ID, CommitHash: "bbb"}
+	running.CreateDeployment()
+	models.UpdateDeploymentStatus(running.ID, "building", "building", 50, nil)
+
+	pending := &models.Deployment{AppID: app.ID, CommitHash: "ccc"}
+	pending.CreateDeployment()
+
+	extracting := &models.Deployment{AppID: app.ID, CommitHash: "eee"}
+	extracting.CreateDeployment()
+	models.UpdateDeploymentStatus(extracting.ID, "extracting", "extracting", 20, nil)
+
+	newest := &models.Deployment{AppID: app.ID, CommitHash: "ddd"}
+	newest.CreateDeployment()
+
+	older, err := models.GetUnfinishedDeploymentsBefore(app.ID, newest)
+	if err != nil {
+		t.Fatalf("GetUnfinishedDeploymentsBefore failed: %v", err)
+	}
+	if len(older) != 3 {
+		t.Fatalf("expected the running, extracting and pending deployments, got %d", len(older))
+	}
+	for _, d := range older {
+		if d.ID == newest.ID || d.ID == finished.ID {
+			t.Errorf("unexpected deployment %d in result", d.ID)
+		}
+	}
+}
+
+func TestAppRepositories_AutoDeployLookup(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	owner := &models.User{
+		ID:           utils.GenerateRandomId(),
+		Username:     "extrarepoowner",
+		Email:        "extrarepoowner@example.com",
+		PasswordHash: "hash",
+	}
+	owner.Create()
+
+	project := &models.Project{
+		ID:      utils.GenerateRandomId(),
+		Name:    "Extra Repo Project",
+		OwnerID: owner.ID,
+	}
+	project.InsertInDB()
+
+	app := &models.App{ProjectID: project.ID, Name: "api", CreatedBy: owner.ID}
+	app.InsertInDB()
+
+	path, err := models.CleanAppRepositoryPath("./vendor/proto/")
+	if err != nil || path != "vendor/proto" {
+		t.Fatalf("unexpected cleaned path %q: %v", path, err)
+	}
+	for _, bad := range []string{"", ".", "../outside", "/abs", ".git/hooks"} {
+		if _, err := models.CleanAppRepositoryPath(bad); err == nil {
+			t.Errorf("path %q should be rejected", bad)
+		}
+	}
+
+	repo := &models.AppRepositories{
+		AppID:        app.ID,
+		SourceType:   models.SourceGithubApp,
+		SourceID:     1,
+		RepoFullName: "acme/proto",
+		RepoURL:      "https://github.com/acme/proto.git",
+		Path:         path,
+		AutoDeploy:   true,
+	}
+	if err := repo.InsertInDB(); err != nil {
+		t.Fatalf("InsertInDB failed: %v", err)
+	}
+
+	found, err := models.FindAutoDeployAppRepositories("acme/proto", "main")
+	if err != nil {
+		t.Fatalf("FindAutoDeployAppRepositories failed: %v", err)
+	}
+	if len(found) != 1 || found[0].AppID != app.ID {
+		t.Fatalf("expected the extra repository to match, got %d", len(found))
+	}
+
+	repo.AutoDeploy = false
+	if err := repo.Update(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	found, _ = models.FindAutoDeployAppRepositories("acme/proto", "main")
+	if len(found) != 0 {
+		t.Error("repositories without auto deploy should not match")
+	}
+}
+
+func TestAppRepositories_CloneCredentialsStayOnGithub(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	inst := &models.GithubInstallation{
+		InstallationID: 5151,
+		AccountLogin:   "acme",
+		AccountType:    "Organization",
+		AccessToken:    "ghs_installation_token",
+		TokenExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := inst.InsertOrReplace(); err != nil {
+		t.Fatalf("InsertOrReplace failed: %v", err)
+	}
+
+	repo := &models.AppRepositories{
+		SourceType:   models.SourceGithubApp,
+		SourceID:     inst.InstallationID,
+		RepoFullName: "acme/proto",
+		RepoURL:      "https://attacker.example.com/acme/proto.git",
+	}
+	cloneURL, token, err := repo.CloneCredentials()
+	if err != nil {
+		t.Fatalf("CloneCredentials failed: %v", err)
+	}
+	if token != inst.AccessToken {
+		t.Errorf("expected the installation token, got %q", token)
+	}
+	// a foreign url must never be paired with the installation token
+	if cloneURL != "https://github.com/acme/proto.git" {
+		t.Errorf("clone url should always point at github, got %q", cloneURL)
+	}
+}
+
+func TestGithubInstallation_SharedScopes(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	installer := &models.User{ID: utils.GenerateRandomId(), Username: "installer", Email: "installer@example.com", PasswordHash: "hash"}
+	installer.Create()
+	member := &models.User{ID: utils.GenerateRandomId(), Username: "member", Email: "member@example.com", PasswordHash: "hash"}
+	member.Create()
+
+	project := &models.Project{ID: utils.GenerateRandomId(), Name: "Org Project", OwnerID: installer.ID}
+	project.InsertInDB()
+	if err := models.UpdateProjectMembers(project.ID, []int64{installer.ID, member.ID}); err != nil {
+		t.Fatalf("UpdateProjectMembers failed: %v", err)
+	}
+
+	inst := &models.GithubInstallation{
+		InstallationID: 4242,
+		AccountLogin:   "Acme-Org",
+		AccountType:    "Organization",
+		UserID:         int(installer.ID),
+	}
+	if err := inst.InsertOrReplace(); err != nil {
+		t.Fatalf("InsertOrReplace failed: %v", err)
+	}
+
+	found, err := models.GetInstallationForRepo("acme-org/api")
+	if err != nil || found == nil || found.InstallationID != 4242 {
+		t.Fatalf("installation should resolve from the repo owner, got %v (%v)", found, err)
+	}
+
+	canUse, _ := models.CanUserUseInstallation(member.ID, found, project.ID)
+	if canUse {
+		t.Error("user scoped installation should not be usable by other members")
+	}
+
+	if err := found.SetScope(models.InstallationScopeProject, &project.ID); err != nil {
+		t.Fatalf("SetScope failed: %v", err)
+	}
+	canUse, _ = models.CanUserUseInstallation(member.ID, found, project.ID)
+	if !canUse {
+		t.Error("project members should be able to use a project scoped installation")
+	}
+	accessible, err := models.GetAccessibleInstallations(member.ID)
+	if err != nil || len(accessible) != 1 {
+		t.Errorf("expected one accessible installation, got %d (%v)", len(accessible), err)
+	}
+
+	// re-installing must not reset who the installation is shared with
+	inst.AccessToken = "new-token"
+	if err := inst.InsertOrReplace(); err != nil {
+		t.Fatalf("InsertOrReplace failed: %v", err)
+	}
+	found, _ = models.GetInstallationByInstallationID(4242)
+	if found.Scope != models.InstallationScopeProject {
+		t.Errorf("scope should survive re-install, got %s", found.Scope)
+	}
+}
+
+func TestDeployment_UpdateCommitInfo(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	owner := &models.User{
+		ID:           utils.GenerateRandomId(),
+		Username:     "commitinfoowner",
+		Email:        "commitinfoowner@example.com",
+		PasswordHash: "hash",
+	}
+	owner.Create()
+
+	project := &models.Project{
+		ID:      utils.GenerateRandomId(),
+		Name:    "Commit Info Project",
+		OwnerID: owner.ID,
+	}
+	project.InsertInDB()
+
+	app := &models.App{ProjectID: project.ID, Name: "web", CreatedBy: owner.ID}
+	app.InsertInDB()
+
+	pushAuthor := "octocat"
+	dep := &models.Deployment{AppID: app.ID, CommitHash: "abc", CommitAuthor: &pushAuthor}
+	dep.CreateDeployment()
+
+	message := "fix: things"
+	author := "The Octocat"
+	when := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	summary := "2 files changed, 3 insertions(+), 1 deletions(-)"
+	if err := models.UpdateDeploymentCommitInfo(dep.ID, &message, &author, &when, &summary); err != nil {
+		t.Fatalf("UpdateDeploymentCommitInfo failed: %v", err)
+	}
+
+	got, err := models.GetDeploymentByID(dep.ID)
+	if err != nil {
+		t.Fatalf("GetDeploymentByID failed: %v", err)
+	}
+	if got.CommitAuthor == nil || *got.CommitAuthor != pushAuthor {
+		t.Errorf("expected the webhook author to be kept, got %v", got.CommitAuthor)
+	}
+	if got.CommitMessage == nil || *got.CommitMessage != message {
+		t.Errorf("expected commit message to be filled, got %v", got.CommitMessage)
+	}
+	if got.CommitTimestamp == nil || !got.CommitTimestamp.Equal(when) {
+		t.Errorf("expected commit timestamp %v, got %v", when, got.CommitTimestamp)
+	}
+	if got.ChangedFiles == nil || *got.ChangedFiles != summary {
+		t.Errorf("expected changed files summary, got %v", got.ChangedFiles)
+	}
+}
+
+func TestDomain_ComposeTarget(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	owner := &models.User{
+		ID:           utils.GenerateRandomId(),
+		Username:     "composeowner",
+		Email:        "composeowner@example.com",
+		PasswordHash: "hash",
+	}
+	owner.Create()
+
+	project := &models.Project{
+		ID:      utils.GenerateRandomId(),
+		Name:    "Compose Project",
+		OwnerID: owner.ID,
+	}
+	project.InsertInDB()
+
+	app := &models.App{ProjectID: project.ID, Name: "stack", CreatedBy: owner.ID, AppType: models.AppTypeCompose}
+	app.InsertInDB()
+
+	domain, err := models.CreateDomain(app.ID, "stack.example.com")
+	if err != nil {
+		t.Fatalf("CreateDomain failed: %v", err)
+	}
+
+	service := "web"
+	port := 8080
+	if err := models.UpdateDomainComposeTarget(domain.ID, &service, &port); err != nil {
+		t.Fatalf("UpdateDomainComposeTarget failed: %v", err)
+	}
+
+	got, err := models.GetDomainByID(domain.ID)
+	if err != nil {
+		t.Fatalf("GetDomainByID failed: %v", err)
+	}
+	if got.ComposeService == nil || *got.ComposeService != service {
+		t.Errorf("expected compose service %q, got %v", service, got.ComposeService)
+	}
+	if got.ComposePort == nil || *got.ComposePort != port {
+		t.Errorf("expected compose port %d, got %v", port, got.ComposePort)
+	}
+
+	if err := models.UpdateDomainComposeTarget(domain.ID, nil, nil); err != nil {
+		t.Fatalf("UpdateDomainComposeTarget failed: %v", err)
+	}
+	got, _ = models.GetDomainByID(domain.ID)
+	if got.ComposeService != nil || got.ComposePort != nil {
+		t.Errorf("expected compose target to be cleared, got %v:%v", got.ComposeService, got.ComposePort)
+	}
+}
+
+func TestApp_InlineComposeDefinition(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	owner := &models.User{
+		ID:           utils.GenerateRandomId(),
+		Username:     "inlineowner",
+		Email:        "inlineowner@example.com",
+		PasswordHash: "hash",
+	}
+	owner.Create()
+
+	project := &models.Project{
+		ID:      utils.GenerateRandomId(),
+		Name:    "Inline Project",
+		OwnerID: owner.ID,
+	}
+	project.InsertInDB()
+
+	repo := "owner/stack"
+	app := &models.App{ProjectID: project.ID, Name: "inline", CreatedBy: owner.ID, AppType: models.AppTypeCompose, GitRepository: &repo}
+	app.InsertInDB()
+
+	definition := "services:\n  web:\n    image: nginx\n"
+	if err := models.UpdateAppComposeDefinition(app.ID, &definition); err != nil {
+		t.Fatalf("UpdateAppComposeDefinition failed: %v", err)
+	}
+
+	got, err := models.GetApplicationByID(app.ID)
+	if err != nil {
+		t.Fatalf("GetApplicationByID failed: %v", err)
+	}
+	if !got.HasInlineCompose() || *got.ComposeDefinition != definition {
+		t.Errorf("expected inline definition to be saved, got %v", got.ComposeDefinition)
+	}
+
+	apps, err := models.FindApplicationsByGitRepoAndRef(repo, "refs/heads/main")
+	if err != nil {
+		t.Fatalf("FindApplicationsByGitRepoAndRef failed: %v", err)
+	}
+	if len(apps) != 0 {
+		t.Errorf("expected pushes to skip inline compose apps, got %d apps", len(apps))
+	}
+
+	blank := "  \n"
+	if err := models.UpdateAppComposeDefinition(app.ID, &blank); err != nil {
+		t.Fatalf("UpdateAppComposeDefinition failed: %v", err)
+	}
+	got, _ = models.GetApplicationByID(app.ID)
+	if got.ComposeDefinition != nil || got.HasInlineCompose() {
+		t.Errorf("expected blank definition to be cleared, got %v", got.ComposeDefinition)
+	}
+}
+
+func TestDomain_RoutingSettings(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	app := &models.App{ProjectID: utils.GenerateRandomId(), Name: "routed", CreatedBy: utils.GenerateRandomId()}
+	app.InsertInDB()
+
+	domain, err := models.CreateDomain(app.ID, "routed.example.com")
+	if err != nil {
+		t.Fatalf("CreateDomain failed: %v", err)
+	}
+	if !domain.ForceHttps {
+		t.Errorf("expected new domains to force https")
+	}
+
+	settings := models.DomainRoutingSettings{
+		ForceHttps:        false,
+		HstsEnabled:       true,
+		HstsMaxAge:        600,
+		RedirectWww:       true,
+		RedirectWwwToRoot: false,
+	}
+	if err := models.UpdateDomainRoutingSettings(domain.ID, settings); err != nil {
+		t.Fatalf("UpdateDomainRoutingSettings failed: %v", err)
+	}
+
+	got, err := models.GetDomainByID(domain.ID)
+	if err != nil {
+		t.Fatalf("GetDomainByID failed: %v", err)
+	}
+	if got.ForceHttps || !got.HstsEnabled || got.HstsMaxAge != 600 || !got.RedirectWww || got.RedirectWwwToRoot {
+		t.Errorf("settings not saved as expected: %+v", got)
+	}
+}
+
+func TestDomain_CustomCertificate(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	app := &models.App{ProjectID: utils.GenerateRandomId(), Name: "custom-cert", CreatedBy: utils.GenerateRandomId()}
+	app.InsertInDB()
+
+	domain, err := models.CreateDomain(app.ID, "secure.example.com")
+	if err != nil {
+		t.Fatalf("CreateDomain failed: %v", err)
+	}
+
+	expires := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second)
+	err = models.SetDomainCertificate(domain.ID, models.CustomCertificate{
+		Certificate:     "cert",
+		Key:             "key",
+		CertificatePath: "/certs/domain.crt",
+		KeyPath:         "/certs/domain.key",
+		Issuer:          "CN=Example CA",
+		IssuedAt:        time.Now().Truncate(time.Second),
+		ExpiresAt:       expires,
+	})
+	if err != nil {
+		t.Fatalf("SetDomainCertificate failed: %v", err)
+	}
+
+	got, _ := models.GetDomainByID(domain.ID)
+	if got.SslProvider != models.SSLProviderCustom || got.SslStatus != models.SSLStatusActive || got.AutoRenew {
+		t.Errorf("expected an active custom certificate without auto renew, got %+v", got)
+	}
+	if got.Issuer == nil || *got.Issuer != "CN=Example CA" || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expires) {
+		t.Errorf("certificate details not saved: %+v", got)
+	}
+	if got.KeyData == nil || *got.KeyData != "key" {
+		t.Errorf("expected key to be stored")
+	}
+
+	if err := models.ClearDomainCertificate(domain.ID); err != nil {
+		t.Fatalf("ClearDomainCertificate failed: %v", err)
+	}
+	got, _ = models.GetDomainByID(domain.ID)
+	if got.SslProvider != models.SSLProvider || got.CertificateData != nil || got.KeyData != nil || got.ExpiresAt != nil || !got.AutoRenew {
+		t.Errorf("expected certificate to be cleared, got %+v", got)
+	}
+}
+
+func TestDomain_CertificateStateAndNotifications(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	app := &models.App{ProjectID: utils.GenerateRandomId(), Name: "monitored", CreatedBy: utils.GenerateRandomId()}
+	app.InsertInDB()
+
+	domain, err := models.CreateDomain(app.ID, "monitored.example.com")
+	if err != nil {
+		t.Fatalf("CreateDomain failed: %v", err)
+	}
+
+	issuer := "CN=R11,O=Let's Encrypt,C=US"
+	issued := time.Now().Add(-80 * 24 * time.Hour).Truncate(time.Second)
+	expires := issued.Add(90 * 24 * time.Hour)
+	msg := "certificate expires soon and hasn't been renewed"
+	err = models.UpdateDomainCertificateState(domain.ID, models.DomainCertificateState{
+		Status:             models.SSLStatusActive,
+		Issuer:             &issuer,
+		IssuedAt:           &issued,
+		ExpiresAt:          &expires,
+		LastRenewalAttempt: &issued,
+		RenewalError:       &msg,
+	})
+	if err != nil {
+		t.Fatalf("UpdateDomainCertificateState failed: %v", err)
+	}
+
+	got, _ := models.GetDomainByID(domain.ID)
+	if got.SslStatus != models.SSLStatusActive || got.Issuer == nil || *got.Issuer != issuer {
+		t.Errorf("expected active certificate from %s, got %+v", issuer, got)
+	}
+	if got.RenewalError == nil || got.LastRenewalAttempt == nil || !got.LastRenewalAttempt.Equal(issued) {
+		t.Errorf("expected renewal details to be saved, got %+v", got)
+	}
+
+	resourceType := "domain"
+	n := &models.Notification{
+		Type:         models.NotificationSSLExpiryWarning,
+		Title:        "expires soon",
+		Message:      "expires soon",
+		ResourceType: &resourceType,
+		ResourceID:   &domain.ID,
+	}
+	if err := n.InsertInDB(); err != nil {
+		t.Fatalf("InsertInDB failed: %v", err)
+	}
+
+	sent, err := models.HasNotificationSince(models.NotificationSSLExpiryWarning, "domain", domain.ID, time.Now().Add(-time.Hour))
+	if err != nil || !sent {
+		t.Errorf("expected the warning to be found, got %v %v", sent, err)
+	}
+	sent, _ = models.HasNotificationSince(models.NotificationSSLRenewalFailed, "domain", domain.ID, time.Now().Add(-time.Hour))
+	if sent {
+		t.Errorf("expected no renewal failure notification")
+	}
+	sent, _ = models.HasNotificationSince(models.NotificationSSLExpiryWarning, "domain", domain.ID, time.Now().Add(time.Hour))
+	if sent {
+		t.Errorf("expected notifications before since to be ignored")
+	}
+}
+
+func TestSystemSettings_DNSChallenge(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	settings, err := models.GetDNSChallengeSettings()
+	if err != nil {
+		t.Fatalf("GetDNSChallengeSettings failed: %v", err)
+	}
+	if settings.Enabled || settings.WildcardCertificate || settings.TsigAlgorithm != "hmac-sha256." {
+		t.Errorf("unexpected defaults: %+v", settings)
+	}
+
+	err = models.UpdateDNSChallengeSettings(models.DNSChallengeSettings{
+		Enabled:             true,
+		Nameserver:          "127.0.0.1:53",
+		TsigKey:             "mist-key.",
+		TsigAlgorithm:       "hmac-sha512.",
+		TsigSecret:          "c2VjcmV0",
+		WildcardCertificate: true,
+	})
+	if err != nil {
+		t.Fatalf("UpdateDNSChallengeSettings failed: %v", err)
+	}
+
+	settings, _ = models.GetDNSChallengeSettings()
+	if !settings.Enabled || !settings.WildcardCertificate || settings.Nameserver != "127.0.0.1:53" ||
+		settings.TsigKey != "mist-key." || settings.TsigAlgorithm != "hmac-sha512." || settings.TsigSecret != "c2VjcmV0" {
+		t.Errorf("settings not saved as expected: %+v", settings)
+	}
+
+	if challenge, err := models.ParseAcmeChallengeType(""); err != nil || challenge != models.AcmeChallengeTypeHttp01 {
+		t.Errorf("expected empty challenge type to mean http-01, got %v %v", challenge, err)
+	}
+	if challenge, err := models.ParseAcmeChallengeType("dns-01"); err != nil || challenge != models.AcmeChallengeTypeDns01 {
+		t.Errorf("expected dns-01, got %v %v", challenge, err)
+	}
+	if _, err := models.ParseAcmeChallengeType("tls-alpn-01"); err == nil {
+		t.Errorf("expected tls-alpn-01 to be rejected")
+	}
+}
+
+func TestDomain_SharedHostRoutes(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	// databases from before path prefixes have the host alone as unique index
+	db.Exec("DROP INDEX IF EXISTS idx_domains_host_path")
+	if err := db.Exec("CREATE UNIQUE INDEX idx_domains_domain_name ON domains(domain_name)").Error; err != nil {
+		t.Fatalf("failed to create legacy index: %v", err)
+	}
+	if err := mistdb.MigrateDB(db); err != nil {
+		t.Fatalf("MigrateDB failed: %v", err)
+	}
+
+	frontend := &models.App{ProjectID: utils.GenerateRandomId(), Name: "frontend", CreatedBy: utils.GenerateRandomId()}
+	frontend.InsertInDB()
+	api := &models.App{ProjectID: frontend.ProjectID, Name: "api", CreatedBy: frontend.CreatedBy}
+	api.InsertInDB()
+
+	if _, err := models.CreateDomain(frontend.ID, "shared.example.com"); err != nil {
+		t.Fatalf("CreateDomain failed: %v", err)
+	}
+	route := models.DomainRoute{PathPrefix: "/api", StripPrefix: true, Priority: 50}
+	apiDomain, err := models.CreateDomainRoute(api.ID, "shared.example.com", route)
+	if err != nil {
+		t.Fatalf("expected a second route on the same host, got %v", err)
+	}
+	if apiDomain.PathPrefix != "/api" || !apiDomain.StripPrefix || apiDomain.Priority != 50 {
+		t.Errorf("route not saved: %+v", apiDomain)
+	}
+	if _, err := models.CreateDomainRoute(frontend.ID, "shared.example.com", models.DomainRoute{PathPrefix: "/api"}); err == nil {
+		t.Errorf("expected the same host and prefix to be rejected")
+	}
+
+	domains, err := models.GetDomainsByHost("SHARED.example.com")
+	if err != nil || len(domains) != 2 {
+		t.Fatalf("expected 2 routes on the host, got %d (%v)", len(domains), err)
+	}
+
+	if err := models.UpdateDomainRoute(apiDomain.ID, models.DomainRoute{PathPrefix: "/v2"}); err != nil {
+		t.Fatalf("UpdateDomainRoute failed: %v", err)
+	}
+	got, _ := models.GetDomainByID(apiDomain.ID)
+	if got.PathPrefix != "/v2" || got.StripPrefix || got.Priority != 0 {
+		t.Errorf("route not updated: %+v", got)
+	}
+}
+
+func TestAccessRules_UsersAndIPRules(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	app := &models.App{ProjectID: utils.GenerateRandomId(), Name: "staging", CreatedBy: utils.GenerateRandomId()}
+	app.InsertInDB()
+	domain, err := models.CreateDomain(app.ID, "staging.example.com")
+	if err != nil {
+		t.Fatalf("CreateDomain failed: %v", err)
+	}
+
+	user, err := models.CreateAccessUser(app.ID, nil, "reviewer", "correct horse")
+	if err != nil {
+		t.Fatalf("CreateAccessUser failed: %v", err)
+	}
+	if user.PasswordHash == "correct horse" || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("correct horse")) != nil {
+		t.Errorf("password should be stored as a bcrypt hash")
+	}
+	if err := models.UpdateAccessUserPassword(user.ID, "battery staple"); err != nil {
+		t.Fatalf("UpdateAccessUserPassword failed: %v", err)
+	}
+	updated, _ := models.GetAccessUserByID(user.ID)
+	if bcrypt.CompareHashAndPassword([]byte(updated.PasswordHash), []byte("battery staple")) != nil {
+		t.Errorf("password was not updated")
+	}
+
+	if exists, _ := models.AccessUserExists(app.ID, nil, "reviewer"); !exists {
+		t.Errorf("expected the app wide user to exist")
+	}
+	if exists, _ := models.AccessUserExists(app.ID, &domain.ID, "reviewer"); exists {
+		t.Errorf("a domain scope should not see the app wide user")
+	}
+
+	if _, err := models.CreateAccessUser(app.ID, &domain.ID, "reviewer", "another password"); err != nil {
+		t.Fatalf("CreateAccessUser for a domain failed: %v", err)
+	}
+	rule := &models.AccessIPRule{AppID: app.ID, DomainID: &domain.ID, Action: models.IPRuleDeny, Source: "203.0.113.0/24"}
+	if err := models.CreateAccessIPRule(rule); err != nil {
+		t.Fatalf("CreateAccessIPRule failed: %v", err)
+	}
+
+	// rules scoped to a domain are removed with it, app wide ones stay
+	if err := models.DeleteDomain(domain.ID); err != nil {
+		t.Fatalf("DeleteDomain failed: %v", err)
+	}
+	users, _ := models.GetAccessUsersByAppID(app.ID)
+	if len(users) != 1 || users[0].ID != user.ID {
+		t.Errorf("expected only the app wide user to remain, got %d users", len(users))
+	}
+	rules, _ := models.GetAccessIPRulesByAppID(app.ID)
+	if len(rules) != 0 {
+		t.Errorf("expected the domain's ip rule to be removed, got %d", len(rules))
+	}
+}
+
+func TestDomain_TrafficSettings(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	domain, err := models.CreateDomain(utils.GenerateRandomId(), "api.example.com")
+	if err != nil {
+		t.Fatalf("CreateDomain failed: %v", err)
+	}
+	if !domain.Headers.Empty() || domain.RateLimitAverage != 0 {
+		t.Errorf("new domains should have no rate limit or headers")
+	}
+
+	settings := models.DomainRoutingSettings{
+		ForceHttps:       true,
+		HstsMaxAge:       31536000,
+		RateLimitAverage: 20,
+		RateLimitBurst:   50,
+		Headers: models.DomainHeaders{
+			Response:              map[string]string{"X-Robots-Tag": "noindex", "Server": ""},
+			ContentSecurityPolicy: "default-src 'self'",
+			CorsAllowOrigins:      []string{"https://app.example.com"},
+			CorsAllowCredentials:  true,
+		},
+	}
+	if err := models.UpdateDomainRoutingSettings(domain.ID, settings); err != nil {
+		t.Fatalf("UpdateDomainRoutingSettings failed: %v", err)
+	}
+
+	got, _ := models.GetDomainByID(domain.ID)
+	if got.RateLimitAverage != 20 || got.RateLimitBurst != 50 {
+		t.Errorf("rate limit not saved: %d/%d", got.RateLimitAverage, got.RateLimitBurst)
+	}
+	if got.Headers.Response["X-Robots-Tag"] != "noindex" || got.Headers.ContentSecurityPolicy != "default-src 'self'" {
+		t.Errorf("headers not saved: %+v", got.Headers)
+	}
+	if v, ok := got.Headers.Response["Server"]; !ok || v != "" {
+		t.Errorf("an empty header value should be kept to remove the header")
+	}
+	if len(got.Headers.CorsAllowOrigins) != 1 || !got.Headers.CorsAllowCredentials {
+		t.Errorf("cors settings not saved: %+v", got.Headers)
+	}
+
+	settings.Headers = models.DomainHeaders{}
+	if err := models.UpdateDomainRoutingSettings(domain.ID, settings); err != nil {
+		t.Fatalf("UpdateDomainRoutingSettings failed: %v", err)
+	}
+	got, _ = models.GetDomainByID(domain.ID)
+	if !got.Headers.Empty() {
+		t.Errorf("expected headers to be cleared, got %+v", got.Headers)
+	}
+}
+
+func TestApp_MaintenanceMode(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	app := &models.App{ProjectID: utils.GenerateRandomId(), Name: "shop", CreatedBy: utils.GenerateRandomId()}
+	app.InsertInDB()
+	if app.MaintenanceMode {
+		t.Errorf("new apps should not be in maintenance")
+	}
+
+	page := "<h1>Back soon</h1>"
+	if err := models.UpdateAppMaintenance(app.ID, true, &page, nil); err != nil {
+		t.Fatalf("UpdateAppMaintenance failed: %v", err)
+	}
+	got, _ := models.GetApplicationByID(app.ID)
+	if !got.MaintenanceMode || got.MaintenancePage == nil || *got.MaintenancePage != page || got.ErrorPage != nil {
+		t.Errorf("maintenance settings not saved: %v %v %v", got.MaintenanceMode, got.MaintenancePage, got.ErrorPage)
+	}
+
+	// regular app updates leave maintenance alone
+	got.Name = "shop-v2"
+	if err := got.UpdateApplication(); err != nil {
+		t.Fatalf("UpdateApplication failed: %v", err)
+	}
+	got, _ = models.GetApplicationByID(app.ID)
+	if !got.MaintenanceMode {
+		t.Errorf("UpdateApplication should not turn maintenance off")
+	}
+
+	blank := "  "
+	if err := models.UpdateAppMaintenance(app.ID, false, &blank, nil); err != nil {
+		t.Fatalf("UpdateAppMaintenance failed: %v", err)
+	}
+	got, _ = models.GetApplicationByID(app.ID)
+	if got.MaintenanceMode || got.MaintenancePage != nil {
+		t.Errorf("expected maintenance off with the default page, got %v %v", got.MaintenanceMode, got.MaintenancePage)
+	}
+}
+
+func TestDomain_OwnershipVerification(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	projectA, projectB := utils.GenerateRandomId(), utils.GenerateRandomId()
+	appA := &models.App{ProjectID: projectA, Name: "web", CreatedBy: utils.GenerateRandomId()}
+	appA.InsertInDB()
+	apiA := &models.App{ProjectID: projectA, Name: "api", CreatedBy: utils.GenerateRandomId()}
+	apiA.InsertInDB()
+
+	d, err := models.CreateDomain(appA.ID, "shop.example.com")
+	if err != nil {
+		t.Fatalf("CreateDomain failed: %v", err)
+	}
+	if d.OwnershipVerified || d.VerificationToken == "" {
+		t.Fatalf("new domains should start unverified with a token, got %v %q", d.OwnershipVerified, d.VerificationToken)
+	}
+
+	used, _ := models.HostUsedByOtherProject("SHOP.example.com", projectB)
+	if !used {
+		t.Errorf("host should be taken for other projects")
+	}
+	used, _ = models.HostUsedByOtherProject("shop.example.com", projectA)
+	if used {
+		t.Errorf("host should stay usable inside its own project")
+	}
+
+	if ok, _ := models.HostVerifiedInProject("shop.example.com", projectA); ok {
+		t.Errorf("host isn't verified yet")
+	}
+	if err := d.MarkOwnershipVerified(models.VerificationMethodDnsTxt); err != nil {
+		t.Fatalf("MarkOwnershipVerified failed: %v", err)
+	}
+	got, _ := models.GetDomainByID(d.ID)
+	if !got.OwnershipVerified || got.VerificationMethod != models.VerificationMethodDnsTxt || got.OwnershipVerifiedAt == nil {
+		t.Errorf("verification not saved: %v %q %v", got.OwnershipVerified, got.VerificationMethod, got.OwnershipVerifiedAt)
+	}
+	if ok, _ := models.HostVerifiedInProject("shop.example.com", projectA); !ok {
+		t.Errorf("host should count as verified for the project")
+	}
+	if ok, _ := models.HostVerifiedInProject("shop.example.com", projectB); ok {
+		t.Errorf("verification should not carry over to other projects")
+	}
+
+	// only a real host change drops the verification
+	if err := models.UpdateDomain(d.ID, "Shop.Example.com"); err != nil {
+		t.Fatalf("UpdateDomain failed: %v", err)
+	}
+	got, _ = models.GetDomainByID(d.ID)
+	if !got.OwnershipVerified {
+		t.Errorf("changing the case of the host should keep the verification")
+	}
+	token := got.VerificationToken
+	if err := models.UpdateDomain(d.ID, "store.example.com"); err != nil {
+		t.Fatalf("UpdateDomain failed: %v", err)
+	}
+	got, _ = models.GetDomainByID(d.ID)
+	if got.OwnershipVerified || got.VerificationMethod != "" || got.OwnershipVerifiedAt != nil || got.VerificationToken == token {
+		t.Errorf("a new host should reset verification, got %v %q %v", got.OwnershipVerified, got.VerificationMethod, got.OwnershipVerifiedAt)
+	}
+
+	legacy := &models.Domain{ID: utils.GenerateRandomId(), AppID: apiA.ID, Domain: "legacy.example.com"}
+	if err := db.Create(legacy).Error; err != nil {
+		t.Fatalf("failed to insert domain: %v", err)
+	}
+	if err := models.EnsureVerificationToken(legacy); err != nil || legacy.VerificationToken == "" {
+		t.Fatalf("EnsureVerificationToken failed: %v %q", err, legacy.VerificationToken)
+	}
+	got, _ = models.GetDomainByID(legacy.ID)
+	if got.VerificationToken != legacy.VerificationToken {
+		t.Errorf("token not saved, got %q", got.VerificationToken)
+	}
+}
+
+func TestGithub_ParseCommitDirectives(t *testing.T) {
+	tests := []struct {
+		name       string
+		message    string
+		skipDeploy bool
+		noCache    bool
+		found      []string
+	}{
+		{"none", "fix: handle empty config", false, false, nil},
+		{"skip deploy", "docs: typo [skip deploy]", true, false, []string{"[skip deploy]"}},
+		{"mist skip", "[mist skip] chore: bump deps", true, false, []string{"[mist skip]"}},
+		{"no cache", "build: new base image [mist no-cache]", false, true, []string{"[mist no-cache]"}},
+		{"mixed case", "chore: [Skip Deploy] and [MIST No-Cache]", true, true, []string{"[skip deploy]", "[mist no-cache]"}},
+		{"several", "release\n\n[skip deploy] [mist skip] [mist no-cache]", true, true, []string{"[skip deploy]", "[mist skip]", "[mist no-cache]"}},
+		{"directive in body", "feat: add search\n\nlarge rebuild [mist no-cache]", false, true, []string{"[mist no-cache]"}},
+		{"lookalikes in body", "fix: deploys\n\nwe used to skip deploy on docs, see [skip-deploy] and [mist  skip] or [no-cache]", false, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := github.ParseCommitDirectives(tt.message)
+			if d.SkipDeploy != tt.skipDeploy || d.NoCache != tt.noCache {
+				t.Errorf("expected skip=%v nocache=%v, got skip=%v nocache=%v", tt.skipDeploy, tt.noCache, d.SkipDeploy, d.NoCache)
+			}
+			if fmt.Sprint(d.Found) != fmt.Sprint(tt.found) {
+				t.Errorf("expected found %v, got %v", tt.found, d.Found)
+			}
+		})
+	}
+}
+
+func TestDomain_HostnameValidation(t *testing.T) {
+	valid := []string{"example.com", "Shop.Example.com", "*.example.com", "a-b.c1.example.io", "localhost"}
+	for _, host := range valid {
+		if err := traefik.ValidateHostname(host); err != nil {
+			t.Errorf("%q should be valid: %v", host, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"*.",
+		"example.com.",
+		"-shop.example.com",
+		"shop-.example.com",
+		"a.*.example.com",
+		"shop example.com",
+		"x`) || PathPrefix(`/`) || Host(`a.example.com",
+	}
+	for _, host := range invalid {
+		if err := traefik.ValidateHostname(host); err == nil {
+			t.Errorf("%q should be rejected", host)
+		}
+		if _, err := traefik.RouteRule(host, ""); err == nil {
+			t.Errorf("RouteRule should reject %q", host)
+		}
+	}
+
+	rule, err := traefik.RouteRule("shop.example.com", "/api")
+	if err != nil || rule != "Host(`shop.example.com`) && PathPrefix(`/api`)" {
+		t.Errorf("unexpected rule %q: %v", rule, err)
+	}
+
+	// Host() only matches literally, wildcards need a regexp
+	rule, err = traefik.RouteRule("*.example.com", "")
+	if err != nil || rule != "HostRegexp(`^[a-z0-9-]+\\.example\\.com$`)" {
+		t.Errorf("unexpected wildcard rule %q: %v", rule, err)
+	}
+}
+
+func TestDeployment_GetByAppIDRefAndCommitHash(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	app := &models.App{ProjectID: utils.GenerateRandomId(), Name: "release-app", CreatedBy: utils.GenerateRandomId()}
+	app.InsertInDB()
+
+	branch := "refs/heads/main"
+	deployment := &models.Deployment{AppID: app.ID, CommitHash: "abc123", Ref: &branch}
+	if err := deployment.CreateDeployment(); err != nil {
+		t.Fatalf("CreateDeployment failed: %v", err)
+	}
+
+	found, err := models.GetDeploymentByAppIDRefAndCommitHash(app.ID, branch, "abc123")
+	if err != nil || found.ID != deployment.ID {
+		t.Fatalf("expected the branch deployment, got %v %v", found, err)
+	}
+
+	// tagging the deployed commit is a new deployment
+	if _, err := models.GetDeploymentByAppIDRefAndCommitHash(app.ID, "refs/tags/v1.0.0", "abc123"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("tag of a deployed commit should not count as a duplicate, got %v", err)
+	}
+
+	// deployments from before refs were stored count as pushes to the app's branch
+	legacy := &models.Deployment{AppID: app.ID, CommitHash: "def456"}
+	if err := legacy.CreateDeployment(); err != nil {
+		t.Fatalf("CreateDeployment failed: %v", err)
+	}
+	found, err = models.GetDeploymentByAppIDRefAndCommitHash(app.ID, branch, "def456")
+	if err != nil || found.ID != legacy.ID {
+		t.Errorf("a deployment without a ref should match the app's branch, got %v %v", found, err)
+	}
+	if _, err := models.GetDeploymentByAppIDRefAndCommitHash(app.ID, "refs/tags/v1.1.0", "def456"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("a deployment without a ref should not match a tag, got %v", err)
+	}
+}
+
+func TestDeployment_SupersededStatusIsFinal(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	app := &models.App{ProjectID: utils.GenerateRandomId(), Name: "busy-app", CreatedBy: utils.GenerateRandomId()}
+	app.InsertInDB()
+
+	deployment := &models.Deployment{AppID: app.ID, CommitHash: "abc123"}
+	if err := deployment.CreateDeployment(); err != nil {
+		t.Fatalf("CreateDeployment failed: %v", err)
+	}
+
+	errMsg := "superseded by deployment 2"
+	if err := models.UpdateDeploymentStatus(deployment.ID, "superseded", "superseded", 40, &errMsg); err != nil {
+		t.Fatalf("UpdateDeploymentStatus failed: %v", err)
+	}
+	// the cancelled worker can still finish afterwards
+	if err := models.UpdateDeploymentStatus(deployment.ID, "success", "success", 100, nil); err != nil {
+		t.Fatalf("UpdateDeploymentStatus failed: %v", err)
+	}
+
+	got, _ := models.GetDeploymentByID(deployment.ID)
+	if got.Status != models.DeploymentStatusSuperseded {
+		t.Errorf("superseded should not be overwritten, got %s", got.Status)
+	}
+}
+
+func writeTestTarGz(t *testing.T, path string, entries []tar.Header) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, hdr := range entries {
+		body := "escaped"
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(body))
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte(body))
+		}
+	}
+	tw.Close()
+	gz.Close()
+}
+
+func TestExtractArchive_SymlinkChainEscape(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tar.Header
+	}{
+		{"write through chain", []tar.Header{
+			{Name: "s", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "t", Typeflag: tar.TypeSymlink, Linkname: "s/.."},
+			{Name: "t/escape.txt", Typeflag: tar.TypeReg, Mode: 0o644},
+		}},
+		{"chain left behind", []tar.Header{
+			{Name: "t", Typeflag: tar.TypeSymlink, Linkname: "s/.."},
+			{Name: "s", Typeflag: tar.TypeSymlink, Linkname: "."},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archive := filepath.Join(dir, "upload.tar.gz")
+			writeTestTarGz(t, archive, tt.entries)
+
+			err := mistfs.ExtractArchive(context.Background(), archive, filepath.Join(dir, "dest"), 1<<20)
+			if err == nil {
+				t.Errorf("expected the archive to be rejected")
+			}
+			if _, statErr := os.Stat(filepath.Join(dir, "escape.txt")); statErr == nil {
+				t.Errorf("file was written outside the destination")
+			}
+		})
+	}
+
+	// links that stay inside are kept
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "upload.tar.gz")
+	writeTestTarGz(t, archive, []tar.Header{
+		{Name: "src/main.txt", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "current", Typeflag: tar.TypeSymlink, Linkname: "src/main.txt"},
+	})
+	if err := mistfs.ExtractArchive(context.Background(), archive, filepath.Join(dir, "dest"), 1<<20); err != nil {
+		t.Fatalf("ExtractArchive failed: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "dest", "current")); err != nil || target != "src/main.txt" {
+		t.Errorf("expected link to be extracted, got %q %v", target, err)
+	}
+}
+
+func TestApp_ComposeProjectName(t *testing.T) {
+	db := setupTestDB(t)
+	defer cleanupDB(db)
+
+	if got := models.NormalizeComposeProjectName("_My.Shop App-2"); got != "myshopapp-2" {
+		t.Errorf("unexpected normalized name %q", got)
+	}
+
+	// compose apps deployed before per-app project names keep their old one
+	existing := &models.App{ProjectID: utils.GenerateRandomId(), Name: "Shop", AppType: models.AppTypeCompose, CreatedBy: utils.GenerateRandomId()}
+	existing.InsertInDB()
+	web := &models.App{ProjectID: existing.ProjectID, Name: "site", CreatedBy: existing.CreatedBy}
+	web.InsertInDB()
+	// same named apps in different projects shared one compose project, the owner is found from its containers
+	twinA := &models.App{ProjectID: utils.GenerateRandomId(), Name: "twin-blog", AppType: models.AppTypeCompose, CreatedBy: existing.CreatedBy}
+	twinA.InsertInDB()
+	twinB := &models.App{ProjectID: utils.GenerateRandomId(), Name: "Twin-Blog", AppType: models.AppTypeCompose, CreatedBy: existing.CreatedBy}
+	twinB.InsertInDB()
+	db.Where("key = ?", "compose_project_defaults_applied").Delete(&models.SystemSettingEntry{})
+	if err := mistdb.MigrateDB(db); err != nil {
+		t.Fatalf("MigrateDB failed: %v", err)
+	}
+
+	if project, err := models.GetAppComposeProject(existing.ID); err != nil || project != "shop" {
+		t.Errorf("expected the legacy project name, got %q %v", project, err)
+	}
+	if project, _ := models.GetAppComposeProject(web.ID); project != "" {
+		t.Errorf("non compose apps should not get a project name, got %q", project)
+	}
+	for _, twin := range []*models.App{twinA, twinB} {
+		if project, _ := models.GetAppComposeProject(twin.ID); project != "" {
+			t.Errorf("apps sharing a legacy project name should not both keep it, got %q", project)
+		}
+	}
+	if err := models.UpdateAppComposeProject(twinA.ID, "twin-blog"); err != nil {
+		t.Fatalf("UpdateAppComposeProject failed: %v", err)
+	}
+	if used, _ := models.ComposeProjectUsedByOtherApp("twin-blog", twinB.ID); !used {
+		t.Errorf("a project adopted by one app should count as used for the other")
+	}
+	if used, _ := models.ComposeProjectUsedByOtherApp("twin-blog", twinA.ID); used {
+		t.Errorf("an app's own project should not count as used")
+	}
+
+	fresh := &models.App{ProjectID: existing.ProjectID, Name: "queue", AppType: models.AppTypeCompose, CreatedBy: existing.CreatedBy}
+	fresh.InsertInDB()
+	if project, _ := models.GetAppComposeProject(fresh.ID); project != "" {
+		t.Errorf("new apps should use the default project name, got %q", project)
+	}
+	if err := models.UpdateAppComposeProject(fresh.ID, "custom"); err != nil {
+		t.Fatalf("UpdateAppComposeProject failed: %v", err)
+	}
+	if project, _ := models.GetAppComposeProject(fresh.ID); project != "custom" {
+		t.Errorf("project name not saved, got %q", project)
+	}
+}
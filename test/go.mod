@@ -6,6 +6,7 @@ replace github.com/corecollectives/mist => ../server
 
 require (
 	github.com/corecollectives/mist v0.0.0
+	golang.org/x/crypto v0.46.0
 	gorm.io/driver/sqlite v1.6.0
 	gorm.io/gorm v1.31.1
 )
@@ -20,7 +21,6 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.33 // indirect
 	github.com/rogpeppe/go-internal v1.14.1 // indirect
 	github.com/rs/zerolog v1.34.0 // indirect
-	golang.org/x/crypto v0.46.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
 	golang.org/x/text v0.33.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect